@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var (
+	// alignModules holds the module paths given
+	// to the align subcommand.
+	alignModules []string
+
+	alignWrite bool
+)
+
+// parseAlign parses the arguments to the align subcommand,
+// the paths of the modules to consider, all of them if none
+// are given.
+func (ctxt *context) parseAlign(args []string) {
+	alignModules = args
+}
+
+// runAlign reports each module that the go.mod files in the
+// tree require at more than one version, failing if there are
+// any. With -w, it instead changes each of those go.mod files
+// to require the highest of the versions.
+func runAlign(ctxt *context) {
+	if alignWrite && !*noEdit {
+		ctxt.lockTree()
+	}
+	versions := make(map[string]map[string][]string)
+	var paths []string
+	for _, req := range treeRequirements(ctxt.cwd) {
+		if len(alignModules) > 0 && !contains(alignModules, req.path) {
+			continue
+		}
+		if versions[req.path] == nil {
+			versions[req.path] = make(map[string][]string)
+			paths = append(paths, req.path)
+		}
+		versions[req.path][req.version] = append(versions[req.path][req.version], req.gomod)
+	}
+	sort.Strings(paths)
+	// targets holds the version to require of each module
+	// whose requirements disagree, and disagreeing holds
+	// the versions required of it, in order.
+	targets := make(map[string]string)
+	disagreeing := make(map[string][]string)
+	for _, path := range paths {
+		if len(versions[path]) < 2 {
+			continue
+		}
+		var vs []string
+		for v := range versions[path] {
+			vs = append(vs, v)
+		}
+		sort.Slice(vs, func(i, j int) bool {
+			return vers.CompareVersions(vs[i], vs[j]) < 0
+		})
+		targets[path] = vs[len(vs)-1]
+		disagreeing[path] = vs
+		if alignWrite {
+			continue
+		}
+		logf("%s is required at %d different versions:", path, len(vs))
+		for _, v := range vs {
+			var files []string
+			for _, gomod := range versions[path][v] {
+				files = append(files, ctxt.relPath(gomod))
+			}
+			fmt.Fprintf(os.Stderr, "\t%s: %s\n", v, strings.Join(files, ", "))
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+	if !alignWrite {
+		logf("run \"govers align -w\" to require the highest version of each throughout")
+		ctxt.exit(1)
+	}
+	changed := make(map[string]bool)
+	var files []string
+	for _, path := range paths {
+		target := targets[path]
+		for _, v := range disagreeing[path] {
+			if v == target {
+				continue
+			}
+			for _, gomod := range versions[path][v] {
+				if !changed[gomod] {
+					changed[gomod] = true
+					files = append(files, gomod)
+				}
+				if *noEdit {
+					logf("%s: would require %s %s, not %s", ctxt.relPath(gomod), path, target, v)
+				} else {
+					logf("%s: now requires %s %s, not %s", ctxt.relPath(gomod), path, target, v)
+				}
+			}
+		}
+	}
+	sort.Strings(files)
+	for _, gomod := range files {
+		if err := alignGoMod(gomod, targets); err != nil {
+			fatalf("cannot update %s: %v", ctxt.relPath(gomod), err)
+		}
+		fmt.Printf("%s\n", ctxt.relPath(gomod))
+	}
+	if !*noEdit {
+		logf("run \"go mod tidy\" in each changed module to update its go.sum file")
+	}
+}
+
+// alignGoMod changes the given go.mod file so that it requires
+// the version held in targets of each module with an entry.
+func alignGoMod(gomod string, targets map[string]string) error {
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		return err
+	}
+	m := parseGoMod(data)
+	for _, r := range m.requires() {
+		if v := targets[r.path]; v != "" && v != r.version {
+			m.setRequire(r, r.path, v)
+		}
+	}
+	if *noEdit {
+		return nil
+	}
+	info, err := os.Stat(gomod)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(gomod, m.bytes(), info.Mode().Perm())
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// missingUse holds a use, in a file whose imports would be
+// changed, of an identifier that the new package does not define.
+type missingUse struct {
+	pos token.Position
+	msg string
+}
+
+// runAPI type-checks each package in the tree whose imports would
+// be changed as it would be after the change, without changing
+// anything, and prints each use of an identifier from a new
+// package path that the package at that path does not define,
+// so that the call sites that would fail to compile can be fixed
+// first. It exits with a non-zero status if there are any.
+func runAPI(ctxt *context) {
+	rw := ctxt.newRewriter(vers.WithoutDependencies(true), vers.WithDryRun(true))
+	plan, err := rw.Plan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.result = plan.Result
+	ctxt.filterPlan(plan)
+	edits := make(map[string]*vers.FileEdit)
+	var pkgs []*vers.Package
+	for _, edit := range plan.Files {
+		if len(edit.Changes) == 0 {
+			continue
+		}
+		if len(pkgs) == 0 || pkgs[len(pkgs)-1] != edit.Package {
+			pkgs = append(pkgs, edit.Package)
+		}
+		edits[edit.Path] = edit
+	}
+	a := &apiChecker{
+		ctxt:     ctxt,
+		rw:       rw,
+		edits:    edits,
+		fset:     token.NewFileSet(),
+		failures: make(map[string]error),
+	}
+	a.imp = importer.ForCompiler(a.fset, "source", nil).(types.ImporterFrom)
+	var uses []missingUse
+	for _, p := range pkgs {
+		uses = append(uses, a.checkPackage(p)...)
+	}
+	var failed []string
+	for path := range a.failures {
+		failed = append(failed, path)
+	}
+	sort.Strings(failed)
+	for _, path := range failed {
+		logf("cannot load %s, so uses of it were not checked: %v", path, a.failures[path])
+	}
+	sort.Slice(uses, func(i, j int) bool {
+		pi, pj := uses[i].pos, uses[j].pos
+		if pi.Filename != pj.Filename {
+			return pi.Filename < pj.Filename
+		}
+		return pi.Offset < pj.Offset
+	})
+	for _, u := range uses {
+		fmt.Printf("%s:%d:%d: %s\n", ctxt.relPath(u.pos.Filename), u.pos.Line, u.pos.Column, u.msg)
+	}
+	if len(uses) > 0 {
+		logf("found %d uses of identifiers missing in the new packages", len(uses))
+		ctxt.exit(1)
+	}
+}
+
+// apiChecker holds the state used by runAPI.
+type apiChecker struct {
+	ctxt  *context
+	rw    *vers.Rewriter
+	edits map[string]*vers.FileEdit
+	fset  *token.FileSet
+	imp   types.ImporterFrom
+
+	// failures maps from each new package path
+	// that could not be imported to the error.
+	failures map[string]error
+}
+
+// ImportFrom implements types.ImporterFrom
+// by recording any packages that fail to load.
+func (a *apiChecker) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	pkg, err := a.imp.ImportFrom(path, dir, mode)
+	if err != nil {
+		if _, ok := a.failures[path]; !ok {
+			a.failures[path] = err
+		}
+	}
+	return pkg, err
+}
+
+func (a *apiChecker) Import(path string) (*types.Package, error) {
+	return a.ImportFrom(path, "", 0)
+}
+
+// checkPackage type-checks p with its files as changed by the plan,
+// and returns the missing uses in the changed files. The package's
+// in-package tests are checked along with it, and its external
+// tests separately.
+func (a *apiChecker) checkPackage(p *vers.Package) []missingUse {
+	bp, err := a.ctxt.buildCtxt.ImportDir(p.Dir, 0)
+	if err != nil {
+		logf("cannot load %s: %v", p.ImportPath, err)
+		return nil
+	}
+	var uses []missingUse
+	for _, names := range [][]string{
+		append(append([]string(nil), bp.GoFiles...), bp.TestGoFiles...),
+		bp.XTestGoFiles,
+	} {
+		uses = append(uses, a.checkFiles(p, names)...)
+	}
+	return uses
+}
+
+// checkFiles type-checks the given files in p's directory
+// as one package, if any of them are to be changed.
+func (a *apiChecker) checkFiles(p *vers.Package, names []string) []missingUse {
+	var files []*ast.File
+	var changed []*ast.File
+	for _, name := range names {
+		path := filepath.Join(p.Dir, name)
+		var src []byte
+		edit := a.edits[path]
+		if edit != nil {
+			var err error
+			if _, src, err = a.rw.Content(edit); err != nil {
+				logf("%v", err)
+				return nil
+			}
+		}
+		f, err := parser.ParseFile(a.fset, path, src, 0)
+		if err != nil {
+			logf("cannot parse %s: %v", a.ctxt.relPath(path), err)
+			return nil
+		}
+		files = append(files, f)
+		if edit != nil {
+			changed = append(changed, f)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	conf := &types.Config{
+		Importer:    a,
+		FakeImportC: true,
+		// Errors unrelated to the change are of
+		// no interest here.
+		Error: func(error) {},
+	}
+	info := &types.Info{
+		Types:      make(map[ast.Expr]types.TypeAndValue),
+		Uses:       make(map[*ast.Ident]types.Object),
+		Selections: make(map[*ast.SelectorExpr]*types.Selection),
+	}
+	conf.Check(p.ImportPath, a.fset, files, info)
+	var uses []missingUse
+	for _, f := range changed {
+		newPaths := make(map[string]bool)
+		for _, c := range a.edits[a.fset.File(f.Pos()).Name()].Changes {
+			newPaths[c.New] = true
+		}
+		ast.Inspect(f, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok || info.Uses[sel.Sel] != nil || info.Selections[sel] != nil {
+				return true
+			}
+			if msg := a.missing(sel, info, newPaths); msg != "" {
+				uses = append(uses, missingUse{
+					pos: a.fset.Position(sel.Sel.Pos()),
+					msg: msg,
+				})
+			}
+			return true
+		})
+	}
+	return uses
+}
+
+// missing returns a description of the selector sel, which
+// the type checker could not resolve, if it refers to an
+// identifier that is missing from one of the new packages,
+// or "" otherwise.
+func (a *apiChecker) missing(sel *ast.SelectorExpr, info *types.Info, newPaths map[string]bool) string {
+	if id, ok := sel.X.(*ast.Ident); ok {
+		if pn, ok := info.Uses[id].(*types.PkgName); ok {
+			path := pn.Imported().Path()
+			if !newPaths[path] || a.failures[path] != nil {
+				return ""
+			}
+			return fmt.Sprintf("%s.%s is not defined in %s", id.Name, sel.Sel.Name, path)
+		}
+	}
+	t := info.Types[sel.X].Type
+	if t == nil {
+		return ""
+	}
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return ""
+	}
+	path := named.Obj().Pkg().Path()
+	if !newPaths[path] || a.failures[path] != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s.%s has no field or method %s", named.Obj().Pkg().Name(), named.Obj().Name(), sel.Sel.Name)
+}
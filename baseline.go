@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var checkBaseline string
+
+// baseline holds the problems known when a baseline was
+// recorded by the -baseline flag of the check subcommand.
+// Entries do not include line numbers, so that they still
+// match after unrelated edits.
+type baseline struct {
+	Findings       []baselineFinding
+	Changes        []baselineChange
+	LockMismatches []baselineLockMismatch
+	MixedMajors    []baselineMixedMajors
+	AllMajors      []baselineFamilyMajors `json:",omitempty"`
+}
+
+type baselineFinding struct {
+	Importer   string
+	ImportPath string
+}
+
+type baselineChange struct {
+	Path string
+	Old  string
+	New  string
+}
+
+type baselineMixedMajors struct {
+	Importer string
+	Family   string
+}
+
+// baselineFamilyMajors records the major versions of a
+// family found by -all-majors, joined by spaces, so that
+// the entry can be compared.
+type baselineFamilyMajors struct {
+	Family string
+	Majors string
+}
+
+type baselineLockMismatch struct {
+	Project    string
+	Importer   string
+	ImportPath string
+}
+
+// applyBaseline records the problems in r in the baseline file
+// if it does not exist yet, so that they are all accepted, or
+// otherwise removes from r and ctxt.result the problems that
+// the file records, so that only new problems cause failure.
+// The plan must have been made without failing modules with
+// inconsistent dependencies, so that r holds all the changes
+// needed; those in modules whose inconsistencies are not all
+// recorded are left out again, as they would be without a
+// baseline.
+func (ctxt *context) applyBaseline(plan *vers.Plan, r *report) {
+	data, err := os.ReadFile(checkBaseline)
+	if os.IsNotExist(err) {
+		ctxt.writeBaseline(r)
+		logf("recorded %d known problems in %s", len(r.Findings)+len(r.Changes)+len(r.LockMismatches)+len(r.MixedMajors)+len(r.AllMajors), checkBaseline)
+		r.Findings, r.Changes, r.LockMismatches, r.MixedMajors, r.AllMajors = nil, nil, nil, nil, nil
+		ctxt.result.Findings = nil
+		ctxt.updateFailed()
+		return
+	}
+	if err != nil {
+		fatalf("cannot read baseline: %v", err)
+	}
+	var b baseline
+	if err := json.Unmarshal(data, &b); err != nil {
+		fatalf("cannot read baseline %s: %v", checkBaseline, err)
+	}
+	known := make(map[interface{}]bool)
+	for _, f := range b.Findings {
+		known[f] = true
+	}
+	for _, c := range b.Changes {
+		known[c] = true
+	}
+	for _, m := range b.LockMismatches {
+		known[m] = true
+	}
+	for _, m := range b.MixedMajors {
+		known[m] = true
+	}
+	for _, m := range b.AllMajors {
+		known[m] = true
+	}
+	n := 0
+	var findings []*vers.Finding
+	for _, f := range r.Findings {
+		if known[newBaselineFinding(f)] {
+			n++
+		} else {
+			findings = append(findings, f)
+		}
+	}
+	ctxt.result.Findings = findings
+	ctxt.updateFailed()
+	var changes []*vers.ImportChange
+	for _, edit := range plan.Files {
+		if mod := edit.Package.Module; mod != nil && mod.Failed && *depCheck == "error" {
+			continue
+		}
+		for _, c := range edit.Changes {
+			if known[ctxt.newBaselineChange(c)] {
+				n++
+			} else {
+				changes = append(changes, c)
+			}
+		}
+	}
+	var mismatches []*lockMismatch
+	for _, m := range r.LockMismatches {
+		if known[newBaselineLockMismatch(m)] {
+			n++
+		} else {
+			mismatches = append(mismatches, m)
+		}
+	}
+	var mixed []*vers.MixedMajors
+	for _, m := range r.MixedMajors {
+		if known[newBaselineMixedMajors(m)] {
+			n++
+		} else {
+			mixed = append(mixed, m)
+		}
+	}
+	var all []*vers.FamilyMajors
+	for _, m := range r.AllMajors {
+		if known[newBaselineFamilyMajors(m)] {
+			n++
+		} else {
+			all = append(all, m)
+		}
+	}
+	if n > 0 {
+		logf("ignoring %d problems recorded in %s", n, checkBaseline)
+	}
+	r.Findings, r.Changes, r.LockMismatches, r.MixedMajors, r.AllMajors = findings, changes, mismatches, mixed, all
+}
+
+// writeBaseline writes the problems in r to the baseline file.
+func (ctxt *context) writeBaseline(r *report) {
+	b := baseline{
+		Findings:       []baselineFinding{},
+		Changes:        []baselineChange{},
+		LockMismatches: []baselineLockMismatch{},
+		MixedMajors:    []baselineMixedMajors{},
+	}
+	for _, f := range r.Findings {
+		b.Findings = append(b.Findings, newBaselineFinding(f))
+	}
+	for _, c := range r.Changes {
+		b.Changes = append(b.Changes, ctxt.newBaselineChange(c))
+	}
+	for _, m := range r.LockMismatches {
+		b.LockMismatches = append(b.LockMismatches, newBaselineLockMismatch(m))
+	}
+	for _, m := range r.MixedMajors {
+		b.MixedMajors = append(b.MixedMajors, newBaselineMixedMajors(m))
+	}
+	for _, m := range r.AllMajors {
+		b.AllMajors = append(b.AllMajors, newBaselineFamilyMajors(m))
+	}
+	data, err := json.MarshalIndent(b, "", "\t")
+	if err != nil {
+		fatalf("cannot write baseline: %v", err)
+	}
+	if err := os.WriteFile(checkBaseline, append(data, '\n'), 0o666); err != nil {
+		fatalf("cannot write baseline: %v", err)
+	}
+}
+
+// updateFailed marks as failed just those modules
+// with findings remaining in ctxt.result.
+func (ctxt *context) updateFailed() {
+	for _, mod := range ctxt.result.Modules {
+		mod.Failed = false
+	}
+	for _, f := range ctxt.result.Findings {
+		if f.Module != nil {
+			f.Module.Failed = true
+		}
+	}
+}
+
+func newBaselineFinding(f *vers.Finding) baselineFinding {
+	return baselineFinding{
+		Importer:   f.Importer,
+		ImportPath: f.ImportPath,
+	}
+}
+
+// newBaselineChange returns the baseline entry for c, with
+// its path relative to the current directory so that the
+// baseline can be used in other checkouts.
+func (ctxt *context) newBaselineChange(c *vers.ImportChange) baselineChange {
+	return baselineChange{
+		Path: filepath.ToSlash(ctxt.relPath(c.Pos.Filename)),
+		Old:  c.Old,
+		New:  c.New,
+	}
+}
+
+func newBaselineLockMismatch(m *lockMismatch) baselineLockMismatch {
+	return baselineLockMismatch{
+		Project:    m.project.name,
+		Importer:   m.importer,
+		ImportPath: m.importPath,
+	}
+}
+
+func newBaselineMixedMajors(m *vers.MixedMajors) baselineMixedMajors {
+	return baselineMixedMajors{
+		Importer: m.Importer,
+		Family:   m.Family,
+	}
+}
+
+func newBaselineFamilyMajors(m *vers.FamilyMajors) baselineFamilyMajors {
+	return baselineFamilyMajors{
+		Family: m.Family,
+		Majors: strings.Join(m.Majors, " "),
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var bumpLatest bool
+
+// parseFamilies sets ctxt.rules to move each of the package
+// families named by args to its next major version.
+func (ctxt *context) parseFamilies(args []string) {
+	rw := ctxt.newRewriter(vers.WithoutDependencies(true), vers.WithDryRun(true))
+	result, err := rw.Scan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	for _, family := range args {
+		family = strings.TrimSuffix(family, "/")
+		major, sep, ok := highestMajor(result, family)
+		if !ok {
+			fatalf("no imports of %s found", family)
+		}
+		next := major + 1
+		if bumpLatest {
+			proxy := newGoProxy()
+			if !proxy.usable() {
+				fatalf("-latest requires a module proxy, but GOPROXY does not name one")
+			}
+			next, err = latestMajor(proxy, family, sep, major)
+			if err != nil {
+				fatalf("cannot query module proxy: %v", err)
+			}
+			if next <= major {
+				fatalf("no major version of %s newer than v%d found", family, major)
+			}
+		}
+		newPath := majorPath(family, sep, next)
+		logf("moving %s from v%d to %s", family, major, newPath)
+		var r *vers.Rule
+		if sep == "" {
+			// The imports have no version element
+			// for the rule made from newPath to match.
+			r, err = familyRule(family, newPath)
+		} else {
+			r, err = vers.ParseRule(newPath, "", *versFlag)
+		}
+		if err != nil {
+			fatalf("%v", err)
+		}
+		ctxt.rules = append(ctxt.rules, r)
+	}
+}
+
+// familyRule returns the rule that changes the imports of the
+// package family to use newPath, matching its paths both with
+// and without a version element, so that imports at major
+// version 1, such as github.com/owner/repo/pkg, are changed
+// too, but imports of newPath itself are left alone.
+func familyRule(family, newPath string) (*vers.Rule, error) {
+	versPat := *versFlag
+	if versPat == "" {
+		versPat = vers.DefaultVersionPattern
+	}
+	pat, err := regexp.Compile("^(" + regexp.QuoteMeta(family) + "(?:" + versPat + ")?)(/|$)")
+	if err != nil {
+		return nil, fmt.Errorf("invalid version pattern: %v", err)
+	}
+	return &vers.Rule{
+		Arg:           newPath,
+		NewPackage:    newPath,
+		OldPackagePat: pat,
+	}, nil
+}
+
+// highestMajor returns the highest major version of the given
+// package family imported by the packages in result, and the
+// separator that precedes its version element ("/" or ".").
+// An import without a version element is taken to be major
+// version 1, and its separator is empty.
+func highestMajor(result *vers.Result, family string) (major int, sep string, ok bool) {
+	pat := regexp.MustCompile("^" + regexp.QuoteMeta(family) + `(?:([/.])v([0-9]+))?(/|$)`)
+	for _, imp := range result.Imports {
+		m := pat.FindStringSubmatch(imp.To)
+		if m == nil {
+			continue
+		}
+		n, s := 1, ""
+		if m[2] != "" {
+			n, _ = strconv.Atoi(m[2])
+			s = m[1]
+		}
+		if !ok || n > major || (n == major && sep == "") {
+			major, sep, ok = n, s, true
+		}
+	}
+	return major, sep, ok
+}
+
+// majorPath returns the import path of the given major
+// version of the package family. When sep is empty, the
+// separator is chosen to suit the host: gopkg.in uses ".",
+// and everything else "/".
+func majorPath(family, sep string, major int) string {
+	if sep == "" {
+		sep = "/"
+		if strings.HasPrefix(family, "gopkg.in/") {
+			sep = "."
+		}
+	}
+	return fmt.Sprintf("%s%sv%d", family, sep, major)
+}
+
+// latestMajor asks the module proxy for each major version of the
+// family after the given one in turn, returning the last one that
+// has been published.
+func latestMajor(proxy *goProxy, family, sep string, major int) (int, error) {
+	latest := major
+	for n := major + 1; ; n++ {
+		ok, err := proxy.published(majorPath(family, sep, n))
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			return latest, nil
+		}
+		latest = n
+	}
+}
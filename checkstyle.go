@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// checkstyleReport holds a report as printed by -format
+// checkstyle, in the Checkstyle XML format read by review
+// tools such as reviewdog to annotate pull requests.
+type checkstyleReport struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleFile struct {
+	Name   string            `xml:"name,attr"`
+	Errors []checkstyleError `xml:"error"`
+}
+
+type checkstyleError struct {
+	Line     int    `xml:"line,attr"`
+	Column   int    `xml:"column,attr,omitempty"`
+	Severity string `xml:"severity,attr"`
+	Message  string `xml:"message,attr"`
+	Source   string `xml:"source,attr"`
+}
+
+// writeCheckstyleReport writes r in the Checkstyle XML format,
+// with an entry at each import that would be changed, each
+// import of an inconsistent path by a dependency whose position
+// is known, and each disagreeing legacy lock file entry. The
+// files are ordered by name and their entries by line.
+func writeCheckstyleReport(w io.Writer, r *report) error {
+	files := make(map[string][]checkstyleError)
+	add := func(pos string, line, col int, severity, msg, source string) {
+		files[pos] = append(files[pos], checkstyleError{
+			Line:     line,
+			Column:   col,
+			Severity: severity,
+			Message:  msg,
+			Source:   source,
+		})
+	}
+	for _, c := range r.Changes {
+		add(c.Pos.Filename, c.Pos.Line, c.Pos.Column, "warning", fmt.Sprintf("import %q still uses the old version; it should be %q", c.Old, c.New), "govers.import")
+	}
+	severity := "error"
+	if *depCheck == "warn" {
+		severity = "warning"
+	}
+	for _, f := range r.Findings {
+		if f.Pos.IsValid() {
+			add(f.Pos.Filename, f.Pos.Line, f.Pos.Column, severity, fmt.Sprintf("dependency %q uses inconsistent path %q, not %q", f.Importer, f.ImportPath, f.Expected), "govers.dependency")
+		}
+	}
+	for _, m := range r.LockMismatches {
+		add(m.project.file, m.project.line, 0, "error", fmt.Sprintf("%s is pinned at %s, but %s imports %s", m.project.name, m.project.pinned(), m.importer, m.importPath), "govers.lock")
+	}
+	out := checkstyleReport{
+		Version: "4.3",
+	}
+	for name, errs := range files {
+		sort.SliceStable(errs, func(i, j int) bool {
+			return errs[i].Line < errs[j].Line
+		})
+		out.Files = append(out.Files, checkstyleFile{
+			Name:   name,
+			Errors: errs,
+		})
+	}
+	sort.Slice(out.Files, func(i, j int) bool {
+		return out.Files[i].Name < out.Files[j].Name
+	})
+	data, err := xml.MarshalIndent(out, "", "\t")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writeCheckstyleSummary writes the problems found in plan in
+// the Checkstyle XML format, as written by -report checkstyle.
+// The imports changed are included only when no changes are
+// being made, as otherwise they no longer need attention.
+func (ctxt *context) writeCheckstyleSummary(w io.Writer, plan *vers.Plan) error {
+	r := newReport(plan)
+	if !ctxt.checkOnly && !*noEdit {
+		r.Changes = nil
+	}
+	return writeCheckstyleReport(w, r)
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// command holds a govers subcommand.
+type command struct {
+	name  string
+	args  string
+	short string
+
+	// flags holds the names of the global flags
+	// that the command accepts.
+	flags []string
+
+	// extra, if non-nil, defines any flags
+	// specific to the command.
+	extra func(fs *flag.FlagSet)
+
+	// parseArgs, if non-nil, is used in place of
+	// parseRules to interpret the command's arguments.
+	parseArgs func(ctxt *context, args []string)
+
+	// optionalArgs holds whether the command
+	// may be run without any arguments.
+	optionalArgs bool
+
+	// verifies holds whether the command builds and tests
+	// its changes, undoing them if that fails, unless
+	// -verify=false is given.
+	verifies bool
+
+	run func(ctxt *context)
+}
+
+var commands []*command
+
+var (
+	checkFormat    string
+	checkAllMajors bool
+	graphAll       bool
+)
+
+func init() {
+	selectFlags := []string{"m", "M", "vers", "tags", "exclude"}
+	commands = []*command{{
+		name:  "rewrite",
+		args:  "new-package-path... [package...]",
+		short: "change import paths (the default when no subcommand is given)",
+		flags: []string{
+			"all-modules", "allow", "d", "debug-timing", "deep", "dep-check",
+			"depcheck-depth", "direct", "events", "exclude", "explain", "fail-fast",
+			"fetch", "fix", "generate", "hidden", "import-group", "isolate",
+			"keep-going", "m", "M", "mirror", "n", "net-deadline", "net-retries",
+			"net-timeout", "o", "parallel", "patch", "plan", "record", "rename",
+			"report", "require", "review", "rewriter", "roots", "scope",
+			"skip-generated", "strict", "t", "tags", "templates", "vanity",
+			"verify", "verify-sum", "vers", "vuln", "worktree", "x",
+		},
+		run: runRewrite,
+	}, {
+		name:  "check",
+		args:  "new-package-path... [package...]",
+		short: "check that no imports need changing, without changing anything",
+		flags: append([]string{
+			"all-modules", "allow", "d", "debug-timing", "dep-check",
+			"depcheck-depth", "direct", "events", "explain", "fail-fast", "fetch",
+			"hidden", "import-group", "mirror", "net-deadline", "net-retries",
+			"net-timeout", "parallel", "report", "rewriter", "roots", "scope",
+			"skip-generated", "strict", "t", "vanity", "x",
+		}, selectFlags...),
+		extra: func(fs *flag.FlagSet) {
+			fs.StringVar(&checkFormat, "format", "text", "output `format`: "+formatNames())
+			fs.StringVar(&checkBaseline, "baseline", "", "fail only on problems not recorded in `file`, recording them there if it does not exist")
+			fs.BoolVar(&checkAllMajors, "all-majors", false, "fail if any package family is imported under more than one major version anywhere in the import graph")
+		},
+		run: runCheck,
+	}, {
+		name:  "list",
+		args:  "new-package-path... [package...]",
+		short: "list the import paths that would be changed",
+		flags: append([]string{
+			"all-modules", "debug-timing", "fail-fast", "hidden", "import-group",
+			"mirror", "net-deadline", "net-retries", "net-timeout", "parallel",
+			"rewriter", "scope", "skip-generated", "strict", "vanity", "x",
+		}, selectFlags...),
+		run: runList,
+	}, {
+		name:  "graph",
+		args:  "new-package-path...",
+		short: "print the imports of packages in the matched family",
+		flags: append([]string{"all-modules", "debug-timing", "depcheck-depth", "direct", "fail-fast", "hidden", "mirror", "strict", "t", "x"}, selectFlags...),
+		extra: func(fs *flag.FlagSet) {
+			fs.BoolVar(&graphAll, "all", false, "print all imports, not just those of the matched family")
+		},
+		run: runGraph,
+	}, {
+		name:  "progress",
+		args:  "new-package-path... [package...]",
+		short: "report how far the tree has been migrated to the new paths",
+		flags: append([]string{"all-modules", "debug-timing", "fail-fast", "hidden", "mirror", "parallel", "scope", "strict", "x"}, selectFlags...),
+		run:   runProgress,
+	}, {
+		name:  "api",
+		args:  "new-package-path... [package...]",
+		short: "report uses of identifiers that the new packages do not define",
+		flags: append([]string{"all-modules", "debug-timing", "fail-fast", "fix", "hidden", "parallel", "rename", "rewriter", "scope", "strict", "x"}, selectFlags...),
+		run:   runAPI,
+	}, {
+		name:  "why",
+		args:  "new-package-path... [package...]",
+		short: "show the import chains that reach dependencies using inconsistent paths",
+		flags: []string{
+			"all-modules", "allow", "debug-timing", "depcheck-depth", "direct",
+			"exclude", "fail-fast", "fetch", "hidden", "m", "M", "mirror",
+			"net-deadline", "net-retries", "net-timeout", "rewriter", "roots", "t",
+			"tags", "vanity", "vers", "x",
+		},
+		run: runWhy,
+	}, {
+		name:      "match",
+		args:      "new-package-path... -- import-path...",
+		short:     "show whether import paths match and what they would be changed to",
+		flags:     []string{"m", "M", "mirror", "rewriter", "vers"},
+		parseArgs: (*context).parseMatch,
+		run:       runMatch,
+	}, {
+		name:  "bump",
+		args:  "package-family...",
+		short: "move each package family to its next major version",
+		flags: []string{
+			"all-modules", "allow", "d", "debug-timing", "deep", "dep-check",
+			"depcheck-depth", "direct", "events", "exclude", "explain", "fail-fast",
+			"fetch", "fix", "generate", "hidden", "import-group", "isolate",
+			"keep-going", "mirror", "n", "net-deadline", "net-retries",
+			"net-timeout", "o", "parallel", "patch", "plan", "record", "rename",
+			"report", "review", "roots", "scope", "skip-generated", "strict", "t",
+			"tags", "templates", "verify", "vers", "vuln", "worktree", "x",
+		},
+		extra: func(fs *flag.FlagSet) {
+			fs.BoolVar(&bumpLatest, "latest", false, "move to the latest major version published on the module proxy")
+		},
+		parseArgs: (*context).parseFamilies,
+		run:       runRewrite,
+	}, {
+		name:  "get",
+		args:  "module-path[@version]...",
+		short: "fetch each module, change the tree to use it, require it and tidy",
+		flags: []string{
+			"all-modules", "allow", "d", "debug-timing", "deep", "dep-check",
+			"depcheck-depth", "direct", "events", "exclude", "explain", "fail-fast",
+			"fix", "generate", "hidden", "import-group", "isolate", "keep-going",
+			"mirror", "n", "net-deadline", "net-retries", "net-timeout", "parallel",
+			"record", "rename", "report", "review", "roots", "scope",
+			"skip-generated", "strict", "t", "tags", "templates", "verify", "vers",
+			"vuln", "x",
+		},
+		parseArgs: (*context).parseGet,
+		run:       runGet,
+	}, {
+		name:  "pin",
+		args:  "module-path@version...",
+		short: "set the go.mod requirement on each module across the tree",
+		flags: []string{
+			"exclude", "hidden", "n", "net-deadline", "net-retries", "net-timeout",
+			"record", "tags", "verify-sum", "vers",
+		},
+		parseArgs: (*context).parsePins,
+		run:       runPin,
+	}, {
+		name:      "move",
+		args:      "old-import-path new-import-path",
+		short:     "move a package to a new directory within its module, changing its importers",
+		flags:     []string{"all-modules", "debug-timing", "exclude", "hidden", "n", "parallel", "tags", "x"},
+		parseArgs: (*context).parseMove,
+		run:       runMove,
+	}, {
+		name:  "release",
+		args:  "vN",
+		short: "move the module in the current directory to a new major version",
+		flags: []string{"debug-timing", "events", "fail-fast", "hidden", "keep-going", "n", "parallel", "skip-generated", "strict", "tags", "templates", "x"},
+		extra: func(fs *flag.FlagSet) {
+			fs.BoolVar(&releaseSubdir, "subdir", false, "copy the module to the vN subdirectory and change the copy, leaving the original alone")
+		},
+		parseArgs: (*context).parseRelease,
+		run:       runRelease,
+	}, {
+		name:  "align",
+		args:  "[module-path...]",
+		short: "report modules that the go.mod files in the tree require at different versions",
+		flags: []string{"hidden", "n"},
+		extra: func(fs *flag.FlagSet) {
+			fs.BoolVar(&alignWrite, "w", false, "change the go.mod files to require the highest of the versions")
+		},
+		parseArgs:    (*context).parseAlign,
+		optionalArgs: true,
+		run:          runAlign,
+	}, {
+		name:  "outdated",
+		args:  "[family...]",
+		short: "report package families with a later major version published",
+		flags: []string{
+			"debug-timing", "exclude", "hidden", "net-deadline", "net-retries",
+			"net-timeout", "tags", "x",
+		},
+		parseArgs:    (*context).parseOutdated,
+		optionalArgs: true,
+		run:          runOutdated,
+	}, {
+		name:  "incompatible",
+		args:  "[module-path...]",
+		short: "move modules required at +incompatible versions to their /vN modules",
+		flags: []string{
+			"all-modules", "allow", "d", "debug-timing", "deep", "dep-check",
+			"depcheck-depth", "direct", "events", "exclude", "explain", "fail-fast",
+			"fetch", "fix", "generate", "hidden", "import-group", "isolate",
+			"keep-going", "mirror", "n", "net-deadline", "net-retries",
+			"net-timeout", "parallel", "record", "rename", "report", "review",
+			"roots", "scope", "skip-generated", "strict", "t", "tags", "templates",
+			"verify", "verify-sum", "vers", "vuln", "x",
+		},
+		parseArgs:    (*context).parseIncompatible,
+		optionalArgs: true,
+		run:          runRewrite,
+	}, {
+		name:  "migrate",
+		args:  "preset...",
+		short: "make well-known migrations, undoing them if the result fails to build or test",
+		flags: []string{
+			"all-modules", "allow", "d", "debug-timing", "deep", "dep-check",
+			"depcheck-depth", "direct", "events", "exclude", "explain", "fail-fast",
+			"fetch", "fix", "generate", "hidden", "import-group", "isolate",
+			"keep-going", "mirror", "n", "net-deadline", "net-retries",
+			"net-timeout", "o", "parallel", "patch", "plan", "record", "rename",
+			"report", "review", "roots", "scope", "skip-generated", "strict", "t",
+			"tags", "templates", "verify", "verify-sum", "vers", "vuln", "worktree",
+			"x",
+		},
+		extra: func(fs *flag.FlagSet) {
+			fs.BoolVar(&listPresets, "list", false, "list the available presets")
+			fs.StringVar(&presetsFile, "presets", "", "read more presets from `file`")
+		},
+		parseArgs:    (*context).parsePresets,
+		optionalArgs: true,
+		verifies:     true,
+		run:          runRewrite,
+	}, {
+		name:  "patch",
+		args:  "-o dir module-path@version new-package-path...",
+		short: "change import paths in a copy of a module downloaded to dir",
+		flags: []string{
+			"allow", "d", "debug-timing", "deep", "dep-check", "depcheck-depth",
+			"direct", "events", "explain", "fail-fast", "fix", "import-group",
+			"keep-going", "m", "M", "n", "net-deadline", "net-retries",
+			"net-timeout", "parallel", "rename", "report", "require", "rewriter",
+			"scope", "skip-generated", "strict", "t", "tags", "templates", "vers",
+			"vuln", "x",
+		},
+		extra: func(fs *flag.FlagSet) {
+			fs.StringVar(&patchDir, "o", "", "extract the module to `dir`, which must be empty or not exist, and change it there")
+		},
+		parseArgs: (*context).parseModulePatch,
+		run:       runModulePatch,
+	}, {
+		name:      "replay",
+		args:      "recipe-file",
+		short:     "apply the operations recorded in a recipe by -record",
+		flags:     []string{"n"},
+		parseArgs: (*context).parseRecipe,
+		run:       runReplay,
+	}, {
+		name:  "help",
+		args:  "[subcommand]",
+		short: "print help for govers or one of its subcommands",
+	}}
+}
+
+// lookupCommand returns the subcommand with the given name,
+// or nil if there is none.
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagSet returns a flag set holding the flags accepted by
+// cmd. The global flags are shared with flag.CommandLine, so
+// their values can be used whichever flag set was parsed.
+func (cmd *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("govers "+cmd.name, flag.ExitOnError)
+	for _, name := range cmd.flags {
+		f := flag.Lookup(name)
+		fs.Var(f.Value, f.Name, f.Usage)
+	}
+	if cmd.extra != nil {
+		cmd.extra(fs)
+	}
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		cmd.usage(fs)
+		os.Exit(2)
+	}
+	return fs
+}
+
+func (cmd *command) usage(fs *flag.FlagSet) {
+	fmt.Printf("usage: govers %s [flags] %s\n\n", cmd.name, cmd.args)
+	fmt.Printf("govers %s: %s\n", cmd.name, cmd.short)
+	if len(cmd.flags) > 0 || cmd.extra != nil {
+		fmt.Printf("\nFlags:\n")
+		fs.PrintDefaults()
+	}
+}
+
+// runHelp prints help for the named subcommand,
+// or for govers as a whole if none is given.
+func runHelp(args []string) {
+	if len(args) == 0 {
+		fmt.Printf("%s", help[1:])
+		return
+	}
+	cmd := lookupCommand(args[0])
+	if cmd == nil {
+		fatalf("unknown subcommand %q; run \"govers help\" for usage", args[0])
+	}
+	cmd.usage(cmd.flagSet())
+}
+
+// runCheck checks the tree without changing anything,
+// failing if any import would be changed or any
+// dependency uses an inconsistent path.
+func runCheck(ctxt *context) {
+	write := reportFormats[checkFormat]
+	if write == nil {
+		fatalf("unknown format %q (available formats: %s)", checkFormat, formatNames())
+	}
+	if *eventsFile == "-" && checkFormat != "text" {
+		fatalf("-events - cannot be used with -format %s, as both write to standard output", checkFormat)
+	}
+	ctxt.checkOnly = true
+	// Nothing is written, so the changes needed in modules
+	// with inconsistent dependencies are reported too; the
+	// findings decide the exit status.
+	rw := ctxt.newRewriter(vers.WithDryRun(true), vers.WithoutFailing(true))
+	plan, err := rw.Plan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.result = plan.Result
+	ctxt.filterPlan(plan)
+	r := newReport(plan)
+	r.LockMismatches = ctxt.checkLegacyLocks()
+	if checkAllMajors {
+		r.AllMajors = plan.Result.AllMajors()
+	}
+	if checkBaseline != "" {
+		ctxt.applyBaseline(plan, r)
+	}
+	if events != nil {
+		events.addChanges(r)
+	}
+	if checkFormat == "text" {
+		ctxt.reportFindings()
+		ctxt.reportOverrides()
+		ctxt.reportSkippedModules()
+		ctxt.reportStaleRequires()
+		ctxt.reportGenerated()
+	}
+	// With -events -, the changes are streamed
+	// as events in place of the text report.
+	if *eventsFile != "-" {
+		if err := write(os.Stdout, r); err != nil {
+			fatalf("cannot write report: %v", err)
+		}
+	}
+	ctxt.recordDiffs(rw, plan)
+	ctxt.writeReports(plan)
+	if checkFormat == "text" {
+		ctxt.printSummary(false)
+		if ctxt.result.Failed() {
+			ctxt.printRemediation()
+		}
+	}
+	if r.failed() {
+		ctxt.exit(1)
+	}
+}
+
+// runList prints each import path that would be
+// changed, without checking dependencies.
+func runList(ctxt *context) {
+	rw := ctxt.newRewriter(vers.WithoutDependencies(true), vers.WithDryRun(true))
+	plan, err := rw.Plan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.result = plan.Result
+	ctxt.filterPlan(plan)
+	for _, edit := range plan.Files {
+		for _, c := range edit.Changes {
+			fmt.Printf("%s: %s -> %s\n", c.Pos, c.Old, c.New)
+		}
+	}
+	ctxt.reportGenerated()
+}
+
+// runGraph prints the imports found while checking the
+// tree, one "importer imported" pair per line. Unless
+// -all is given, only imports of packages in the family
+// matched by the rules are printed.
+func runGraph(ctxt *context) {
+	rw := ctxt.newRewriter()
+	result, err := rw.Scan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.result = result
+	seen := make(map[vers.Import]bool)
+	var lines []string
+	for _, imp := range result.Imports {
+		if !graphAll && !ctxt.inFamily(imp.To) {
+			continue
+		}
+		key := vers.Import{From: imp.From, To: imp.To}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		lines = append(lines, imp.From+" "+imp.To)
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+// inFamily reports whether the package with the given
+// import path is one of those matched by the rules, either
+// before or after rewriting.
+func (ctxt *context) inFamily(p string) bool {
+	if r, _ := ctxt.rules.Find(p); r != nil {
+		return true
+	}
+	for _, r := range ctxt.rules {
+		if p == r.NewPackage || strings.HasPrefix(p, r.NewPackage+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// configFile holds the name of the project configuration file.
+const configFile = ".govers.yaml"
+
+// config holds the contents of a project configuration file.
+type config struct {
+	// path holds the path to the configuration file.
+	path string
+
+	// flags holds the values for each flag, keyed by flag name.
+	flags map[string][]string
+
+	// rewrites holds the default new-package-path arguments.
+	rewrites []string
+
+	// disable holds whether rewriting is disabled
+	// in the file's directory.
+	disable bool
+}
+
+// findConfig looks for a configuration file in dir and each
+// of its parents up to the root of the repository. It returns
+// a nil config if none was found.
+func findConfig(dir string) (*config, error) {
+	for d := dir; ; {
+		path := filepath.Join(d, configFile)
+		if _, err := os.Stat(path); err == nil {
+			return readConfig(path)
+		}
+		if isRepoRoot(d) {
+			return nil, nil
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return nil, nil
+		}
+		d = parent
+	}
+}
+
+// isRepoRoot reports whether dir is the root of a repository.
+func isRepoRoot(dir string) bool {
+	for _, vcs := range vcsDirs {
+		if _, err := os.Stat(filepath.Join(dir, vcs)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// readConfig reads the configuration file at the given
+// path. The file is written in a small subset of YAML:
+// each entry is either a "key: value" line or a "key:" line
+// followed by a list of values each written as "- value".
+// Values may be quoted, and lines starting with '#' are ignored.
+//
+// Each key names a flag, apart from "rewrites", which holds
+// the new-package-path arguments used when none are given
+// on the command line, and "disable", which, when true,
+// disables rewriting in the file's directory (see
+// findOverrides).
+func readConfig(path string) (*config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg := &config{
+		path:  path,
+		flags: make(map[string][]string),
+	}
+	key := ""
+	scan := bufio.NewScanner(f)
+	for lineNum := 1; scan.Scan(); lineNum++ {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		errorf := func(f string, a ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", path, lineNum, fmt.Sprintf(f, a...))
+		}
+		if strings.HasPrefix(line, "- ") || line == "-" {
+			if key == "" {
+				return nil, errorf("list item without key")
+			}
+			if key == "disable" {
+				return nil, errorf("disable cannot have more than one value")
+			}
+			val, err := configValue(strings.TrimPrefix(line, "-"))
+			if err != nil {
+				return nil, errorf("%v", err)
+			}
+			cfg.add(key, val)
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, errorf("expected key: value")
+		}
+		key = strings.TrimSpace(line[0:i])
+		if key != "rewrites" && key != "disable" && commandFlags.Lookup(key) == nil {
+			return nil, errorf("unknown key %q", key)
+		}
+		rest := strings.TrimSpace(line[i+1:])
+		if rest == "" {
+			// A list of values follows.
+			continue
+		}
+		val, err := configValue(rest)
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+		if key == "disable" {
+			if cfg.disable, err = strconv.ParseBool(val); err != nil {
+				return nil, errorf("invalid value %q for disable", val)
+			}
+			key = ""
+			continue
+		}
+		cfg.add(key, val)
+		key = ""
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *config) add(key, val string) {
+	if key == "rewrites" {
+		cfg.rewrites = append(cfg.rewrites, val)
+	} else {
+		cfg.flags[key] = append(cfg.flags[key], val)
+	}
+}
+
+// configValue returns the value of the given
+// configuration entry, removing any quotes
+// and trailing comment.
+func configValue(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := strings.LastIndex(s, `"`)
+		if end <= 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return strconv.Unquote(s[0 : end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.LastIndex(s, "'")
+		if end <= 0 {
+			return "", fmt.Errorf("unterminated quoted value")
+		}
+		return strings.Replace(s[1:end], "''", "'", -1), nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[0:i])
+	}
+	return s, nil
+}
+
+// apply sets each flag in fs that was not explicitly
+// set on the command line to its configured value.
+// Flags that fs does not define are ignored, so that
+// a subcommand is unaffected by entries for flags that
+// it does not accept.
+func (cfg *config) apply(fs *flag.FlagSet) error {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	for name, vals := range cfg.flags {
+		f := fs.Lookup(name)
+		if f == nil || set[name] {
+			continue
+		}
+		if _, ok := f.Value.(*stringsValue); !ok && len(vals) > 1 {
+			return fmt.Errorf("%s: flag %q cannot have more than one value", cfg.path, name)
+		}
+		for _, val := range vals {
+			if err := fs.Set(name, val); err != nil {
+				return fmt.Errorf("%s: invalid value %q for flag %q: %v", cfg.path, val, name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// envFlags returns the flags held in the GOVERSFLAGS
+// environment variable, a space-separated list of flags
+// that are treated as if they were given before those
+// on the command line. As with GOFLAGS, flags that fs
+// does not define are ignored.
+func envFlags(fs *flag.FlagSet) []string {
+	var flags []string
+	for _, f := range strings.Fields(os.Getenv("GOVERSFLAGS")) {
+		if !strings.HasPrefix(f, "-") {
+			fatalf("GOVERSFLAGS entry %q is not a flag", f)
+		}
+		name := strings.TrimLeft(f, "-")
+		if i := strings.Index(name, "="); i >= 0 {
+			name = name[0:i]
+		}
+		if fs.Lookup(name) != nil {
+			flags = append(flags, f)
+		}
+	}
+	return flags
+}
+
+// stringsValue implements flag.Value for a
+// flag that may be given more than once.
+type stringsValue []string
+
+func (v *stringsValue) String() string {
+	return strings.Join(*v, ",")
+}
+
+func (v *stringsValue) Set(s string) error {
+	*v = append(*v, s)
+	return nil
+}
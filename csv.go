@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// writeCSVReport writes r as comma-separated values, as printed
+// by -format csv, for tracking a migration in a spreadsheet. After
+// a header row, there is a row for each import that would be
+// changed and each inconsistent import found in a dependency,
+// giving the importing package, the file (when known), the old
+// and target import paths, and the status of the import.
+func writeCSVReport(w io.Writer, r *report) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"package", "file", "old import", "target import", "status"})
+	for _, c := range r.Changes {
+		importer := ""
+		if p := r.importers[c]; p != nil {
+			importer = p.ImportPath
+		}
+		cw.Write([]string{importer, c.Pos.Filename, c.Old, c.New, r.changeStatus})
+	}
+	status := "inconsistent dependency"
+	if *depCheck == "warn" {
+		status = "inconsistent dependency (warning)"
+	}
+	for _, f := range r.Findings {
+		cw.Write([]string{f.Importer, f.Pos.Filename, f.ImportPath, f.Expected, status})
+	}
+	for _, f := range r.Waived {
+		cw.Write([]string{f.Importer, f.Pos.Filename, f.ImportPath, f.Expected, "waived by -allow"})
+	}
+	for _, m := range r.MixedMajors {
+		cw.Write([]string{m.Importer, "", strings.Join(m.Paths, " "), "", "mixed major versions"})
+	}
+	for _, m := range r.AllMajors {
+		cw.Write([]string{"", "", strings.Join(m.Majors, " "), "", "more than one major version in the import graph"})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeCSVSummary writes the changes in plan as comma-separated
+// values, as written by -report csv, giving the status of each
+// changed import as changed, or would change with -n.
+func (ctxt *context) writeCSVSummary(w io.Writer, plan *vers.Plan) error {
+	r := newReport(plan)
+	switch {
+	case ctxt.checkOnly:
+	case *noEdit:
+		r.changeStatus = "would change"
+	default:
+		r.changeStatus = "changed"
+	}
+	return writeCSVReport(w, r)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var eventsFile = flag.String("events", "", "stream newline-delimited JSON events to `file` as they happen, or to standard output if it is -")
+
+// events holds the stream opened for -events, if any.
+var events *eventStream
+
+// eventStream writes the events of a run as newline-delimited
+// JSON, each written as soon as it happens, counting them for
+// the summary event that ends the stream.
+type eventStream struct {
+	mu       sync.Mutex
+	file     *os.File
+	enc      *json.Encoder
+	packages int
+	files    int
+	failures int
+}
+
+// jsonEvent holds the form of an event written by -events.
+// Event holds its kind: package-scanned, check-failure,
+// file-modified or summary.
+type jsonEvent struct {
+	Event      string
+	Time       time.Time
+	Package    string `json:",omitempty"`
+	File       string `json:",omitempty"`
+	Pos        string `json:",omitempty"`
+	ImportPath string `json:",omitempty"`
+	Expected   string `json:",omitempty"`
+	Error      string `json:",omitempty"`
+	*jsonEventSummary
+}
+
+// jsonEventSummary holds the counts given by the summary event,
+// with the status that govers exits with.
+type jsonEventSummary struct {
+	Packages int
+	Files    int
+	Failures int
+	Status   int
+}
+
+// openEvents opens the stream named by -events, if any.
+func openEvents() {
+	switch *eventsFile {
+	case "":
+		return
+	case "-":
+		events = &eventStream{file: os.Stdout}
+	default:
+		f, err := os.Create(*eventsFile)
+		if err != nil {
+			fatalf("cannot create events file: %v", err)
+		}
+		events = &eventStream{file: f}
+	}
+	events.enc = json.NewEncoder(events.file)
+}
+
+// eventsFunc returns the function to stream each event
+// reported by the Rewriter, or nil if -events was not given.
+func eventsFunc() func(ev *vers.Event) {
+	if events == nil {
+		return nil
+	}
+	return events.add
+}
+
+// add writes the event reported by the Rewriter.
+func (s *eventStream) add(ev *vers.Event) {
+	e := &jsonEvent{}
+	switch ev.Kind {
+	case vers.PackageEvent:
+		e.Event, e.Package = "package-scanned", ev.Package.ImportPath
+		s.count(&s.packages)
+	case vers.FileEvent:
+		e.Event, e.Package, e.File = "file-modified", ev.Package.ImportPath, ev.Path
+		s.count(&s.files)
+	case vers.FindingEvent:
+		f := ev.Finding
+		e.Event, e.Package, e.ImportPath, e.Expected = "check-failure", f.Importer, f.ImportPath, f.Expected
+		if f.Pos.IsValid() {
+			e.Pos = f.Pos.String()
+		}
+		e.Error = "dependency uses inconsistent path"
+		s.count(&s.failures)
+	case vers.ProblemEvent:
+		e.Event, e.File, e.Error = "check-failure", ev.Problem.Path, ev.Problem.Error()
+		s.count(&s.failures)
+	default:
+		return
+	}
+	s.write(e)
+}
+
+// addChanges writes a check-failure event for each import
+// in r that would be changed, as the check subcommand fails
+// because of them.
+func (s *eventStream) addChanges(r *report) {
+	for _, c := range r.Changes {
+		e := &jsonEvent{
+			Event:      "check-failure",
+			File:       c.Pos.Filename,
+			Pos:        c.Pos.String(),
+			ImportPath: c.Old,
+			Expected:   c.New,
+			Error:      "import would be changed",
+		}
+		if p := r.importers[c]; p != nil {
+			e.Package = p.ImportPath
+		}
+		s.count(&s.failures)
+		s.write(e)
+	}
+}
+
+func (s *eventStream) count(n *int) {
+	s.mu.Lock()
+	*n++
+	s.mu.Unlock()
+}
+
+// write writes e to the stream. Events that cannot
+// be written are dropped rather than stopping the run.
+func (s *eventStream) write(e *jsonEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.Time = time.Now()
+	s.enc.Encode(e)
+}
+
+// close ends the stream with a summary event holding the
+// given exit status and, if govers is failing because of it,
+// an error.
+func (s *eventStream) close(status int, err string) {
+	s.mu.Lock()
+	summary := &jsonEventSummary{
+		Packages: s.packages,
+		Files:    s.files,
+		Failures: s.failures,
+		Status:   status,
+	}
+	s.mu.Unlock()
+	s.write(&jsonEvent{
+		Event:            "summary",
+		Error:            err,
+		jsonEventSummary: summary,
+	})
+	if s.file != os.Stdout {
+		s.file.Close()
+	}
+}
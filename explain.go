@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// explain prints an explanation of why the
+// finding f was considered inconsistent.
+func (ctxt *context) explain(f *vers.Finding) {
+	if f.Pos.IsValid() {
+		fmt.Fprintf(os.Stderr, "\timported at: %s\n", f.Pos)
+	}
+	if f.Rule != nil {
+		fmt.Fprintf(os.Stderr, "\tpattern: %s (%s)\n", f.Rule.OldPackagePat, ruleOrigin(f.Rule))
+		fmt.Fprintf(os.Stderr, "\tmatched prefix: %s\n", f.Prefix)
+	} else {
+		fmt.Fprintf(os.Stderr, "\tmapped by: %s\n", *rewriterCmd)
+	}
+	fmt.Fprintf(os.Stderr, "\twould be changed to: %s\n", f.Expected)
+	fmt.Fprintf(os.Stderr, "\timport chain: %s\n", strings.Join(f.Chain, " -> "))
+}
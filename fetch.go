@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var fetch = flag.Bool("fetch", false, "download the modules being changed to into the module cache before checking")
+
+// modDownload holds the parts of the output of
+// "go mod download -json" that are used here.
+type modDownload struct {
+	Path    string
+	Version string
+	Error   string
+}
+
+// fetchModules downloads the module providing the new path of each
+// of ctxt.rules into the module cache with "go mod download", at
+// the version given by -require or the subcommand, or otherwise
+// its latest version, setting ctxt.fetched to the versions found,
+// so that the new paths can be resolved by the dependency check
+// even when they have never been used before. The download is
+// made outside the tree, which is left unchanged. As the module
+// path is not known, it is found by trying the path itself and
+// then each shorter prefix of it in turn.
+func (ctxt *context) fetchModules() {
+	versions := make(map[string]string)
+	for _, pn := range ctxt.pins {
+		versions[pn.path] = pn.version
+	}
+	ctxt.fetched = make(map[string]string)
+	done := make(map[string]bool)
+	for _, r := range ctxt.rules {
+		p := r.NewPackage
+		if r.Arg == "" || done[p] || strings.ContainsAny(p, "$\\") || isStandard(p) {
+			continue
+		}
+		done[p] = true
+		var errs []string
+		for mod := p; strings.Contains(mod, "/"); mod = mod[:strings.LastIndex(mod, "/")] {
+			version := versions[mod]
+			if version == "" {
+				version = "latest"
+			}
+			d, err := goModDownload(mod + "@" + version)
+			if err == nil {
+				logf("fetched %s %s", d.Path, d.Version)
+				ctxt.fetched[d.Path] = d.Version
+				errs = nil
+				break
+			}
+			errs = append(errs, err.Error())
+		}
+		if len(errs) > 0 {
+			logf("cannot fetch the module providing %s: %s", p, errs[0])
+		}
+	}
+}
+
+// goModDownload downloads the given module query, such as
+// gopkg.in/yaml.v3@latest, into the module cache. It is run
+// in a temporary directory, outside any module, so that no
+// go.mod or go.sum file is changed.
+func goModDownload(query string) (*modDownload, error) {
+	dir, err := os.MkdirTemp("", "govers-fetch")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	return goModDownloadIn(dir, query)
+}
+
+// goModDownloadIn runs "go mod download" for the given
+// module query in dir. Within a module, this also adds
+// the checksums of the module downloaded to its go.sum file.
+func goModDownloadIn(dir, query string) (*modDownload, error) {
+	cmd := exec.Command("go", "mod", "download", "-json", query)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=on", "GOWORK=off", "GOFLAGS=")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, runErr := cmd.Output()
+	d := new(modDownload)
+	if err := json.Unmarshal(out, d); err != nil {
+		if runErr != nil {
+			return nil, fmt.Errorf("go mod download %s: %v: %s", query, runErr, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("go mod download %s: %v", query, err)
+	}
+	if d.Error != "" {
+		return nil, fmt.Errorf("%s", d.Error)
+	}
+	return d, nil
+}
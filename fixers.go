@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var fixerNames stringsValue
+
+func init() {
+	flag.Var(&fixerNames, "fix", "apply the code fixer with the given `name` to files whose imports are changed (may be repeated)")
+}
+
+// parseFixers sets ctxt.fixers from the -fix flags.
+func (ctxt *context) parseFixers() {
+	for _, name := range fixerNames {
+		f := vers.LookupFixer(name)
+		if f == nil {
+			var names []string
+			for _, f := range vers.Fixers() {
+				names = append(names, f.Name)
+			}
+			fatalf("unknown fixer %q; the fixers available are: %s", name, strings.Join(names, ", "))
+		}
+		ctxt.fixers = append(ctxt.fixers, f)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// reportGenerated reports the generated files that
+// have been left unchanged because of the -skip-generated
+// flag, and the go:generate directives that
+// are likely to have produced them.
+func (ctxt *context) reportGenerated() {
+	if len(ctxt.generated) == 0 {
+		return
+	}
+	sort.Strings(ctxt.generated)
+	dirs := make(map[string]bool)
+	for _, file := range ctxt.generated {
+		logf("not changing generated file %s", file)
+		dirs[filepath.Dir(file)] = true
+	}
+	var files []string
+	for _, p := range ctxt.result.Packages {
+		if dirs[p.Dir] {
+			files = append(files, p.GoFiles...)
+		}
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		for _, d := range goGenerateDirectives(file) {
+			logf("%s: generator may need changing: %s", file, d)
+		}
+	}
+}
+
+// goGenerateDirectives returns all the go:generate
+// directives found in the given file.
+func goGenerateDirectives(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var directives []string
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		if line := scan.Text(); strings.HasPrefix(line, "//go:generate ") {
+			directives = append(directives, line)
+		}
+	}
+	return directives
+}
+
+// runGenerate runs "go generate" in the directory of each
+// package that was changed and contains go:generate directives,
+// so that generated code can pick up the new import paths.
+// It reports whether all the generators succeeded.
+func (ctxt *context) runGenerate(pkgs []*vers.Package) bool {
+	ok := true
+	for _, p := range pkgs {
+		hasDirectives := false
+		for _, file := range p.GoFiles {
+			if len(goGenerateDirectives(file)) > 0 {
+				hasDirectives = true
+				break
+			}
+		}
+		if !hasDirectives {
+			continue
+		}
+		cmd := exec.Command("go", "generate", ".")
+		cmd.Dir = p.Dir
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			logf("go generate failed in %s: %v", p.Dir, err)
+			ok = false
+		}
+	}
+	return ok
+}
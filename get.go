@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// parseGet parses the arguments to the get subcommand, each a
+// module path with an optional version, as in gopkg.in/yaml.v3@v3.0.1,
+// downloading each module into the module cache at that version, or
+// at its latest version if none is given, and setting ctxt.rules and
+// ctxt.pins to move the tree to it.
+func (ctxt *context) parseGet(args []string) {
+	if len(args) == 0 {
+		fatalf("no module path given")
+	}
+	ctxt.fetched = make(map[string]string)
+	for _, arg := range args {
+		path, version := arg, "latest"
+		if i := strings.LastIndex(arg, "@"); i >= 0 {
+			path, version = arg[:i], arg[i+1:]
+		}
+		if path == "" || version == "" {
+			fatalf("invalid argument %q; want module-path[@version]", arg)
+		}
+		d, err := goModDownload(path + "@" + version)
+		if err != nil {
+			fatalf("cannot fetch %s: %v", arg, err)
+		}
+		if d.Path != path {
+			fatalf("%s is not a module path; its module is %s", path, d.Path)
+		}
+		logf("fetched %s %s", d.Path, d.Version)
+		ctxt.fetched[d.Path] = d.Version
+		r, err := getRule(path)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		ctxt.rules = append(ctxt.rules, r)
+		ctxt.pins = append(ctxt.pins, newPin(path, d.Version, r))
+	}
+	ctxt.addIncompatibleRules()
+}
+
+// getRule returns the rule that changes the imports of the
+// family of the module with the given path to use it. Unlike
+// the rule made from a new-package-path, it also matches the
+// family's paths without a version element, which are at major
+// version 1, when the module's path has a /vN suffix, as in
+// github.com/owner/repo/v2.
+func getRule(path string) (*vers.Rule, error) {
+	m := majorSuffixPat.FindString(path)
+	if m == "" || m[0] != '/' {
+		return vers.ParseRule(path, "", *versFlag)
+	}
+	return familyRule(strings.TrimSuffix(path, m), path)
+}
+
+// runGet changes the tree to use the modules fetched by parseGet,
+// as the rewrite subcommand does, requiring them in each changed
+// module's go.mod file, and then runs "go mod tidy" in each of
+// those modules, finishing with a report of what was done.
+func runGet(ctxt *context) {
+	runRewrite(ctxt)
+	tidyFailed := false
+	for _, mod := range ctxt.result.Modules {
+		if mod.Path == "" || mod.Failed || ctxt.changed[mod] == 0 {
+			continue
+		}
+		status := "tidied"
+		if *noEdit {
+			status = "would run go mod tidy"
+		} else if err := goModTidy(mod.Dir); err != nil {
+			logf("module %s: %v", mod.Name(), err)
+			status = "go mod tidy failed"
+			tidyFailed = true
+		}
+		logf("module %s: %s changed; %s", mod.Name(), packageCount(ctxt.changed[mod]), status)
+	}
+	for _, pn := range ctxt.pins {
+		logf("got %s %s", pn.path, pn.version)
+	}
+	if tidyFailed {
+		ctxt.exit(1)
+	}
+}
+
+// goModTidy runs "go mod tidy" in the module in dir.
+func goModTidy(dir string) error {
+	cmd := exec.Command("go", "mod", "tidy")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go mod tidy: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
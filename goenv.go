@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// goEnvVars holds the go command's settings
+// that affect how imports are resolved.
+var goEnvVars = []string{
+	"GOOS",
+	"GOARCH",
+	"GOPATH",
+	"GOROOT",
+	"CGO_ENABLED",
+	"GOFLAGS",
+	"GO111MODULE",
+	"GOMODCACHE",
+	"GOPROXY",
+	"GOPRIVATE",
+	"GONOPROXY",
+	"GONOSUMDB",
+	"GOSUMDB",
+}
+
+// readGoEnv returns the values of goEnvVars as reported by
+// "go env", which takes into account the go environment
+// configuration file (see GOENV) as well as the process
+// environment. It returns a nil map if the go command
+// cannot be found.
+func readGoEnv() (map[string]string, error) {
+	out, err := exec.Command("go", append([]string{"env", "-json"}, goEnvVars...)...).Output()
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		if err, ok := err.(*exec.ExitError); ok && len(err.Stderr) > 0 {
+			return nil, errors.New(strings.TrimSpace(string(err.Stderr)))
+		}
+		return nil, err
+	}
+	env := make(map[string]string)
+	if err := json.Unmarshal(out, &env); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// applyGoEnv configures buildCtxt from the go environment
+// so that imports are resolved as they would be by the go
+// command. Build tags in GOFLAGS are used unless tags were
+// given with the -tags flag, and settings that go/build, the
+// vers package and the module proxy queries read from the
+// process environment are exported so that they see the same
+// values.
+func applyGoEnv(buildCtxt *build.Context, env map[string]string) {
+	if v := env["GOOS"]; v != "" {
+		buildCtxt.GOOS = v
+	}
+	if v := env["GOARCH"]; v != "" {
+		buildCtxt.GOARCH = v
+	}
+	if v := env["GOPATH"]; v != "" {
+		buildCtxt.GOPATH = v
+	}
+	if v := env["GOROOT"]; v != "" {
+		buildCtxt.GOROOT = v
+	}
+	if v, ok := env["CGO_ENABLED"]; ok {
+		buildCtxt.CgoEnabled = v == "1"
+	}
+	if *buildTags == "" {
+		if tags, ok := goFlagValue(env["GOFLAGS"], "tags"); ok {
+			buildCtxt.BuildTags = splitTags(tags)
+		}
+	}
+	for _, name := range []string{"GO111MODULE", "GOMODCACHE", "GOPROXY", "GOPRIVATE", "GONOPROXY", "GONOSUMDB", "GOSUMDB"} {
+		if v := env[name]; v != "" && os.Getenv(name) == "" {
+			os.Setenv(name, v)
+		}
+	}
+}
+
+// goFlagValue returns the value of the named flag
+// within the given GOFLAGS setting, in which each
+// flag is given as -flag=value.
+func goFlagValue(goflags, name string) (string, bool) {
+	val, found := "", false
+	for _, f := range strings.Fields(goflags) {
+		f = strings.TrimPrefix(strings.TrimPrefix(f, "-"), "-")
+		if strings.HasPrefix(f, name+"=") {
+			val, found = f[len(name)+1:], true
+		}
+	}
+	return val, found
+}
+
+// splitTags splits a list of build tags
+// separated by commas or spaces.
+func splitTags(tags string) []string {
+	return strings.FieldsFunc(tags, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
+
+// packagesDriver returns the go/packages driver program to use,
+// found as go/packages would find it: it is named by
+// GOPACKAGESDRIVER, or is gopackagesdriver on the PATH when
+// that is unset. A value of "off" disables the driver.
+func packagesDriver() string {
+	driver := os.Getenv("GOPACKAGESDRIVER")
+	switch driver {
+	case "off":
+		return ""
+	case "":
+		path, err := exec.LookPath("gopackagesdriver")
+		if err != nil {
+			return ""
+		}
+		return path
+	}
+	return driver
+}
+
+// cacheDir returns the directory in which govers keeps its
+// cache, named by GOVERSCACHE or within the user's cache
+// directory when that is unset. A value of "off" disables
+// the cache.
+func cacheDir() string {
+	dir := os.Getenv("GOVERSCACHE")
+	switch dir {
+	case "off":
+		return ""
+	case "":
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		return filepath.Join(userDir, "govers")
+	}
+	return dir
+}
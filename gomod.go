@@ -0,0 +1,210 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// requireLine holds a requirement found in a go.mod file.
+type requireLine struct {
+	// index holds the index of the line within the file.
+	index int
+
+	// block holds whether the requirement is
+	// within a require ( ... ) block.
+	block bool
+
+	path, version string
+
+	// comment holds any trailing comment,
+	// including its leading "//".
+	comment string
+}
+
+// goMod holds the lines of a go.mod file.
+type goMod struct {
+	lines []string
+}
+
+func parseGoMod(data []byte) *goMod {
+	return &goMod{
+		lines: strings.Split(string(data), "\n"),
+	}
+}
+
+func (m *goMod) bytes() []byte {
+	return []byte(strings.Join(m.lines, "\n"))
+}
+
+// requires returns all the requirements in the file.
+func (m *goMod) requires() []requireLine {
+	var reqs []requireLine
+	inBlock := false
+	for i, line := range m.lines {
+		text, comment := line, ""
+		if j := strings.Index(text, "//"); j >= 0 {
+			text, comment = text[0:j], strings.TrimSpace(text[j:])
+		}
+		fields := strings.Fields(text)
+		switch {
+		case inBlock && len(fields) == 1 && fields[0] == ")":
+			inBlock = false
+			continue
+		case len(fields) == 2 && fields[0] == "require" && fields[1] == "(":
+			inBlock = true
+			continue
+		case inBlock && len(fields) == 2:
+		case !inBlock && len(fields) == 3 && fields[0] == "require":
+			fields = fields[1:]
+		default:
+			continue
+		}
+		reqs = append(reqs, requireLine{
+			index:   i,
+			block:   inBlock,
+			path:    unquoteModPath(fields[0]),
+			version: fields[1],
+			comment: comment,
+		})
+	}
+	return reqs
+}
+
+// setRequire replaces the requirement r with one on
+// the given module path and version.
+func (m *goMod) setRequire(r requireLine, path, version string) {
+	line := path + " " + version
+	if r.block {
+		indent := m.lines[r.index][0 : len(m.lines[r.index])-len(strings.TrimLeft(m.lines[r.index], " \t"))]
+		line = indent + line
+	} else {
+		line = "require " + line
+	}
+	if r.comment != "" {
+		line += " " + r.comment
+	}
+	m.lines[r.index] = line
+}
+
+// removeLines removes the lines with the given indexes,
+// which must be in increasing order.
+func (m *goMod) removeLines(indexes []int) {
+	for i := len(indexes) - 1; i >= 0; i-- {
+		j := indexes[i]
+		m.lines = append(m.lines[0:j], m.lines[j+1:]...)
+	}
+}
+
+// addRequire adds a requirement on the given
+// module path and version to the end of the file.
+func (m *goMod) addRequire(path, version string) {
+	n := len(m.lines)
+	if n > 0 && m.lines[n-1] == "" {
+		m.lines = append(m.lines[0:n-1], "require "+path+" "+version, "")
+		return
+	}
+	m.lines = append(m.lines, "require "+path+" "+version)
+}
+
+// module returns the module path declared by the
+// file, or "" if there is none.
+func (m *goMod) module() string {
+	if i := m.moduleLine(); i >= 0 {
+		return unquoteModPath(strings.Fields(m.lines[i])[1])
+	}
+	return ""
+}
+
+// setModule changes the module path declared
+// by the file to the given path.
+func (m *goMod) setModule(path string) {
+	i := m.moduleLine()
+	if i < 0 {
+		return
+	}
+	line := "module " + path
+	if j := strings.Index(m.lines[i], "//"); j >= 0 {
+		line += " " + m.lines[i][j:]
+	}
+	m.lines[i] = line
+}
+
+// moduleLine returns the index of the module
+// directive, or -1 if there is none.
+func (m *goMod) moduleLine() int {
+	for i, line := range m.lines {
+		if j := strings.Index(line, "//"); j >= 0 {
+			line = line[0:j]
+		}
+		if f := strings.Fields(line); len(f) == 2 && f[0] == "module" {
+			return i
+		}
+	}
+	return -1
+}
+
+// dirReplaced reports whether the file replaces the module
+// with the given path, at any version, with a directory,
+// which needs no go.sum entries.
+func (m *goMod) dirReplaced(modPath string) bool {
+	dir, ok := m.replacement(modPath)
+	return ok && (strings.HasPrefix(dir, "./") || strings.HasPrefix(dir, "../") || filepath.IsAbs(dir))
+}
+
+// replacement returns the module path or directory that
+// the file replaces the module with the given path with,
+// at any version, reporting whether it replaces it.
+func (m *goMod) replacement(modPath string) (string, bool) {
+	inBlock := false
+	for _, line := range m.lines {
+		if j := strings.Index(line, "//"); j >= 0 {
+			line = line[0:j]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case inBlock && len(fields) == 1 && fields[0] == ")":
+			inBlock = false
+			continue
+		case len(fields) == 2 && fields[0] == "replace" && fields[1] == "(":
+			inBlock = true
+			continue
+		case inBlock:
+		case len(fields) > 0 && fields[0] == "replace":
+			fields = fields[1:]
+		default:
+			continue
+		}
+		for i, f := range fields {
+			if f == "=>" && i > 0 && i+1 < len(fields) && unquoteModPath(fields[0]) == modPath {
+				return unquoteModPath(fields[i+1]), true
+			}
+		}
+	}
+	return "", false
+}
+
+// moveReplaceDirs prefixes each relative directory that a
+// replace directive names with dir, for a copy of the file
+// in another directory.
+func (m *goMod) moveReplaceDirs(dir string) {
+	for i, line := range m.lines {
+		j := strings.Index(line, "=>")
+		if j < 0 {
+			continue
+		}
+		f := strings.Fields(line[j+2:])
+		if len(f) == 0 || !strings.HasPrefix(f[0], "./") && !strings.HasPrefix(f[0], "../") {
+			continue
+		}
+		k := j + 2 + strings.Index(line[j+2:], f[0])
+		m.lines[i] = line[:k] + path.Join(dir, f[0]) + line[k+len(f[0]):]
+	}
+}
+
+func unquoteModPath(p string) string {
+	if len(p) >= 2 && (p[0] == '"' || p[0] == '`') && p[len(p)-1] == p[0] {
+		return p[1 : len(p)-1]
+	}
+	return p
+}
@@ -7,26 +7,884 @@ It prints the names of any packages that are modified.
 
 Usage:
 
-	govers [-d] [-m regexp] [-n] new-package-path
+	govers [subcommand] [flags] new-package-path... [package...]
 
 It accepts the following flags:
 
+	-allow prefix
+		Don't fail because of inconsistent paths used by
+		dependencies whose import paths have the given
+		prefix, such as compatibility shims that deliberately
+		use an old version. Such inconsistencies are reported
+		as waived instead. This flag may be repeated.
+	-all-modules
+		Check and change the modules nested within the
+		tree (directories below the current directory
+		that contain a go.mod file) as well as the one
+		containing the current directory.
 	-d
 		Suppress dependency checking
+	-debug-timing
+		Print the time taken by each phase of the work:
+		walking the tree, checking packages and their
+		dependencies, parsing the files to change and
+		writing them.
+	-deep
+		Rather than failing when a dependency uses an
+		inconsistent path, rewrite the dependency too if
+		its source can be written (for example under
+		GOPATH/src or in a vendor directory). Each
+		external package edited is reported.
+	-dep-check error|warn
+		With warn, report dependencies that use inconsistent
+		paths as warnings, but make the changes anyway and
+		don't fail because of them, so that a migration can
+		be landed while the stragglers are tracked. The
+		default is error.
+	-depcheck-depth n
+		Follow imports only n levels deep from the packages
+		in the tree when checking dependencies, which is
+		faster and quieter on large dependency graphs, at
+		the cost of missing inconsistencies deeper down.
+		With 1, only the direct dependencies are checked.
+		The default, 0, follows all imports.
+	-direct
+		Check only the direct dependencies of the packages
+		in the tree; shorthand for -depcheck-depth 1.
+	-events file
+		Stream events to file (standard output if it is -)
+		as they happen, one JSON object per line, for tools
+		following a long run: package-scanned as each package
+		in the tree is checked, check-failure for each
+		inconsistent dependency, each problem and, with the
+		check subcommand, each import that would be changed,
+		file-modified as each file is changed, and finally
+		summary, with the counts of each and the exit status.
+		With -, the events take the place of the list of
+		changed packages and of check's text report, and
+		-plan, check's other formats and a -report printed
+		to standard output are not allowed.
+	-exclude pattern
+		Don't change packages in directories matching
+		the pattern, or any directories below them. A pattern
+		containing a slash is matched against the directory's
+		path relative to the current directory; otherwise
+		it is matched against the directory's name. This
+		flag may be repeated.
+	-explain
+		For each inconsistent path found, explain why it was
+		considered inconsistent: the pattern that matched it,
+		the matched prefix, what it would be changed to, and
+		the chain of imports that led to the offending package.
+	-fail-fast
+		Stop at the first directory, file or package that
+		cannot be read, parsed or imported, or file that
+		cannot be changed, rather than skipping it and
+		carrying on.
+	-fetch
+		Before checking, download the module providing each
+		new path into the module cache with "go mod download",
+		at the version given by -require or otherwise its
+		latest version, so that the new packages can be
+		resolved, and their imports checked, even if the new
+		version has never been used on this machine. The download is
+		made outside the tree, so go.mod and go.sum are left
+		as they are; only the check uses the version fetched.
+	-fix name
+		Apply the code fixer with the given name to each file
+		whose imports of the packages it fixes are changed.
+		The flag may be repeated; see below for the fixers
+		available.
+	-generate
+		After making the changes, run "go generate" in each
+		changed package that contains go:generate directives,
+		so that generated code (mocks, stringers, protocol
+		buffers and so on) is regenerated using the new paths.
+		This is done only if all the changes were made.
+	-hidden
+		Search directories whose names start with a dot,
+		such as .build or .github, for packages too. By
+		default they are skipped, as the go command does.
+	-import-group name
+		Change only the imports in the selected import
+		groups, the runs of imports not separated by blank
+		lines: third-party selects the groups holding no
+		standard library imports, and any other name selects
+		the groups holding an import with it as a prefix.
+	-isolate
+		When the tree contains several modules, change
+		the modules that pass their checks even if the
+		checks for other modules fail.
+	-keep-going
+		When some files cannot be changed, keep the changes
+		made to the others rather than stopping, still
+		exiting with a non-zero status.
 	-m regexp
 		Search for and change imports which have the
 		given pattern as a prefix (see below for the default).
+	-M regexp
+		Leave alone imports which have a leading sequence
+		of path elements matching the given pattern, even
+		if they match the -m pattern.
+	-mirror alias=path
+		Treat imports with the import path prefix alias as
+		imports of the same packages as those with the prefix
+		path, as when a project is also published under another
+		path or imported through a corporate mirror, so that
+		gopkg.in/foo.v3=github.com/owner/foo/v3 makes the two
+		count as one family at each version, and change them to
+		use path. The flag may be repeated, and mappings that
+		are always wanted can be given in the configuration
+		file.
 	-n
 		Don't make any changes; just perform checks.
+	-net-deadline duration
+		Fail any request to a module proxy, checksum database,
+		vulnerability database or vanity import server that
+		would finish later than the given time, such as 5m,
+		after govers starts, so that an unresponsive server
+		cannot hold up a CI job for ever. By default there
+		is no deadline.
+	-net-retries n
+		Retry a request that fails, or that the server answers
+		with a 5xx or 429 status, up to n times, waiting one
+		second before the first retry and twice as long before
+		each one after it (default 2).
+	-net-timeout duration
+		Fail each attempt at a request that takes longer than
+		the given time, including reading the response
+		(default 30s; 0 for no limit).
+	-o dir
+		Leave the tree unchanged, instead writing each changed
+		file (and any go.mod file changed by -require) under the
+		given directory at the same path relative to it as the
+		file has relative to the current directory, for build
+		systems that treat the source as read-only. Only the
+		changed files are written. This flag cannot be used
+		with -n, -plan, -patch, -verify or -generate.
+	-parallel n
+		Work on up to n files at once when finding and
+		making the changes. The default is the number of
+		CPUs available; a lower value may be useful on
+		shared machines or slow network file systems.
+	-patch file
+		Rather than making the changes, write them (including
+		any go.mod changes made by -require) to the given file
+		as a single patch in mailbox format, with a generated
+		commit message, that can be applied with "git am",
+		for example to a release branch. The paths in the patch
+		are relative to the root of the repository.
+	-plan
+		Don't make any changes; instead print the changes that
+		would be made as JSON. The output holds an entry for each
+		file to change, holding the byte offsets of each import
+		path to replace and its replacement text.
+	-record file
+		Once the operation has succeeded, append it, with the
+		flags set for it, to the recipe in the given file, so
+		that it can be applied to other repositories with the
+		replay subcommand. Dry runs made with -n are not
+		recorded.
+	-rename old=new
+		In each file whose imports are changed, rename the
+		qualified identifier old, written as the old import
+		path followed by a dot and the name, such as
+		gopkg.in/yaml.v2.UnmarshalStrict, to new, which may
+		be a name or qualified in the same way by the new
+		import path. The flag may be repeated.
+	-report format[=file]
+		Write a report in the given format to the file, or,
+		without a file, print it instead of the import path of
+		each changed package. The flag may be repeated, but
+		only one report can be printed. With md, the report
+		is a summary of the changes in Markdown, suitable for
+		pasting into the description of a pull request: the
+		import paths changed, a table of the changed packages
+		with the number of files changed in each, and any
+		warnings that remain. With junit, it is a JUnit XML
+		report, which CI systems such as Jenkins and GitLab
+		display with their test results. With html, it is a
+		self-contained web page showing a summary, the diff
+		of each changed package, the inconsistent dependencies
+		found and the work that remains, for reviewing a large
+		migration in a browser. With prometheus, it holds
+		metrics for the run, such as the numbers of packages
+		checked, files changed and inconsistencies found, in
+		the format read by the Prometheus node exporter's
+		textfile collector. With checkstyle and csv, it is
+		as printed by the check subcommand's -format flag
+		(see below).
+	-require version
+		After making the changes, update the go.mod file of
+		each changed module so that it requires the given
+		version of the module being changed to, replacing
+		any requirement on another version in the same
+		family, and download the module with "go mod
+		download" so that its checksums are added to the
+		go.sum file. This flag can only be used with a
+		single new-package-path.
+	-review
+		Show each change with its surrounding context and
+		ask whether it should be made. Only the accepted
+		changes are written.
+	-rewriter program
+		Rather than taking new-package-path arguments,
+		ask the given program how to change each import
+		path (see below).
+	-roots pattern
+		Check and change only the packages reachable from
+		those matching the package pattern, such as ./cmd/foo,
+		rather than every package in the tree (see below).
+		The flag may be repeated.
+	-scope tests|code|all
+		Change only the imports in test files (those
+		ending in _test.go), only those in other files,
+		or those in all files (the default), so that a
+		migration can be made in stages.
+	-skip-generated
+		Leave generated files (those with a "Code generated
+		... DO NOT EDIT." comment) unchanged, reporting
+		them along with any go:generate directives in
+		their package, as it is the generator's inputs
+		that need changing.
+	-strict
+		Exit with a non-zero status if any directory, file
+		or package was skipped because it could not be read,
+		parsed or imported, even if nothing else failed, so
+		that CI can be sure nothing was missed.
+	-t
+		Check the test imports of dependencies as well
+		as those of the packages being changed.
+	-tags tag,list
+		A comma-separated list of build tags to consider
+		satisfied when resolving imports.
+	-templates
+		Change the import paths in text/template files too,
+		those whose names end in .tmpl or .gotmpl, so that the
+		Go source generated from them uses the new paths. The
+		imports are found line by line, as the templates are
+		not parsed: a path holding an action, such as
+		"{{.Module}}/api", is left alone, and so is any import
+		that a template builds from its data.
+	-vanity
+		Also change imports that use a repository's path on
+		GitHub, GitLab or Bitbucket in place of the vanity
+		import path that its packages declare in canonical
+		import comments, such as github.com/golang/net/ipv4
+		in place of golang.org/x/net/ipv4. The vanity path is
+		only used if the go-import or go-source meta tag served
+		for it names the same repository.
+	-verify
+		After making the changes (and running go generate if
+		-generate is given), run "go build" and then "go test"
+		on the changed packages, and if either fails, undo all
+		the changes that govers made to source and go.mod files
+		and list the failures. Files written by go generate
+		are not restored. This is the default for the migrate
+		subcommand; use -verify=false to turn it off.
+	-verify-sum
+		Before making any changes, check each version to be
+		required in go.mod files, as with -require, against
+		the checksum database named by GOSUMDB, failing if the
+		module proxy serves a go.mod file or source for it
+		that does not match (see below).
+	-vers regexp
+		Use the given regular expression (which must not
+		contain capturing groups) to match version elements
+		in package paths, instead of the default described
+		below.
+	-vuln
+		Before making any changes, look up the versions of the
+		modules being changed to, as given by -require or by
+		the subcommand or otherwise as required by the go.mod
+		files in the tree, in the Go vulnerability database
+		named by GOVULNDB (https://vuln.go.dev by default),
+		and warn of each known vulnerability affecting a
+		package that the changed files would import, listing
+		the uses of its vulnerable symbols in them. As the
+		files are not type-checked, a method is counted as
+		used wherever its type is. With -strict, the changes
+		are not made if any vulnerability is found or any
+		version cannot be checked.
+	-worktree branch
+		Leave the current checkout untouched, instead adding
+		a temporary git worktree holding a new branch with
+		the given name at the current commit, making the
+		changes there and committing them to the branch, with
+		a generated commit message. The worktree is removed
+		afterwards, leaving only the branch, which is removed
+		too if the run fails. Uncommitted changes in the
+		current checkout are not included. This flag cannot
+		be used with -n, -plan, -patch or -o.
+	-x
+		As -debug-timing, and also print each directory,
+		package and file as it is read, checked, parsed or
+		written, to show where a slow run spends its time.
+
+The first argument may instead name a subcommand, each of
+which accepts only the flags relevant to it:
+
+	rewrite   change import paths (the default when no subcommand is given)
+	check     check that no imports need changing, without changing anything
+	list      list the import paths that would be changed
+	graph     print the imports of packages in the matched family
+	progress  report how far the tree has been migrated to the new paths
+	api       report uses of identifiers that the new packages do not define
+	why       show the import chains that reach dependencies using inconsistent paths
+	match     show whether import paths match and what they would be changed to
+	replay    apply the operations recorded in a recipe by -record
+	bump      move each package family to its next major version
+	get       fetch each module, change the tree to use it, require it and tidy
+	pin       set the go.mod requirement on each module across the tree
+	align     report modules that the go.mod files in the tree require at different versions
+	outdated  report package families with a later major version published
+	move      move a package to a new directory within its module, changing its importers
+	release   move the module in the current directory to a new major version
+	incompatible
+	          move modules required at +incompatible versions to their /vN modules
+	migrate   make well-known migrations, undoing them if the result fails to build or test
+	patch     change import paths in a copy of a module downloaded to dir
+	help      print help for govers or one of its subcommands
+
+Run "govers help subcommand" for the flags accepted by each one.
+A new-package-path that is the same as a subcommand name can
+be given after the rewrite subcommand.
+
+Only the changed import paths (and any identifiers renamed) are
+changed in each file; the rest of its text, including any //line
+and //go: directives, is left exactly as it was. A file that was
+formatted by gofmt is formatted again, so that comments aligned
+after a changed import stay aligned, unless that would move or
+change any directive. The imports are not sorted again, so the
+comments on each import, such as lint directives and notes,
+stay attached to it exactly as they were written.
+
+The import paths that qualify the symbols named by //go:linkname
+directives are changed too, as in
+
+	//go:linkname now gopkg.in/foo.v2/internal/clock.now
+
+so that a package does not go on linking against the symbols of
+the old version once it imports the new one. As a package must
+import unsafe to use //go:linkname, only the files of such packages
+are searched for them, including those that import nothing else
+that needs changing.
+
+Directories, files and packages that cannot be read, parsed or
+imported are skipped, and the check carries on with the rest of
+the tree. Each is reported as it is found, and again, all
+together, at the end, where it will not be lost among the rest of
+the output. The -fail-fast flag stops at the first instead. When some files
+cannot be changed, govers stops after changing the rest, before
+any later steps such as -require or -generate; with -keep-going
+it carries on with those steps and fails at the end. The
+-strict flag makes govers fail if anything at all was skipped.
+
+The check subcommand is intended to be run in CI. It never
+changes any files, and exits with a non-zero status if any
+import would be changed or any dependency uses an inconsistent
+path. Its -format flag selects the output: text (the default)
+or json, which holds an entry for each inconsistent dependency
+and each import that would be changed, including those in
+modules whose dependencies are inconsistent. For example:
+
+	govers check -format json gopkg.in/tomb.v3
+
+With -format checkstyle, the output is in the Checkstyle XML
+format instead, with an entry at the file and line of each import
+that still uses the old version, so that review tools such as
+reviewdog can annotate pull requests with them:
+
+	govers check -format checkstyle gopkg.in/tomb.v3 | reviewdog -f=checkstyle
+
+With -format csv, the output is a table of comma-separated
+values, for tracking a migration in a spreadsheet: a row for each
+import that would be changed and each inconsistent import found
+in a dependency, giving the importing package, the file, the old
+and target import paths, and the status of the import.
+
+With -format quickfix, each import that would be changed is
+printed on a line of its own, starting with its file, line and
+column, as compilers print errors, so that an editor's quickfix
+list or problem matcher can jump straight to it:
+
+	$ govers check -format quickfix gopkg.in/foo.v3
+	cmd/app/main.go:12:2: imports gopkg.in/foo.v2, want gopkg.in/foo.v3
+
+In vim, for example, ":cexpr system('govers check -format quickfix
+gopkg.in/foo.v3')" loads them into the quickfix list.
+
+For CI systems that display test results, -report junit=file
+writes a JUnit XML report as well, holding a test case for each
+package in the tree, grouped by module, that fails when the
+package would be changed or depends on a package using an
+inconsistent path:
+
+	govers check -report junit=govers.xml gopkg.in/tomb.v3
+
+The check subcommand also fails if any package checked, in
+the tree or among its dependencies, imports more than one major
+version of a family with imports that would be changed, such
+as both gopkg.in/foo.v2 and gopkg.in/foo.v3. This almost always
+means a migration is half done, and causes subtle bugs as the
+types in each version are distinct. Each such package is reported
+separately from the imports that would be changed.
+
+With -all-majors, the check looks beyond the families being
+migrated and beyond single packages: it fails if any family
+at all is imported under more than one major version anywhere
+in the import graph, even by different packages, as when the
+tree imports gopkg.in/yaml.v3 but a dependency still imports
+gopkg.in/yaml.v2, reporting the packages importing each version:
+
+	govers check -all-majors gopkg.in/tomb.v3
+
+To adopt the check in a tree that already has problems, the
+-baseline flag names a file in which to record them. If the
+file does not exist, the check subcommand writes the problems
+found to it and succeeds; otherwise it fails only on problems
+that the file does not record. Remove the file to record the
+problems afresh. For example:
+
+	govers check -baseline govers-baseline.json gopkg.in/tomb.v3
+
+The same check can be run by go vet, as govers can act as a vet
+tool, with the new-package-path arguments given by the -govers.new
+flag (separated by commas) or taken from the configuration file
+for each package; packages with no configuration file are not
+checked themselves. Each import that needs changing is reported
+with a suggested fix, so go vet -fix makes the change, and each
+import of a package that uses, or depends on a package that uses,
+an inconsistent path is reported too. The diagnostics and fixes
+printed by go vet -json take the same form as those of any other
+analyzer. It runs as a vet tool only when given the -V=full or
+-flags argument alone, or a vet configuration file written by the
+go command as its final argument. For example:
+
+	go vet -vettool=$(which govers) -govers.new gopkg.in/tomb.v3 ./...
+
+The analysis is provided by the github.com/rogpeppe/govers/vers/analyzer
+package as a golang.org/x/tools/go/analysis Analyzer, with its
+-new flag, so that it can also be run by gopls or in a multichecker
+binary along with other analyzers.
+
+The progress subcommand reports how far a migration has got,
+for teams tracking one over several weeks. It counts the files
+and packages in the tree that import the matched family, prints
+how many of them use only the new paths, as numbers and as
+percentages, and lists the files that still use the old ones.
+It never fails. For example:
+
+	govers progress gopkg.in/tomb.v3
+
+The api subcommand reports, before anything is changed, the
+code that would fail to compile after the change because it
+uses identifiers that the new version of a package no longer
+defines. It type-checks each package whose imports would be
+changed as it would be after the change, and prints the position
+of each such use, with the identifier missing, failing if there
+are any. The new packages must be available to the go command,
+as dependencies of the module or in GOPATH. For example:
+
+	govers api gopkg.in/yaml.v3
+
+The match subcommand shows how the rules would treat the import
+paths given after the new-package-path arguments and "--" (which
+may be omitted when there is a single new-package-path), without
+looking at any packages: whether each path is matched, by which
+pattern, the prefix matched and what the path would be changed
+to. For example:
+
+	govers match gopkg.in/foo.v3 gopkg.in/foo.v2/sub gopkg.in/foo/sub
+
+When the check fails because a dependency uses an inconsistent
+path, the why subcommand shows how the tree reaches it, as "go
+mod why" does: for each dependency found, it prints the chain of
+imports from a package in the tree to the inconsistent path, so
+that it is clear which direct dependency to chase. It never
+changes anything or fails because of what it finds. For example:
+
+	$ govers why gopkg.in/tomb.v3
+	# example.com/dep imports gopkg.in/tomb.v2
+	example.com/app/sub
+	example.com/dep
+	gopkg.in/tomb.v2
+
+Major versions often rename parts of their API, and the -rename
+flag fixes simple cases in the same pass as the change of import
+path, renaming references to a package-level identifier in the files
+whose imports of its package are changed. References through local
+variables of the same name as the package are left alone, as are
+methods and fields. For example:
+
+	govers -rename gopkg.in/tomb.v2.Gone=Kill gopkg.in/tomb.v3
+
+Changes that need more than a rename are made by fixers, each of
+which knows how to adapt code to an API change in a particular
+migration, and is selected with the -fix flag. A fixer is applied
+to each file whose imports of the packages that it fixes are
+changed, after the change. The fixers available are:
+
+	uuid  wrap calls to uuid.NewV1, NewV2 and NewV4 in uuid.Must,
+	      as the gofrs/uuid versions also return an error
+
+For example:
+
+	govers migrate -fix uuid uuid
+
+New fixers are added to the vers package, by registering a
+vers.Fixer that takes the syntax tree of a file and returns
+the edits to make to it.
+
+The replay subcommand applies a recipe, a sequence of govers
+operations recorded with the -record flag, so that a migration
+authored once can be applied identically to many repositories.
+Each step is run in the current directory in turn, stopping at
+the first that fails; with -n, each is run with -n. The recipe
+is a file such as:
+
+	# govers recipe; apply it with "govers replay <file>"
+	steps:
+	- rewrite -exclude=testdata gopkg.in/tomb.v3
+	- migrate yaml
+
+which could be recorded and replayed with:
+
+	govers -record recipe.yaml -exclude testdata gopkg.in/tomb.v3
+	govers migrate -record recipe.yaml yaml
+	cd ../other && govers replay ../project/recipe.yaml
+
+The patch subcommand is for dependencies that have not yet made
+a migration themselves. It downloads the given version of a
+module, from the module cache if it is there and otherwise from
+the module proxy named by GOPROXY, extracts it into the directory
+named by its -o flag, which must be empty or not exist, and
+changes the import paths there as the rewrite subcommand would,
+ready to be used in a replace directive or as the start of a
+fork. For example:
+
+	govers patch -o ./third_party/dep example.com/dep@v1.2.0 gopkg.in/tomb.v3
+	go mod edit -replace example.com/dep=./third_party/dep
+
+For projects that predate modules, the check subcommand also
+reads any Gopkg.lock or glide.lock file in the current directory
+(or the nearest parent directory holding one, up to the root
+of the repository) and fails if the major version of an import
+path disagrees with the version pinned for its project, as
+when the imports use gopkg.in/yaml.v3 but the lock file pins
+gopkg.in/yaml.v2 or a v2 branch.
+
+The bump subcommand takes package families, import paths
+without their version element, such as gopkg.in/tomb. It
+finds the highest major version of each family imported
+by the packages in the tree and rewrites them all to use
+the next major version. With the -latest flag, it instead
+asks the module proxy named by GOPROXY for the latest
+published major version. For example:
+
+	govers bump gopkg.in/tomb
+
+The get subcommand makes the whole move to a new major version
+in one step. It takes module paths with an optional version, as
+in gopkg.in/yaml.v3@v3.0.1, downloading each module into the
+module cache at that version, or at its latest version if none
+is given, as -fetch does. It then changes the imports of the
+packages in the tree to use it, as the rewrite subcommand does,
+requires it in the go.mod file of each module changed, as -require
+does, and runs "go mod tidy" in each of those modules. It finishes
+by reporting, for each module, the number of packages changed and
+whether it was tidied, failing if "go mod tidy" fails. With -n,
+nothing is changed and "go mod tidy" is not run. For example:
+
+	govers get gopkg.in/yaml.v3
+
+The outdated subcommand asks the module proxy, for each package
+family imported by the packages in the tree, whether a later
+major version than the highest one imported has been published,
+and prints each family that is behind with the versions imported
+and published and the govers command that moves the tree to the
+latest. The families are those whose import paths have a major
+version element, such as gopkg.in/yaml.v2, and the modules that
+the tree's go.mod files require whose paths have none. Private
+modules (matched by GONOPROXY or GOPRIVATE) are skipped. If
+families are given, only those are considered. For example:
+
+	govers outdated gopkg.in/yaml
+
+The pin subcommand takes arguments of the form
+module-path@version. In the go.mod file of each module in
+the tree, it changes any requirement on a module in the same
+family to require the given version instead, adding the
+requirement if the module's packages import the family
+but do not require it. It first checks that the packages
+in each module import the given major version, failing
+(and leaving that module unchanged) if they do not.
+Each module required is downloaded with "go mod download",
+adding its checksums to the go.sum file, unless a replace
+directive names a directory for it. It prints the name of
+each go.mod file changed. For example:
+
+	govers pin gopkg.in/tomb.v3@v3.1.2
+
+The align subcommand keeps the modules of a monorepo on one
+version of each dependency, as a migration can leave them
+disagreeing. It reads every go.mod file in the tree (and that of
+the module holding the current directory) and reports each module
+that they require at more than one version, with the files that
+require each version, failing if there are any. If module paths
+are given, only those modules are considered. With -w, it instead
+changes each of those go.mod files to require the highest of the
+versions, printing the name of each file changed; run "go mod
+tidy" in each changed module afterwards. For example:
+
+	govers align -w gopkg.in/tomb.v3
+
+The move subcommand moves a package, as gomvpkg does: given its
+import path and a new import path within the same module, it
+changes every import of the package, and of the packages below
+it, throughout the tree, updates any canonical import comments
+(such as package foo // import "example.com/foo") in the moved
+files, and then moves the package's directory to the one for the
+new path. Within a git repository the move is made with "git mv",
+so that it is staged. The package name is left unchanged. For
+example:
+
+	govers move example.com/project/util example.com/project/internal/util
+
+The release subcommand prepares a new major version of the
+module in the current directory, which must be its root: given
+the version, such as v2, it changes the imports of the module's
+own packages to use the module path for that version, such as
+example.com/lib/v2, and the module path declared in its go.mod
+file to match, as needed on a branch for the new version. With
+-subdir, the module is instead copied to the subdirectory for
+the new version (or, if the module is itself in such a
+subdirectory, a sibling of it), leaving out nested modules, and
+the copy is changed, for modules that keep each major version
+in a subdirectory of the main branch. Relative directories in
+the copy's replace directives are adjusted to match. Dependencies
+are not checked, as none can import the new version yet. For
+example:
+
+	govers release -subdir v2
+
+The incompatible subcommand finds every module required at a
++incompatible version by any of the tree's go.mod files and,
+for each one that has since published a module with a /vN major
+version suffix (at the same or the next major version), asks
+the module proxy for its latest version, changes the imports to
+use the new module path and updates the go.mod requirements,
+all in a single pass. If module paths are given, only those
+modules are moved.
+
+The module proxies are queried as the go command queries them:
+each proxy listed in GOPROXY (as set in the environment or by
+"go env -w") is tried in turn, moving on to the next when the
+module is not found or, after a proxy followed by "|", on any
+error. Proxies may be given as file:// URLs. As govers talks
+only to module proxies, the search stops at "direct", and
+GOPROXY=off prevents any queries. Modules matched by GONOPROXY
+(or GOPRIVATE, when that is unset) are never looked up, so that
+their paths are not sent to a public proxy.
+
+With -verify-sum, the go.mod file and source of each version
+that would be required are downloaded from the proxies and their
+hashes checked against those that the checksum database (as named
+by GOSUMDB) records for it, so that a migration cannot require a
+version that the go command would refuse. Modules matched by
+GONOSUMDB (or GOPRIVATE) are not checked. Unlike the go command,
+govers does not check the database's signed tree itself.
+
+The migrate subcommand makes well-known migrations by name,
+so that their patterns and new paths need not be worked out
+by hand. For example, the following moves from gopkg.in/yaml.v2
+to gopkg.in/yaml.v3 and from gopkg.in/mgo.v2 to its maintained
+fork:
+
+	govers migrate yaml mgo
+
+Run "govers migrate -list" to see the available presets. More
+may be defined in the file govers/presets within the user's
+configuration directory (for example ~/.config/govers/presets)
+or in a file named with the -presets flag. Each line of such a
+file holds a preset name followed by its new-package-path
+arguments, any module requirements the migration needs written
+as module-path@version, and an optional description after a '#':
+
+	# name	arguments	# description
+	errors	github\.com/pkg/errors=example.com/errors	# our errors package
+
+The migration is checked as well as made: the changed packages
+are built and tested, and if that fails, all the changes are
+undone, leaving a list of the failures. This turns the usual loop
+of rewriting, building and reverting by hand into one command:
+
+	govers migrate yaml
+
+Use -verify=false to make the changes without checking them, as
+the -n, -plan, -patch and -o flags also do. The rewrite subcommand
+and the others that change imports, such as bump and incompatible,
+check their changes in the same way when given -verify.
 
 If the pattern is not specified with the -m flag, it is derived from
 new-package-path and matches any prefix that is the same in all but
 version.  A version is defined to be an element within a package path
-that matches the regular expression "(/|\.)v[0-9.]+".
+that matches the regular expression "(/|\.)v[0-9]+(\.[0-9]+)*(-unstable)?".
+
+Import paths are normalized before they are matched, so that
+forms such as "gopkg.in/tomb.v2/" or "gopkg.in/./tomb.v2" are
+matched as "gopkg.in/tomb.v2", and changed imports are always
+written in canonical form. When the tree is on a case-insensitive
+file system, where imports differing only in case name the same
+package, paths are matched without regard to case too.
+
+The -M flag carves exceptions out of the pattern: imports
+whose leading path elements match it are left alone. For
+example, this moves everything under github.com/old but
+its internal packages:
+
+	govers -m github.com/old -M 'github.com/old/internal' github.com/new
+
+The -import-group flag guards against a pattern broad enough
+to match imports that should be left alone, such as internal
+mirrors of a module kept in their own import group. This changes
+imports of yaml.v2 only in the groups holding a gopkg.in import,
+leaving alone a mirror such as example.com/mirror/yaml.v2 kept
+in a group of its own:
+
+	govers -import-group gopkg.in -m '(gopkg\.in|example\.com/mirror)/yaml\.v2' gopkg.in/yaml.v3
 
 The govers command will also check (unless the -d flag is given)
 that no (recursive) dependencies would be changed if the same govers
-command was run on them. If they would, govers will fail and do nothing.
+command was run on them. If they would, govers will fail and do nothing,
+printing the commands that can be used to fix each offending
+dependency, grouped by repository.
+
+When the offending copy of the old version was found in a vendor
+directory, the report says so, naming the vendored directory
+and the direct dependency of the tree that brought it in, so
+that it is clear whether to re-vendor or to fix the dependency
+upstream.
+
+By default, directories below the current directory that
+contain their own go.mod file, such as example modules or
+vendored forks, are treated as separate modules and left
+alone, and a note is printed for each one. With the
+-all-modules flag, they are included: each module in the
+tree is checked separately, resolving its dependencies as
+the go command would when building that module, and a summary
+is printed showing which modules were fully migrated and which
+have remaining inconsistencies. In either case, a warning is
+also printed for each require line in a nested module's go.mod
+file that names a module whose path would be changed, even when
+that module's packages are excluded from the change.
+
+If the go command cannot resolve a module's dependency (for
+example because it is unavailable), its source is looked
+for in the directory named by a replace directive in the
+module's go.mod file, or in the module cache at the version
+selected from the module graph, so that dependencies are still
+checked when there is no GOPATH source tree. The graph is found
+from the go.mod files of the dependencies held in the module
+cache, choosing the highest version of each module that any
+of them requires, so that modules required only indirectly are
+found too.
+
+Outside modules, an import path with a major version element,
+such as example.com/lib/v2/sub, is resolved as the go command
+resolves it in GOPATH mode, whichever way the upstream module
+publishes its major versions: from the v2 subdirectory of the
+example.com/lib checkout when upstream keeps each major version
+in a subdirectory, or, when it keeps each on a branch, from the
+sub directory of the checkout if its go.mod file declares the
+module example.com/lib/v2. If the checkout holds another version
+of the module, the import error says so, rather than only that
+the package cannot be found.
+
+In modules, each module with a major version suffix that a run
+requires at a given version, with -require, the pin and get
+subcommands or a preset, is checked before anything is changed:
+its go.mod file at that version is looked for in the module cache
+and then on the module proxy, and the run fails if upstream
+publishes no such version, in a vN subdirectory or on a vN branch,
+listing the versions that are published, or if the go.mod file
+declares another module path. Modules that the current module
+replaces, and private ones, are not checked, and if the proxy
+cannot be queried the check is skipped with a warning.
+
+Default flags and arguments may be kept in a .govers.yaml file
+in the current directory or any parent directory up to the
+root of the repository, so that everyone working on a project
+(and its CI jobs) gets the same behavior. Each entry in the
+file names a flag, given without its leading hyphen, and
+the value to use when that flag is not set on the command
+line. Flags that may be repeated take a list of values.
+The "rewrites" entry holds the new-package-path arguments
+to use when none are given on the command line. For example:
+
+	# .govers.yaml
+	tags: integration
+	skip-generated: true
+	exclude:
+	  - testdata
+	  - examples/legacy
+	rewrites:
+	  - gopkg.in/tomb.v3
+
+A .govers.yaml file in a directory within the tree overrides
+the rules for the packages in that directory and those below it.
+Its "rewrites" entry, which may use the regexp=new-package-path
+form, replaces the mapping there, and "disable: true" leaves
+the directory alone altogether, for example so that examples
+keep deliberately importing the old version:
+
+	# examples/.govers.yaml
+	disable: true
+
+No other entries may be set in such a file. Each override
+that applies is reported, and dependencies are still checked
+against the usual rules.
+
+The GOVERSFLAGS environment variable may hold a space-separated
+list of flags, each of the form -flag or -flag=value, that are
+treated as if they were given before those on the command line. Flags set this way take precedence
+over those in .govers.yaml. This is the way to set the network
+limits for every run in CI, for example:
+
+	GOVERSFLAGS="-net-timeout=20s -net-retries=3 -net-deadline=5m"
+
+Imports are resolved using the go command's own settings, as
+shown by "go env", so values set with "go env -w" or in the
+file named by GOENV are honored as well as those in the
+environment. This includes GOOS, GOARCH, GOPATH, CGO_ENABLED
+and GO111MODULE, and any -tags flag in GOFLAGS, which is used
+when -tags is not given. In module mode, other flags in GOFLAGS
+(such as -mod=vendor) take effect because imports are resolved
+by the go command itself.
+
+When GOPACKAGESDRIVER names a go/packages driver program (or
+is unset and gopackagesdriver is on the PATH), as when working
+in a Bazel-managed repository, packages are loaded using the
+driver instead, falling back to the usual resolution if the
+driver declines to handle them. Set GOPACKAGESDRIVER=off to
+disable this.
+
+To make repeated runs during a long migration quicker, govers
+remembers which files needed no changes, keyed by a hash of
+their content and the rules in use, and does not parse them
+again until either changes. The cache is kept in the directory
+named by GOVERSCACHE, or in govers within the user's cache
+directory (for example ~/.cache/govers) when that is unset.
+Set GOVERSCACHE=off to disable it.
+
+While it is changing files, govers holds a lock on the
+repository containing the current directory, and a second run
+that would change files in the same repository fails immediately
+rather than interleaving its writes with those of the first. The
+lock file is kept in the locks directory within the cache directory
+(or govers-locks in the temporary directory when GOVERSCACHE=off),
+named by a hash of the repository's root, so that nothing is left
+in the repository itself.
 
 For example, say a new version of the tomb package is released.
 The old import path was gopkg.in/tomb.v2, and we want
@@ -40,25 +898,90 @@ It will also check that all external packages that we're
 using are also using v3, making sure that our program
 is consistently using the same version throughout.
 
+The checks that govers performs are also available as a Go
+package, github.com/rogpeppe/govers/vers, which returns
+the inconsistencies it finds as structured values.
+
+Several packages can be changed at once by giving more than
+one new-package-path. The changes are all made in a single
+pass, so the dependency check sees the final state. As -m
+can only be used with a single new-package-path, the pattern
+for each one may be specified by prefixing it with "regexp=".
+For example:
+
+	govers gopkg.in/tomb.v3 'gopkg.in/mgo\.v2=github.com/globalsign/mgo/v3'
+
+If a path matches more than one pattern, the first one is used.
+
+The changes can be limited to some of the packages in the tree
+by following the new-package-paths with package patterns, which
+are directories relative to the current directory, each starting
+with "./" or "../" and optionally ending in "/..." to include
+the directories below it, as for the go command. The packages
+are then found from the root of the module containing the current
+directory (or of its repository, outside a module), and the other
+packages there are checked as dependencies of the selected ones.
+For example:
+
+	govers gopkg.in/tomb.v3 ./cmd/... ./internal/foo
+
+In a repository holding many unrelated binaries, the move can
+instead be made one binary at a time with -roots, which names the
+packages to start from with patterns of the same form. Only those
+packages, and the packages in the tree that they import, directly
+or indirectly, are checked and changed; the others are left out
+of the check altogether, so that inconsistent dependencies of
+packages outside the dependency cone do not cause failure. The
+imports between packages in the tree are followed however deep
+they go, even with -d or -depcheck-depth, which limit only how
+far dependencies outside the tree are checked. For example:
+
+	govers -roots ./cmd/server gopkg.in/tomb.v3
+
+Mapping logic that cannot be written as patterns can be
+provided by a separate program named with -rewriter, which
+is started once and sent each candidate import path on a line
+of its standard input. For each path, it must reply with a
+line holding the path to change it to, or "keep" to leave the
+path alone. It should exit when its standard input is closed.
+For example, the following program moves packages from an
+old host to a new one:
+
+	#!/bin/sh
+	while read path; do
+		case $path in
+		old.example.com/*) echo "new.example.com/${path#old.example.com/}";;
+		*) echo keep;;
+		esac
+	done
+
+When a new-package-path ends in a /vN major version suffix and
+one of the tree's go.mod files requires the path without the
+suffix at a +incompatible version (as happens when a project
+that published v2 or later without a go.mod file adopts semantic
+import versioning), the unsuffixed imports are changed too.
+Give -require to replace the +incompatible requirement with one
+on the new module at the same time. For example:
+
+	govers -require v5.0.0 github.com/foo/bar/v5
+
 BUG: Vendored imports are not dealt with correctly - they won't
 be changed. It's not yet clear how this command should work then.
 */
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"go/build"
-	"go/parser"
-	"go/printer"
-	"go/token"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
-	"strconv"
+	"runtime"
 	"strings"
+	"unicode"
+
+	"github.com/rogpeppe/govers/vers"
 )
 
 const help = `
@@ -70,26 +993,810 @@ It prints the names of any packages that are modified.
 
 Usage:
 
-	govers [-d] [-m regexp] [-n] new-package-path
+	govers [subcommand] [flags] new-package-path... [package...]
 
 It accepts the following flags:
 
+	-allow prefix
+		Don't fail because of inconsistent paths used by
+		dependencies whose import paths have the given
+		prefix, such as compatibility shims that deliberately
+		use an old version. Such inconsistencies are reported
+		as waived instead. This flag may be repeated.
+	-all-modules
+		Check and change the modules nested within the
+		tree (directories below the current directory
+		that contain a go.mod file) as well as the one
+		containing the current directory.
 	-d
 		Suppress dependency checking
+	-debug-timing
+		Print the time taken by each phase of the work:
+		walking the tree, checking packages and their
+		dependencies, parsing the files to change and
+		writing them.
+	-deep
+		Rather than failing when a dependency uses an
+		inconsistent path, rewrite the dependency too if
+		its source can be written (for example under
+		GOPATH/src or in a vendor directory). Each
+		external package edited is reported.
+	-dep-check error|warn
+		With warn, report dependencies that use inconsistent
+		paths as warnings, but make the changes anyway and
+		don't fail because of them, so that a migration can
+		be landed while the stragglers are tracked. The
+		default is error.
+	-depcheck-depth n
+		Follow imports only n levels deep from the packages
+		in the tree when checking dependencies, which is
+		faster and quieter on large dependency graphs, at
+		the cost of missing inconsistencies deeper down.
+		With 1, only the direct dependencies are checked.
+		The default, 0, follows all imports.
+	-direct
+		Check only the direct dependencies of the packages
+		in the tree; shorthand for -depcheck-depth 1.
+	-events file
+		Stream events to file (standard output if it is -)
+		as they happen, one JSON object per line, for tools
+		following a long run: package-scanned as each package
+		in the tree is checked, check-failure for each
+		inconsistent dependency, each problem and, with the
+		check subcommand, each import that would be changed,
+		file-modified as each file is changed, and finally
+		summary, with the counts of each and the exit status.
+		With -, the events take the place of the list of
+		changed packages and of check's text report, and
+		-plan, check's other formats and a -report printed
+		to standard output are not allowed.
+	-exclude pattern
+		Don't change packages in directories matching
+		the pattern, or any directories below them. A pattern
+		containing a slash is matched against the directory's
+		path relative to the current directory; otherwise
+		it is matched against the directory's name. This
+		flag may be repeated.
+	-explain
+		For each inconsistent path found, explain why it was
+		considered inconsistent: the pattern that matched it,
+		the matched prefix, what it would be changed to, and
+		the chain of imports that led to the offending package.
+	-fail-fast
+		Stop at the first directory, file or package that
+		cannot be read, parsed or imported, or file that
+		cannot be changed, rather than skipping it and
+		carrying on.
+	-fetch
+		Before checking, download the module providing each
+		new path into the module cache with "go mod download",
+		at the version given by -require or otherwise its
+		latest version, so that the new packages can be
+		resolved, and their imports checked, even if the new
+		version has never been used on this machine. The download is
+		made outside the tree, so go.mod and go.sum are left
+		as they are; only the check uses the version fetched.
+	-fix name
+		Apply the code fixer with the given name to each file
+		whose imports of the packages it fixes are changed.
+		The flag may be repeated; see below for the fixers
+		available.
+	-generate
+		After making the changes, run "go generate" in each
+		changed package that contains go:generate directives,
+		so that generated code (mocks, stringers, protocol
+		buffers and so on) is regenerated using the new paths.
+		This is done only if all the changes were made.
+	-hidden
+		Search directories whose names start with a dot,
+		such as .build or .github, for packages too. By
+		default they are skipped, as the go command does.
+	-import-group name
+		Change only the imports in the selected import
+		groups, the runs of imports not separated by blank
+		lines: third-party selects the groups holding no
+		standard library imports, and any other name selects
+		the groups holding an import with it as a prefix.
+	-isolate
+		When the tree contains several modules, change
+		the modules that pass their checks even if the
+		checks for other modules fail.
+	-keep-going
+		When some files cannot be changed, keep the changes
+		made to the others rather than stopping, still
+		exiting with a non-zero status.
 	-m regexp
 		Search for and change imports which have the
 		given pattern as a prefix (see below for the default).
+	-M regexp
+		Leave alone imports which have a leading sequence
+		of path elements matching the given pattern, even
+		if they match the -m pattern.
+	-mirror alias=path
+		Treat imports with the import path prefix alias as
+		imports of the same packages as those with the prefix
+		path, as when a project is also published under another
+		path or imported through a corporate mirror, so that
+		gopkg.in/foo.v3=github.com/owner/foo/v3 makes the two
+		count as one family at each version, and change them to
+		use path. The flag may be repeated, and mappings that
+		are always wanted can be given in the configuration
+		file.
 	-n
 		Don't make any changes; just perform checks.
+	-net-deadline duration
+		Fail any request to a module proxy, checksum database,
+		vulnerability database or vanity import server that
+		would finish later than the given time, such as 5m,
+		after govers starts, so that an unresponsive server
+		cannot hold up a CI job for ever. By default there
+		is no deadline.
+	-net-retries n
+		Retry a request that fails, or that the server answers
+		with a 5xx or 429 status, up to n times, waiting one
+		second before the first retry and twice as long before
+		each one after it (default 2).
+	-net-timeout duration
+		Fail each attempt at a request that takes longer than
+		the given time, including reading the response
+		(default 30s; 0 for no limit).
+	-o dir
+		Leave the tree unchanged, instead writing each changed
+		file (and any go.mod file changed by -require) under the
+		given directory at the same path relative to it as the
+		file has relative to the current directory, for build
+		systems that treat the source as read-only. Only the
+		changed files are written. This flag cannot be used
+		with -n, -plan, -patch, -verify or -generate.
+	-parallel n
+		Work on up to n files at once when finding and
+		making the changes. The default is the number of
+		CPUs available; a lower value may be useful on
+		shared machines or slow network file systems.
+	-patch file
+		Rather than making the changes, write them (including
+		any go.mod changes made by -require) to the given file
+		as a single patch in mailbox format, with a generated
+		commit message, that can be applied with "git am",
+		for example to a release branch. The paths in the patch
+		are relative to the root of the repository.
+	-plan
+		Don't make any changes; instead print the changes that
+		would be made as JSON. The output holds an entry for each
+		file to change, holding the byte offsets of each import
+		path to replace and its replacement text.
+	-record file
+		Once the operation has succeeded, append it, with the
+		flags set for it, to the recipe in the given file, so
+		that it can be applied to other repositories with the
+		replay subcommand. Dry runs made with -n are not
+		recorded.
+	-rename old=new
+		In each file whose imports are changed, rename the
+		qualified identifier old, written as the old import
+		path followed by a dot and the name, such as
+		gopkg.in/yaml.v2.UnmarshalStrict, to new, which may
+		be a name or qualified in the same way by the new
+		import path. The flag may be repeated.
+	-report format[=file]
+		Write a report in the given format to the file, or,
+		without a file, print it instead of the import path of
+		each changed package. The flag may be repeated, but
+		only one report can be printed. With md, the report
+		is a summary of the changes in Markdown, suitable for
+		pasting into the description of a pull request: the
+		import paths changed, a table of the changed packages
+		with the number of files changed in each, and any
+		warnings that remain. With junit, it is a JUnit XML
+		report, which CI systems such as Jenkins and GitLab
+		display with their test results. With html, it is a
+		self-contained web page showing a summary, the diff
+		of each changed package, the inconsistent dependencies
+		found and the work that remains, for reviewing a large
+		migration in a browser. With prometheus, it holds
+		metrics for the run, such as the numbers of packages
+		checked, files changed and inconsistencies found, in
+		the format read by the Prometheus node exporter's
+		textfile collector. With checkstyle and csv, it is
+		as printed by the check subcommand's -format flag
+		(see below).
+	-require version
+		After making the changes, update the go.mod file of
+		each changed module so that it requires the given
+		version of the module being changed to, replacing
+		any requirement on another version in the same
+		family, and download the module with "go mod
+		download" so that its checksums are added to the
+		go.sum file. This flag can only be used with a
+		single new-package-path.
+	-review
+		Show each change with its surrounding context and
+		ask whether it should be made. Only the accepted
+		changes are written.
+	-rewriter program
+		Rather than taking new-package-path arguments,
+		ask the given program how to change each import
+		path (see below).
+	-roots pattern
+		Check and change only the packages reachable from
+		those matching the package pattern, such as ./cmd/foo,
+		rather than every package in the tree (see below).
+		The flag may be repeated.
+	-scope tests|code|all
+		Change only the imports in test files (those
+		ending in _test.go), only those in other files,
+		or those in all files (the default), so that a
+		migration can be made in stages.
+	-skip-generated
+		Leave generated files (those with a "Code generated
+		... DO NOT EDIT." comment) unchanged, reporting
+		them along with any go:generate directives in
+		their package, as it is the generator's inputs
+		that need changing.
+	-strict
+		Exit with a non-zero status if any directory, file
+		or package was skipped because it could not be read,
+		parsed or imported, even if nothing else failed, so
+		that CI can be sure nothing was missed.
+	-t
+		Check the test imports of dependencies as well
+		as those of the packages being changed.
+	-tags tag,list
+		A comma-separated list of build tags to consider
+		satisfied when resolving imports.
+	-templates
+		Change the import paths in text/template files too,
+		those whose names end in .tmpl or .gotmpl, so that the
+		Go source generated from them uses the new paths. The
+		imports are found line by line, as the templates are
+		not parsed: a path holding an action, such as
+		"{{.Module}}/api", is left alone, and so is any import
+		that a template builds from its data.
+	-vanity
+		Also change imports that use a repository's path on
+		GitHub, GitLab or Bitbucket in place of the vanity
+		import path that its packages declare in canonical
+		import comments, such as github.com/golang/net/ipv4
+		in place of golang.org/x/net/ipv4. The vanity path is
+		only used if the go-import or go-source meta tag served
+		for it names the same repository.
+	-verify
+		After making the changes (and running go generate if
+		-generate is given), run "go build" and then "go test"
+		on the changed packages, and if either fails, undo all
+		the changes that govers made to source and go.mod files
+		and list the failures. Files written by go generate
+		are not restored. This is the default for the migrate
+		subcommand; use -verify=false to turn it off.
+	-verify-sum
+		Before making any changes, check each version to be
+		required in go.mod files, as with -require, against
+		the checksum database named by GOSUMDB, failing if the
+		module proxy serves a go.mod file or source for it
+		that does not match (see below).
+	-vers regexp
+		Use the given regular expression (which must not
+		contain capturing groups) to match version elements
+		in package paths, instead of the default described
+		below.
+	-vuln
+		Before making any changes, look up the versions of the
+		modules being changed to, as given by -require or by
+		the subcommand or otherwise as required by the go.mod
+		files in the tree, in the Go vulnerability database
+		named by GOVULNDB (https://vuln.go.dev by default),
+		and warn of each known vulnerability affecting a
+		package that the changed files would import, listing
+		the uses of its vulnerable symbols in them. As the
+		files are not type-checked, a method is counted as
+		used wherever its type is. With -strict, the changes
+		are not made if any vulnerability is found or any
+		version cannot be checked.
+	-worktree branch
+		Leave the current checkout untouched, instead adding
+		a temporary git worktree holding a new branch with
+		the given name at the current commit, making the
+		changes there and committing them to the branch, with
+		a generated commit message. The worktree is removed
+		afterwards, leaving only the branch, which is removed
+		too if the run fails. Uncommitted changes in the
+		current checkout are not included. This flag cannot
+		be used with -n, -plan, -patch or -o.
+	-x
+		As -debug-timing, and also print each directory,
+		package and file as it is read, checked, parsed or
+		written, to show where a slow run spends its time.
+
+The first argument may instead name a subcommand, each of
+which accepts only the flags relevant to it:
+
+	rewrite   change import paths (the default when no subcommand is given)
+	check     check that no imports need changing, without changing anything
+	list      list the import paths that would be changed
+	graph     print the imports of packages in the matched family
+	progress  report how far the tree has been migrated to the new paths
+	api       report uses of identifiers that the new packages do not define
+	why       show the import chains that reach dependencies using inconsistent paths
+	match     show whether import paths match and what they would be changed to
+	replay    apply the operations recorded in a recipe by -record
+	bump      move each package family to its next major version
+	get       fetch each module, change the tree to use it, require it and tidy
+	pin       set the go.mod requirement on each module across the tree
+	align     report modules that the go.mod files in the tree require at different versions
+	outdated  report package families with a later major version published
+	move      move a package to a new directory within its module, changing its importers
+	release   move the module in the current directory to a new major version
+	incompatible
+	          move modules required at +incompatible versions to their /vN modules
+	migrate   make well-known migrations, undoing them if the result fails to build or test
+	patch     change import paths in a copy of a module downloaded to dir
+	help      print help for govers or one of its subcommands
+
+Run "govers help subcommand" for the flags accepted by each one.
+A new-package-path that is the same as a subcommand name can
+be given after the rewrite subcommand.
+
+Only the changed import paths (and any identifiers renamed) are
+changed in each file; the rest of its text, including any //line
+and //go: directives, is left exactly as it was. A file that was
+formatted by gofmt is formatted again, so that comments aligned
+after a changed import stay aligned, unless that would move or
+change any directive. The imports are not sorted again, so the
+comments on each import, such as lint directives and notes,
+stay attached to it exactly as they were written.
+
+The import paths that qualify the symbols named by //go:linkname
+directives are changed too, as in
+
+	//go:linkname now gopkg.in/foo.v2/internal/clock.now
+
+so that a package does not go on linking against the symbols of
+the old version once it imports the new one. As a package must
+import unsafe to use //go:linkname, only the files of such packages
+are searched for them, including those that import nothing else
+that needs changing.
+
+Directories, files and packages that cannot be read, parsed or
+imported are skipped, and the check carries on with the rest of
+the tree. Each is reported as it is found, and again, all
+together, at the end, where it will not be lost among the rest of
+the output. The -fail-fast flag stops at the first instead. When some files
+cannot be changed, govers stops after changing the rest, before
+any later steps such as -require or -generate; with -keep-going
+it carries on with those steps and fails at the end. The
+-strict flag makes govers fail if anything at all was skipped.
+
+The check subcommand is intended to be run in CI. It never
+changes any files, and exits with a non-zero status if any
+import would be changed or any dependency uses an inconsistent
+path. Its -format flag selects the output: text (the default)
+or json, which holds an entry for each inconsistent dependency
+and each import that would be changed, including those in
+modules whose dependencies are inconsistent. For example:
+
+	govers check -format json gopkg.in/tomb.v3
+
+With -format checkstyle, the output is in the Checkstyle XML
+format instead, with an entry at the file and line of each import
+that still uses the old version, so that review tools such as
+reviewdog can annotate pull requests with them:
+
+	govers check -format checkstyle gopkg.in/tomb.v3 | reviewdog -f=checkstyle
+
+With -format csv, the output is a table of comma-separated
+values, for tracking a migration in a spreadsheet: a row for each
+import that would be changed and each inconsistent import found
+in a dependency, giving the importing package, the file, the old
+and target import paths, and the status of the import.
+
+With -format quickfix, each import that would be changed is
+printed on a line of its own, starting with its file, line and
+column, as compilers print errors, so that an editor's quickfix
+list or problem matcher can jump straight to it:
+
+	$ govers check -format quickfix gopkg.in/foo.v3
+	cmd/app/main.go:12:2: imports gopkg.in/foo.v2, want gopkg.in/foo.v3
+
+In vim, for example, ":cexpr system('govers check -format quickfix
+gopkg.in/foo.v3')" loads them into the quickfix list.
+
+For CI systems that display test results, -report junit=file
+writes a JUnit XML report as well, holding a test case for each
+package in the tree, grouped by module, that fails when the
+package would be changed or depends on a package using an
+inconsistent path:
+
+	govers check -report junit=govers.xml gopkg.in/tomb.v3
+
+The check subcommand also fails if any package checked, in
+the tree or among its dependencies, imports more than one major
+version of a family with imports that would be changed, such
+as both gopkg.in/foo.v2 and gopkg.in/foo.v3. This almost always
+means a migration is half done, and causes subtle bugs as the
+types in each version are distinct. Each such package is reported
+separately from the imports that would be changed.
+
+With -all-majors, the check looks beyond the families being
+migrated and beyond single packages: it fails if any family
+at all is imported under more than one major version anywhere
+in the import graph, even by different packages, as when the
+tree imports gopkg.in/yaml.v3 but a dependency still imports
+gopkg.in/yaml.v2, reporting the packages importing each version:
+
+	govers check -all-majors gopkg.in/tomb.v3
+
+To adopt the check in a tree that already has problems, the
+-baseline flag names a file in which to record them. If the
+file does not exist, the check subcommand writes the problems
+found to it and succeeds; otherwise it fails only on problems
+that the file does not record. Remove the file to record the
+problems afresh. For example:
+
+	govers check -baseline govers-baseline.json gopkg.in/tomb.v3
+
+The same check can be run by go vet, as govers can act as a vet
+tool, with the new-package-path arguments given by the -govers.new
+flag (separated by commas) or taken from the configuration file
+for each package; packages with no configuration file are not
+checked themselves. Each import that needs changing is reported
+with a suggested fix, so go vet -fix makes the change, and each
+import of a package that uses, or depends on a package that uses,
+an inconsistent path is reported too. The diagnostics and fixes
+printed by go vet -json take the same form as those of any other
+analyzer. It runs as a vet tool only when given the -V=full or
+-flags argument alone, or a vet configuration file written by the
+go command as its final argument. For example:
+
+	go vet -vettool=$(which govers) -govers.new gopkg.in/tomb.v3 ./...
+
+The analysis is provided by the github.com/rogpeppe/govers/vers/analyzer
+package as a golang.org/x/tools/go/analysis Analyzer, with its
+-new flag, so that it can also be run by gopls or in a multichecker
+binary along with other analyzers.
+
+The progress subcommand reports how far a migration has got,
+for teams tracking one over several weeks. It counts the files
+and packages in the tree that import the matched family, prints
+how many of them use only the new paths, as numbers and as
+percentages, and lists the files that still use the old ones.
+It never fails. For example:
+
+	govers progress gopkg.in/tomb.v3
+
+The api subcommand reports, before anything is changed, the
+code that would fail to compile after the change because it
+uses identifiers that the new version of a package no longer
+defines. It type-checks each package whose imports would be
+changed as it would be after the change, and prints the position
+of each such use, with the identifier missing, failing if there
+are any. The new packages must be available to the go command,
+as dependencies of the module or in GOPATH. For example:
+
+	govers api gopkg.in/yaml.v3
+
+The match subcommand shows how the rules would treat the import
+paths given after the new-package-path arguments and "--" (which
+may be omitted when there is a single new-package-path), without
+looking at any packages: whether each path is matched, by which
+pattern, the prefix matched and what the path would be changed
+to. For example:
+
+	govers match gopkg.in/foo.v3 gopkg.in/foo.v2/sub gopkg.in/foo/sub
+
+When the check fails because a dependency uses an inconsistent
+path, the why subcommand shows how the tree reaches it, as "go
+mod why" does: for each dependency found, it prints the chain of
+imports from a package in the tree to the inconsistent path, so
+that it is clear which direct dependency to chase. It never
+changes anything or fails because of what it finds. For example:
+
+	$ govers why gopkg.in/tomb.v3
+	# example.com/dep imports gopkg.in/tomb.v2
+	example.com/app/sub
+	example.com/dep
+	gopkg.in/tomb.v2
+
+Major versions often rename parts of their API, and the -rename
+flag fixes simple cases in the same pass as the change of import
+path, renaming references to a package-level identifier in the files
+whose imports of its package are changed. References through local
+variables of the same name as the package are left alone, as are
+methods and fields. For example:
+
+	govers -rename gopkg.in/tomb.v2.Gone=Kill gopkg.in/tomb.v3
+
+Changes that need more than a rename are made by fixers, each of
+which knows how to adapt code to an API change in a particular
+migration, and is selected with the -fix flag. A fixer is applied
+to each file whose imports of the packages that it fixes are
+changed, after the change. The fixers available are:
+
+	uuid  wrap calls to uuid.NewV1, NewV2 and NewV4 in uuid.Must,
+	      as the gofrs/uuid versions also return an error
+
+For example:
+
+	govers migrate -fix uuid uuid
+
+New fixers are added to the vers package, by registering a
+vers.Fixer that takes the syntax tree of a file and returns
+the edits to make to it.
+
+The replay subcommand applies a recipe, a sequence of govers
+operations recorded with the -record flag, so that a migration
+authored once can be applied identically to many repositories.
+Each step is run in the current directory in turn, stopping at
+the first that fails; with -n, each is run with -n. The recipe
+is a file such as:
+
+	# govers recipe; apply it with "govers replay <file>"
+	steps:
+	- rewrite -exclude=testdata gopkg.in/tomb.v3
+	- migrate yaml
+
+which could be recorded and replayed with:
+
+	govers -record recipe.yaml -exclude testdata gopkg.in/tomb.v3
+	govers migrate -record recipe.yaml yaml
+	cd ../other && govers replay ../project/recipe.yaml
+
+The patch subcommand is for dependencies that have not yet made
+a migration themselves. It downloads the given version of a
+module, from the module cache if it is there and otherwise from
+the module proxy named by GOPROXY, extracts it into the directory
+named by its -o flag, which must be empty or not exist, and
+changes the import paths there as the rewrite subcommand would,
+ready to be used in a replace directive or as the start of a
+fork. For example:
+
+	govers patch -o ./third_party/dep example.com/dep@v1.2.0 gopkg.in/tomb.v3
+	go mod edit -replace example.com/dep=./third_party/dep
+
+For projects that predate modules, the check subcommand also
+reads any Gopkg.lock or glide.lock file in the current directory
+(or the nearest parent directory holding one, up to the root
+of the repository) and fails if the major version of an import
+path disagrees with the version pinned for its project, as
+when the imports use gopkg.in/yaml.v3 but the lock file pins
+gopkg.in/yaml.v2 or a v2 branch.
+
+The bump subcommand takes package families, import paths
+without their version element, such as gopkg.in/tomb. It
+finds the highest major version of each family imported
+by the packages in the tree and rewrites them all to use
+the next major version. With the -latest flag, it instead
+asks the module proxy named by GOPROXY for the latest
+published major version. For example:
+
+	govers bump gopkg.in/tomb
+
+The get subcommand makes the whole move to a new major version
+in one step. It takes module paths with an optional version, as
+in gopkg.in/yaml.v3@v3.0.1, downloading each module into the
+module cache at that version, or at its latest version if none
+is given, as -fetch does. It then changes the imports of the
+packages in the tree to use it, as the rewrite subcommand does,
+requires it in the go.mod file of each module changed, as -require
+does, and runs "go mod tidy" in each of those modules. It finishes
+by reporting, for each module, the number of packages changed and
+whether it was tidied, failing if "go mod tidy" fails. With -n,
+nothing is changed and "go mod tidy" is not run. For example:
+
+	govers get gopkg.in/yaml.v3
+
+The outdated subcommand asks the module proxy, for each package
+family imported by the packages in the tree, whether a later
+major version than the highest one imported has been published,
+and prints each family that is behind with the versions imported
+and published and the govers command that moves the tree to the
+latest. The families are those whose import paths have a major
+version element, such as gopkg.in/yaml.v2, and the modules that
+the tree's go.mod files require whose paths have none. Private
+modules (matched by GONOPROXY or GOPRIVATE) are skipped. If
+families are given, only those are considered. For example:
+
+	govers outdated gopkg.in/yaml
+
+The pin subcommand takes arguments of the form
+module-path@version. In the go.mod file of each module in
+the tree, it changes any requirement on a module in the same
+family to require the given version instead, adding the
+requirement if the module's packages import the family
+but do not require it. It first checks that the packages
+in each module import the given major version, failing
+(and leaving that module unchanged) if they do not.
+Each module required is downloaded with "go mod download",
+adding its checksums to the go.sum file, unless a replace
+directive names a directory for it. It prints the name of
+each go.mod file changed. For example:
+
+	govers pin gopkg.in/tomb.v3@v3.1.2
+
+The align subcommand keeps the modules of a monorepo on one
+version of each dependency, as a migration can leave them
+disagreeing. It reads every go.mod file in the tree (and that of
+the module holding the current directory) and reports each module
+that they require at more than one version, with the files that
+require each version, failing if there are any. If module paths
+are given, only those modules are considered. With -w, it instead
+changes each of those go.mod files to require the highest of the
+versions, printing the name of each file changed; run "go mod
+tidy" in each changed module afterwards. For example:
+
+	govers align -w gopkg.in/tomb.v3
+
+The move subcommand moves a package, as gomvpkg does: given its
+import path and a new import path within the same module, it
+changes every import of the package, and of the packages below
+it, throughout the tree, updates any canonical import comments
+(such as package foo // import "example.com/foo") in the moved
+files, and then moves the package's directory to the one for the
+new path. Within a git repository the move is made with "git mv",
+so that it is staged. The package name is left unchanged. For
+example:
+
+	govers move example.com/project/util example.com/project/internal/util
+
+The release subcommand prepares a new major version of the
+module in the current directory, which must be its root: given
+the version, such as v2, it changes the imports of the module's
+own packages to use the module path for that version, such as
+example.com/lib/v2, and the module path declared in its go.mod
+file to match, as needed on a branch for the new version. With
+-subdir, the module is instead copied to the subdirectory for
+the new version (or, if the module is itself in such a
+subdirectory, a sibling of it), leaving out nested modules, and
+the copy is changed, for modules that keep each major version
+in a subdirectory of the main branch. Relative directories in
+the copy's replace directives are adjusted to match. Dependencies
+are not checked, as none can import the new version yet. For
+example:
+
+	govers release -subdir v2
+
+The incompatible subcommand finds every module required at a
++incompatible version by any of the tree's go.mod files and,
+for each one that has since published a module with a /vN major
+version suffix (at the same or the next major version), asks
+the module proxy for its latest version, changes the imports to
+use the new module path and updates the go.mod requirements,
+all in a single pass. If module paths are given, only those
+modules are moved.
+
+The module proxies are queried as the go command queries them:
+each proxy listed in GOPROXY (as set in the environment or by
+"go env -w") is tried in turn, moving on to the next when the
+module is not found or, after a proxy followed by "|", on any
+error. Proxies may be given as file:// URLs. As govers talks
+only to module proxies, the search stops at "direct", and
+GOPROXY=off prevents any queries. Modules matched by GONOPROXY
+(or GOPRIVATE, when that is unset) are never looked up, so that
+their paths are not sent to a public proxy.
+
+With -verify-sum, the go.mod file and source of each version
+that would be required are downloaded from the proxies and their
+hashes checked against those that the checksum database (as named
+by GOSUMDB) records for it, so that a migration cannot require a
+version that the go command would refuse. Modules matched by
+GONOSUMDB (or GOPRIVATE) are not checked. Unlike the go command,
+govers does not check the database's signed tree itself.
+
+The migrate subcommand makes well-known migrations by name,
+so that their patterns and new paths need not be worked out
+by hand. For example, the following moves from gopkg.in/yaml.v2
+to gopkg.in/yaml.v3 and from gopkg.in/mgo.v2 to its maintained
+fork:
+
+	govers migrate yaml mgo
+
+Run "govers migrate -list" to see the available presets. More
+may be defined in the file govers/presets within the user's
+configuration directory (for example ~/.config/govers/presets)
+or in a file named with the -presets flag. Each line of such a
+file holds a preset name followed by its new-package-path
+arguments, any module requirements the migration needs written
+as module-path@version, and an optional description after a '#':
+
+	# name	arguments	# description
+	errors	github\.com/pkg/errors=example.com/errors	# our errors package
+
+The migration is checked as well as made: the changed packages
+are built and tested, and if that fails, all the changes are
+undone, leaving a list of the failures. This turns the usual loop
+of rewriting, building and reverting by hand into one command:
+
+	govers migrate yaml
+
+Use -verify=false to make the changes without checking them, as
+the -n, -plan, -patch and -o flags also do. The rewrite subcommand
+and the others that change imports, such as bump and incompatible,
+check their changes in the same way when given -verify.
 
 If the pattern is not specified with the -m flag, it is derived from
 new-package-path and matches any prefix that is the same in all but
 version.  A version is defined to be an element within a package path
-that matches the regular expression "(/|\.)v[0-9.]+(-unstable)?".
+that matches the regular expression "(/|\.)v[0-9]+(\.[0-9]+)*(-unstable)?".
+
+Import paths are normalized before they are matched, so that
+forms such as "gopkg.in/tomb.v2/" or "gopkg.in/./tomb.v2" are
+matched as "gopkg.in/tomb.v2", and changed imports are always
+written in canonical form. When the tree is on a case-insensitive
+file system, where imports differing only in case name the same
+package, paths are matched without regard to case too.
+
+The -M flag carves exceptions out of the pattern: imports
+whose leading path elements match it are left alone. For
+example, this moves everything under github.com/old but
+its internal packages:
+
+	govers -m github.com/old -M 'github.com/old/internal' github.com/new
+
+The -import-group flag guards against a pattern broad enough
+to match imports that should be left alone, such as internal
+mirrors of a module kept in their own import group. This changes
+imports of yaml.v2 only in the groups holding a gopkg.in import,
+leaving alone a mirror such as example.com/mirror/yaml.v2 kept
+in a group of its own:
+
+	govers -import-group gopkg.in -m '(gopkg\.in|example\.com/mirror)/yaml\.v2' gopkg.in/yaml.v3
 
 The govers command will also check (unless the -d flag is given)
 that no (recursive) dependencies would be changed if the same govers
-command was run on them. If they would, govers will fail and do nothing.
+command was run on them. If they would, govers will fail and do nothing,
+printing the commands that can be used to fix each offending
+dependency, grouped by repository.
+
+When the offending copy of the old version was found in a vendor
+directory, the report says so, naming the vendored directory
+and the direct dependency of the tree that brought it in, so
+that it is clear whether to re-vendor or to fix the dependency
+upstream.
+
+By default, directories below the current directory that
+contain their own go.mod file, such as example modules or
+vendored forks, are treated as separate modules and left
+alone, and a note is printed for each one. With the
+-all-modules flag, they are included: each module in the
+tree is checked separately, resolving its dependencies as
+the go command would when building that module, and a summary
+is printed showing which modules were fully migrated and which
+have remaining inconsistencies. In either case, a warning is
+also printed for each require line in a nested module's go.mod
+file that names a module whose path would be changed, even when
+that module's packages are excluded from the change.
+
+If the go command cannot resolve a module's dependency (for
+example because it is unavailable), its source is looked
+for in the directory named by a replace directive in the
+module's go.mod file, or in the module cache at the version
+selected from the module graph, so that dependencies are still
+checked when there is no GOPATH source tree. The graph is found
+from the go.mod files of the dependencies held in the module
+cache, choosing the highest version of each module that any
+of them requires, so that modules required only indirectly are
+found too.
+
+Outside modules, an import path with a major version element,
+such as example.com/lib/v2/sub, is resolved as the go command
+resolves it in GOPATH mode, whichever way the upstream module
+publishes its major versions: from the v2 subdirectory of the
+example.com/lib checkout when upstream keeps each major version
+in a subdirectory, or, when it keeps each on a branch, from the
+sub directory of the checkout if its go.mod file declares the
+module example.com/lib/v2. If the checkout holds another version
+of the module, the import error says so, rather than only that
+the package cannot be found.
+
+In modules, each module with a major version suffix that a run
+requires at a given version, with -require, the pin and get
+subcommands or a preset, is checked before anything is changed:
+its go.mod file at that version is looked for in the module cache
+and then on the module proxy, and the run fails if upstream
+publishes no such version, in a vN subdirectory or on a vN branch,
+listing the versions that are published, or if the go.mod file
+declares another module path. Modules that the current module
+replaces, and private ones, are not checked, and if the proxy
+cannot be queried the check is skipped with a warning.
 
 For example, say a new version of the tomb package is released.
 The old import path was gopkg.in/tomb.v2, and we want
@@ -106,10 +1813,45 @@ is consistently using the same version throughout.
 
 var (
 	match          = flag.String("m", "", "change imports with a matching prefix")
+	notMatch       = flag.String("M", "", "leave imports alone if a leading sequence of their elements matches the given `regexp`, even if they match the pattern")
 	noEdit         = flag.Bool("n", false, "don't make any changes; perform checks only")
 	noDependencies = flag.Bool("d", false, "suppress dependency checking")
+	deep           = flag.Bool("deep", false, "rewrite writable dependencies rather than failing")
+	allTests       = flag.Bool("t", false, "check test imports of dependencies too")
+	skipGenerated  = flag.Bool("skip-generated", false, "don't change generated files")
+	importGroup    = flag.String("import-group", "", "change only imports in the import groups selected by `name`: third-party, or an import path prefix")
+	isolate        = flag.Bool("isolate", false, "change modules that pass their checks even if others fail")
+	allModules     = flag.Bool("all-modules", false, "check and change modules nested within the tree too")
+	hidden         = flag.Bool("hidden", false, "search directories whose names start with a dot too")
+	templates      = flag.Bool("templates", false, "change import paths in .tmpl and .gotmpl template files too")
+	buildTags      = flag.String("tags", "", "comma-separated list of build tags to use")
+	versFlag       = flag.String("vers", "", "regular expression matching a version element")
+	review         = flag.Bool("review", false, "interactively review each change before it is made")
+	printPlan      = flag.Bool("plan", false, "print the changes as JSON rather than making them")
+	patchFile      = flag.String("patch", "", "write the changes to `file` as a patch for git am rather than making them")
+	explain        = flag.Bool("explain", false, "explain why each inconsistent path was reported")
+	generate       = flag.Bool("generate", false, "run go generate in changed packages after rewriting")
+	verify         = flag.Bool("verify", false, "build and test the changed packages after rewriting, undoing all changes if that fails (the default for migrate)")
+	requireVersion = flag.String("require", "", "require the given `version` of the new module in go.mod, adding its checksums to go.sum")
+	rewriterCmd    = flag.String("rewriter", "", "ask the given `program` how to change each import path")
+	parallel       = flag.Int("parallel", runtime.GOMAXPROCS(0), "work on up to `n` files at once")
+	scope          = flag.String("scope", "all", "change imports in test files (tests), other files (code) or all files (all)")
+	depCheck       = flag.String("dep-check", "error", "treat inconsistent dependencies as an error or, with warn, report them only")
+	depCheckDepth  = flag.Int("depcheck-depth", 0, "follow imports only `n` levels deep when checking dependencies (0 for no limit)")
+	directDeps     = flag.Bool("direct", false, "check only the direct dependencies (shorthand for -depcheck-depth 1)")
+	failFast       = flag.Bool("fail-fast", false, "stop at the first directory, file or package that cannot be processed")
+	keepGoing      = flag.Bool("keep-going", false, "carry on after files that cannot be changed, failing at the end")
+	strict         = flag.Bool("strict", false, "fail if any directory, file or package was skipped because it could not be processed")
 )
 
+var excludes, allowed, reportArgs stringsValue
+
+func init() {
+	flag.Var(&reportArgs, "report", "write a report of the changes in the given `format`, followed by =file to write it to a file rather than printing it in place of the changed packages (may be repeated)")
+	flag.Var(&excludes, "exclude", "don't change packages in directories matching the `pattern` (may be repeated)")
+	flag.Var(&allowed, "allow", "allow dependencies with the given import path `prefix` to use inconsistent paths (may be repeated)")
+}
+
 var cwd, _ = os.Getwd()
 
 func main() {
@@ -117,229 +1859,675 @@ func main() {
 		fmt.Printf("%s", help[1:])
 		os.Exit(2)
 	}
-	flag.Parse()
-	if flag.NArg() != 1 {
-		flag.Usage()
+	args := os.Args[1:]
+	if isVetTool(args) {
+		runVetTool()
+		return
+	}
+	fs, cmd := flag.CommandLine, lookupCommand("rewrite")
+	if len(args) > 0 {
+		if c := lookupCommand(args[0]); c != nil {
+			if c.name == "help" {
+				runHelp(args[1:])
+				return
+			}
+			cmd, args = c, args[1:]
+			fs = cmd.flagSet()
+		}
+	}
+	ctxt := setup(cmd, fs, args)
+	cmd.run(ctxt)
+	if ctxt.step != nil {
+		ctxt.recordStep()
 	}
-	newPackage := flag.Arg(0)
+	ctxt.exit(0)
+}
+
+// setup parses the command line arguments for cmd with fs,
+// applying any flags from the environment and the configuration
+// file, and returns the context to run the subcommand in.
+func setup(cmd *command, fs *flag.FlagSet, args []string) *context {
+	fs.Parse(append(envFlags(fs), args...))
 	cwd, err := os.Getwd()
 	if err != nil {
 		fatalf("cannot get working directory: %v", err)
 	}
-	var oldPackagePat *regexp.Regexp
-	if *match != "" {
-		oldPackagePat, err = regexp.Compile("^(" + *match + ")")
-		if err != nil {
-			fatalf("invalid match pattern: %v", err)
+	if *worktreeBranch != "" {
+		if *noEdit || *printPlan || *patchFile != "" || *outputDir != "" {
+			fatalf("-worktree cannot be used with -n, -plan, -patch or -o")
+		}
+		cwd = enterWorktree(cwd)
+	}
+	args = fs.Args()
+	cfg, err := findConfig(cwd)
+	if err != nil {
+		fatalf("cannot read configuration: %v", err)
+	}
+	if cfg != nil {
+		if cfg.disable {
+			fatalf("rewriting is disabled here by %s", cfg.path)
+		}
+		if err := cfg.apply(fs); err != nil {
+			fatalf("%v", err)
+		}
+		if len(args) == 0 && cmd.parseArgs == nil && *rewriterCmd == "" {
+			args = cfg.rewrites
+		}
+	}
+	if len(args) < 1 && !cmd.optionalArgs && *rewriterCmd == "" {
+		fs.Usage()
+	}
+	if cmd.verifies && *outputDir == "" {
+		verifySet := false
+		fs.Visit(func(f *flag.Flag) {
+			verifySet = verifySet || f.Name == "verify"
+		})
+		if !verifySet {
+			*verify = true
 		}
-	} else {
-		oldPackagePat = pathVersionPat(newPackage)
 	}
+	var step []string
+	if *recordFile != "" {
+		step = recordedStep(cmd, fs, args)
+	}
+	// A patch or worktree commit says how to make its changes
+	// in place, so the flag that asked for it is left out.
+	invocation := recordedStep(cmd, fs, args, "patch")
 	buildCtxt := build.Default
 	// BUG we ignore files that are ignored by the current build context
 	// if we don't set this flag, but if we do set it, the import fails.
 	// The solution is to avoid using build.Import but it's convenient
 	// at the moment.
 	//	buildCtxt.UseAllFiles = true
+	switch *scope {
+	case "tests", "code", "all":
+	default:
+		fatalf("invalid -scope %q; must be tests, code or all", *scope)
+	}
+	if *depCheck != "error" && *depCheck != "warn" {
+		fatalf("invalid -dep-check %q; must be error or warn", *depCheck)
+	}
+	if *depCheckDepth < 0 {
+		fatalf("invalid -depcheck-depth %d; must not be negative", *depCheckDepth)
+	}
+	if *directDeps {
+		*depCheckDepth = 1
+	}
+	if *failFast && *keepGoing {
+		fatalf("-fail-fast and -keep-going cannot be used together")
+	}
+	if *outputDir != "" && (*noEdit || *printPlan || *patchFile != "" || *verify || *generate) {
+		fatalf("-o cannot be used with -n, -plan, -patch, -verify or -generate")
+	}
+	if *eventsFile == "-" && *printPlan {
+		fatalf("-events - cannot be used with -plan, as both write to standard output")
+	}
+	buildCtxt.BuildTags = splitTags(*buildTags)
+	env, err := readGoEnv()
+	if err != nil {
+		logf("cannot read go environment: %v", err)
+	}
+	applyGoEnv(&buildCtxt, env)
 	ctxt := &context{
-		cwd:           cwd,
-		newPackage:    newPackage,
-		oldPackagePat: oldPackagePat,
-		buildCtxt:     &buildCtxt,
-		checked:       make(map[string]bool),
-		editPkgs:      make(map[string]*editPkg),
-	}
-	ctxt.walkDir(cwd)
-	for path := range ctxt.editPkgs {
-		ctxt.checkPackage(path, cwd)
-	}
-	if ctxt.failed {
-		os.Exit(1)
-	}
-	for path, ep := range ctxt.editPkgs {
-		if !ep.needsEdit {
-			continue
+		cwd:        cwd,
+		dir:        cwd,
+		buildCtxt:  buildCtxt,
+		changed:    make(map[*vers.Module]int),
+		step:       step,
+		invocation: invocation,
+		newTree:    worktree != nil,
+
+		overrideFiles: make(map[*vers.Override]string),
+	}
+	parseArgs := cmd.parseArgs
+	if parseArgs == nil {
+		parseArgs = (*context).parseRules
+	}
+	openEvents()
+	parseArgs(ctxt, args)
+	ctxt.parseReports()
+	ctxt.findOverrides(cfg)
+	if len(mirrors) > 0 {
+		ctxt.addMirrorRules()
+	}
+	if *vanity {
+		ctxt.addVanityRules()
+	}
+	if *fetch {
+		ctxt.fetchModules()
+	}
+	ctxt.parseExclude()
+	ctxt.parseRoots()
+	ctxt.parseRenames()
+	ctxt.parseFixers()
+	if len(ctxt.pins) > 0 {
+		ctxt.checkPinnedMajors()
+	}
+	if *verifySum {
+		ctxt.verifySums()
+	}
+	return ctxt
+}
+
+// parseRules sets ctxt.rules from the new-package-path
+// arguments, and ctxt.packages from any package patterns
+// that follow them.
+func (ctxt *context) parseRules(args []string) {
+	args = ctxt.parsePatterns(args)
+	if *rewriterCmd != "" {
+		if len(args) > 0 {
+			fatalf("-rewriter cannot be used with new-package-path arguments")
 		}
-		changed := false
-		for _, file := range ep.goFiles {
-			changed = ctxt.changeVersion(file) || changed
+		if *requireVersion != "" {
+			fatalf("-require cannot be used with -rewriter")
 		}
-		if changed {
-			fmt.Printf("%s\n", path)
+		m, err := newMapper(*rewriterCmd)
+		if err != nil {
+			fatalf("%v", err)
 		}
+		ctxt.mapper = m
+		return
+	}
+	if *match != "" && len(args) > 1 {
+		fatalf("-m cannot be used with more than one new-package-path; use regexp=new-package-path instead")
 	}
-	if ctxt.failed {
-		os.Exit(1)
+	if *requireVersion != "" && len(args) > 1 {
+		fatalf("-require cannot be used with more than one new-package-path")
 	}
+	if len(args) == 0 {
+		fatalf("no new-package-path given")
+	}
+	for _, arg := range args {
+		r, err := vers.ParseRule(arg, *match, *versFlag)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		ctxt.rules = append(ctxt.rules, r)
+		if *requireVersion != "" {
+			ctxt.pins = append(ctxt.pins, newPin(r.NewPackage, *requireVersion, r))
+		}
+	}
+	ctxt.addIncompatibleRules()
 }
 
-type editPkg struct {
-	goFiles   []string
-	needsEdit bool
+// parseExclude applies the -M pattern to each
+// of ctxt.rules and the rules of ctxt.overrides.
+func (ctxt *context) parseExclude() {
+	if *notMatch == "" {
+		return
+	}
+	if ctxt.mapper != nil {
+		fatalf("-M cannot be used with -rewriter")
+	}
+	pat, err := regexp.Compile("^(?:" + *notMatch + ")(/|$)")
+	if err != nil {
+		fatalf("invalid -M pattern: %v", err)
+	}
+	for _, r := range ctxt.rules {
+		r.Exclude = pat
+	}
+	for _, o := range ctxt.overrides {
+		for _, r := range o.Rules {
+			r.Exclude = pat
+		}
+	}
 }
 
-type context struct {
-	cwd           string
-	failed        bool
-	newPackage    string
-	oldPackagePat *regexp.Regexp
-	buildCtxt     *build.Context
-	checked       map[string]bool
-	editPkgs      map[string]*editPkg
+// parsePatterns sets ctxt.packages from the arguments that are
+// package patterns (relative directories such as ./cmd/...) and
+// returns the remaining arguments. When patterns are given, the
+// root of the tree becomes the root of the module containing
+// the current directory (see moduleRoot), so that the selected
+// packages are checked in the context of the whole module.
+func (ctxt *context) parsePatterns(args []string) []string {
+	var rest, patterns []string
+	for _, arg := range args {
+		if arg == "." || arg == ".." || strings.HasPrefix(arg, "./") || strings.HasPrefix(arg, "../") {
+			patterns = append(patterns, arg)
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	if len(patterns) == 0 {
+		return rest
+	}
+	root := moduleRoot(ctxt.cwd)
+	for _, pat := range patterns {
+		ctxt.packages = append(ctxt.packages, ctxt.relPattern(pat, root))
+	}
+	ctxt.dir = root
+	return rest
+}
+
+// relPattern returns the package pattern pat, which is relative
+// to the current directory, as a slash-separated pattern relative
+// to root, as vers.Checker.Packages requires.
+func (ctxt *context) relPattern(pat, root string) string {
+	dir, all := strings.CutSuffix(filepath.ToSlash(pat), "/...")
+	if strings.Contains(dir, "...") {
+		fatalf("unsupported package pattern %q; \"...\" may only appear at the end", pat)
+	}
+	rel, err := filepath.Rel(root, filepath.Join(ctxt.cwd, filepath.FromSlash(dir)))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		fatalf("package pattern %q is outside %s", pat, root)
+	}
+	rel = filepath.ToSlash(rel)
+	if all {
+		rel += "/..."
+	}
+	return rel
+}
+
+// moduleRoot returns the root of the module containing dir,
+// or of the repository containing it when it is not within
+// a module.
+func moduleRoot(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return repoRoot(dir)
+		}
+		d = parent
+	}
 }
 
-// walkDir walks all directories below path and
-// adds any packages to ctxt.editPkgs.
-func (ctxt *context) walkDir(path string) {
-	entries, err := ioutil.ReadDir(path)
+// newRewriter returns a Rewriter configured from the
+// command line flags, followed by the given options.
+func (ctxt *context) newRewriter(opts ...vers.Option) *vers.Rewriter {
+	if ctxt.mapper != nil {
+		opts = append([]vers.Option{vers.WithMapping(ctxt.mapper.mapPath)}, opts...)
+	}
+	return vers.NewRewriter(append([]vers.Option{
+		vers.WithDir(ctxt.dir),
+		vers.WithPackages(ctxt.packages...),
+		vers.WithRoots(ctxt.roots...),
+		vers.WithRules(ctxt.rules...),
+		vers.WithRenames(ctxt.renames...),
+		vers.WithFixers(ctxt.fixers...),
+		vers.WithBuildContext(&ctxt.buildCtxt),
+		vers.WithDryRun(*noEdit || *printPlan),
+		vers.WithTests(*allTests),
+		vers.WithExcludes(excludes...),
+		vers.WithAllowed(allowed...),
+		vers.WithOverrides(ctxt.overrides...),
+		vers.WithFoldCase(caseInsensitive(ctxt.dir)),
+		vers.WithDeep(*deep),
+		vers.WithoutDependencies(*noDependencies),
+		vers.WithMaxDepth(*depCheckDepth),
+		vers.WithoutFailing(*depCheck == "warn"),
+		vers.WithoutNestedModules(!*allModules),
+		vers.WithHidden(*hidden),
+		vers.WithTemplates(*templates),
+		vers.WithPackagesDriver(packagesDriver()),
+		vers.WithParallel(*parallel),
+		vers.WithCache(cacheDir()),
+		vers.WithImportGroup(*importGroup),
+		// Only -skip-generated needs to know which files are
+		// generated, and so their comments, and -import-group
+		// needs them to tell where each group starts.
+		vers.WithImportsOnly(!*skipGenerated && *importGroup == ""),
+		vers.WithLogf(logf),
+		vers.WithFailFast(*failFast),
+		vers.WithPhase(phaseFunc()),
+		vers.WithTracef(tracefFunc()),
+		vers.WithEvents(eventsFunc()),
+		vers.WithFetched(ctxt.fetched),
+	}, opts...)...)
+}
+
+// caseInsensitive reports whether dir is on a case-insensitive
+// file system, where it can also be found by a name that
+// differs only in case.
+func caseInsensitive(dir string) bool {
+	other := strings.Map(func(r rune) rune {
+		if unicode.IsUpper(r) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToUpper(r)
+	}, dir)
+	if other == dir {
+		return false
+	}
+	info, err := os.Stat(dir)
 	if err != nil {
-		logf("cannot read directory %q: %v", path, err)
-		return
+		return false
 	}
-	var ep editPkg
-	for _, entry := range entries {
-		if entry.IsDir() {
-			if !strings.HasPrefix(entry.Name(), ".") {
-				ctxt.walkDir(filepath.Join(path, entry.Name()))
-			}
+	otherInfo, err := os.Stat(other)
+	return err == nil && os.SameFile(info, otherInfo)
+}
+
+// reportFindings logs each inconsistent path found,
+// explaining it if -explain was given, followed by
+// those waived by -allow.
+func (ctxt *context) reportFindings() {
+	warning := ""
+	if *depCheck == "warn" {
+		warning = "warning: "
+	}
+	for _, f := range ctxt.result.Findings {
+		if f.VendorDir != "" {
+			logf("%spackage %q is using inconsistent path %q, vendored at %s (brought in by %s)", warning, f.Importer, f.ImportPath, ctxt.relPath(f.VendorDir), f.TopLevel)
 		} else {
-			if strings.HasSuffix(entry.Name(), ".go") {
-				ep.goFiles = append(ep.goFiles, filepath.Join(path, entry.Name()))
-			}
+			logf("%spackage %q is using inconsistent path %q", warning, f.Importer, f.ImportPath)
+		}
+		if *explain {
+			ctxt.explain(f)
 		}
 	}
-	pkg, err := ctxt.buildCtxt.Import(".", path, build.FindOnly)
-	if err != nil {
-		// ignore directories that don't correspond to packages.
-		return
+	for _, f := range ctxt.result.Waived {
+		logf("package %q is using inconsistent path %q (waived by -allow)", f.Importer, f.ImportPath)
+	}
+}
+
+// reportSkippedModules notes each nested module
+// left alone because -all-modules was not given.
+func (ctxt *context) reportSkippedModules() {
+	for _, dir := range ctxt.result.SkippedModules {
+		logf("not changing nested module in %s; use -all-modules to include it", ctxt.relPath(dir))
 	}
-	ctxt.editPkgs[pkg.ImportPath] = &ep
 }
 
-// checkPackage checks all go files in the given
-// package, and all their dependencies.
-func (ctxt *context) checkPackage(path, fromDir string) {
-	if path == "C" {
+// reportStaleRequires warns about each requirement in a
+// nested module's go.mod file on a module whose path
+// would be changed.
+func (ctxt *context) reportStaleRequires() {
+	for _, r := range ctxt.result.StaleRequires {
+		logf("%s: warning: nested module still requires %s, not %s: %s", r.Pos, r.Path, r.Expected, r.Text)
+	}
+}
+
+// runRewrite checks the tree and changes its
+// import paths.
+func runRewrite(ctxt *context) {
+	// A tree created by this run is not shared with any other.
+	if !*noEdit && !*printPlan && *patchFile == "" && *outputDir == "" && !ctxt.newTree {
+		ctxt.lockTree()
+	}
+	rw := ctxt.newRewriter()
+	result, err := rw.Scan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.result = result
+	ctxt.reportFindings()
+	ctxt.reportOverrides()
+	ctxt.reportSkippedModules()
+	ctxt.reportStaleRequires()
+	if ctxt.failed() && !*isolate {
+		ctxt.writeReports(&vers.Plan{Result: result})
+		ctxt.printSummary(false)
+		ctxt.printRemediation()
+		ctxt.exit(1)
+	}
+	plan, err := rw.Plan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.filterPlan(plan)
+	if *vulnCheck {
+		ctxt.checkVulns(rw, plan)
+	}
+	if *printPlan {
+		ctxt.reportGenerated()
+		if err := writePlan(os.Stdout, plan); err != nil {
+			fatalf("cannot write plan: %v", err)
+		}
+		if ctxt.failed() {
+			ctxt.exit(1)
+		}
 		return
 	}
-	if ctxt.checked[path] {
-		// The package has already been, is or being, checked
+	if *patchFile != "" {
+		ctxt.reportGenerated()
+		ctxt.writePatch(rw, plan)
+		ctxt.printRemediation()
+		if ctxt.failed() {
+			ctxt.exit(1)
+		}
 		return
 	}
-	pkg, err := ctxt.buildCtxt.Import(path, fromDir, 0)
-	ctxt.checked[pkg.ImportPath] = true
-	if err != nil {
-		if _, ok := err.(*build.NoGoError); !ok {
-			logf("cannot import %q from %q: %v", path, fromDir, err)
+	if *outputDir != "" {
+		ctxt.writeOutputDir(rw, plan)
+		ctxt.reportGenerated()
+		ctxt.printSummary(true)
+		ctxt.writeReports(plan)
+		ctxt.printRemediation()
+		if ctxt.failed() {
+			ctxt.exit(1)
 		}
 		return
 	}
-	ep := ctxt.editPkgs[path]
-	// N.B. is it worth eliminating duplicates here?
-	var allImports []string
-	allImports = append(allImports, pkg.Imports...)
-	if ctxt.editPkgs[path] != nil {
-		// The package is in our set of root packages so
-		// add testing imports too.
-		allImports = append(allImports, pkg.TestImports...)
-		allImports = append(allImports, pkg.XTestImports...)
-	}
-	for _, impPath := range allImports {
-		// Import the package to find out its absolute path
-		// including vendor directories before applying the
-		// rewrite.
-		impPkg, _ := ctxt.buildCtxt.Import(impPath, pkg.Dir, 0)
-		if err != nil {
+	var j *journal
+	if *verify && !*noEdit {
+		j = newJournal()
+		if err := j.recordPlan(ctxt, plan); err != nil {
+			fatalf("cannot record files before changing them: %v", err)
+		}
+	}
+	ctxt.recordDiffs(rw, plan)
+	applyErr := rw.Apply(plan)
+	var changed, external []*vers.Package
+	var last *vers.Package
+	for _, edit := range plan.Files {
+		p := edit.Package
+		if len(edit.Changes) == 0 || p == last {
 			continue
 		}
-		if p := ctxt.fixPath(impPkg.ImportPath); p != impPkg.ImportPath {
-			if ep == nil {
-				logf("package %q is using inconsistent path %q", pkg.ImportPath, impPkg.ImportPath)
-				ctxt.failed = true
-				continue
-			}
-			ep.needsEdit = true
-			impPath = p
+		last = p
+		changed = append(changed, p)
+		if ctxt.printsPackages() {
+			fmt.Printf("%s\n", p.ImportPath)
 		}
-		if !*noDependencies {
-			ctxt.checkPackage(impPath, impPkg.Dir)
+		ctxt.changed[p.Module]++
+		if p.External {
+			external = append(external, p)
 		}
 	}
-}
-
-var printConfig = printer.Config{
-	Mode:     printer.TabIndent | printer.UseSpaces,
-	Tabwidth: 8,
-}
-
-// changeVersion changes the named go file to
-// import the new version.
-func (ctxt *context) changeVersion(path string) bool {
-	fset := token.NewFileSet()
-	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
-	if err != nil {
-		logf("cannot parse %q: %v", path, err)
+	for _, p := range external {
+		logf("edited external package %q in %s", p.ImportPath, p.Dir)
 	}
-	changed := false
-	for _, ispec := range f.Imports {
-		impPath, err := strconv.Unquote(ispec.Path.Value)
-		if err != nil {
-			panic(err)
+	ctxt.reportGenerated()
+	ctxt.printSummary(true)
+	if applyErr != nil {
+		switch {
+		case j != nil:
+			logf("%v", applyErr)
+			ctxt.undoChanges(j)
+		case !*keepGoing:
+			fatalf("%v", applyErr)
+		default:
+			logf("%v; carrying on because of -keep-going", applyErr)
 		}
-		if p := ctxt.fixPath(impPath); p != impPath {
-			ispec.Path.Value = strconv.Quote(p)
-			changed = true
+	}
+	if len(ctxt.pins) > 0 && !ctxt.requirePins() {
+		if j != nil {
+			ctxt.undoChanges(j)
 		}
+		ctxt.exit(1)
 	}
-	if !changed || *noEdit {
-		return changed
+	if *generate && !*noEdit && !ctxt.runGenerate(changed) {
+		if j != nil {
+			ctxt.undoChanges(j)
+		}
+		ctxt.exit(1)
 	}
-	out, err := os.Create(path)
-	if err != nil {
-		logf("cannot create file: %v", err)
+	if j != nil && !ctxt.verifyChanges(changed) {
+		ctxt.undoChanges(j)
 	}
-	defer out.Close()
-	w := bufio.NewWriter(out)
-	if err := printConfig.Fprint(w, fset, f); err != nil {
-		logf("cannot write file: %v", err)
+	ctxt.writeReports(plan)
+	if worktree != nil && !ctxt.failed() && applyErr == nil {
+		ctxt.commitWorktree(plan)
 	}
-	if err := w.Flush(); err != nil {
-		logf("cannot write file: %v", err)
+	ctxt.reportIncompatible()
+	ctxt.printRemediation()
+	if ctxt.failed() || applyErr != nil {
+		ctxt.exit(1)
 	}
-	return true
 }
 
-func (ctxt *context) fixPath(p string) string {
-	loc := ctxt.oldPackagePat.FindStringSubmatchIndex(p)
-	if loc == nil {
-		return p
+// failed reports whether the inconsistent dependencies
+// found should cause failure, as they do unless
+// -dep-check=warn is given.
+func (ctxt *context) failed() bool {
+	return ctxt.result.Failed() && *depCheck == "error"
+}
+
+// exit prints a report of any problems that caused parts of
+// the tree to be skipped, all together so that none is missed
+// among the rest of the output, and exits with the given status,
+// or with status 1 if there were any problems and -strict is set.
+func (ctxt *context) exit(code int) {
+	var problems []*vers.Problem
+	if ctxt.result != nil {
+		problems = ctxt.result.Problems
 	}
-	i := loc[3]
-	if p[0:i] != ctxt.newPackage {
-		p = ctxt.newPackage + p[i:]
+	if code == 0 && *strict && len(problems) > 0 {
+		code = 1
 	}
-	return p
+	if len(problems) > 0 {
+		what := "1 problem"
+		if len(problems) > 1 {
+			what = fmt.Sprintf("%d problems", len(problems))
+		}
+		logf("could not process everything; %s:", what)
+		for _, p := range problems {
+			fmt.Fprintf(os.Stderr, "\t%v\n", p)
+		}
+	}
+	if events != nil {
+		events.close(code, "")
+	}
+	worktree.remove()
+	os.Exit(code)
 }
 
-const versPat = `[/|\.]v[0-9]+(-unstable)?`
-
-// pathVersionPat returns a pattern that will match any
-// package path that's the same except possibly
-// the version number.
-func pathVersionPat(p string) *regexp.Regexp {
-	versRe := regexp.MustCompile(versPat + "(/|$)")
-	if !versRe.MatchString(p) {
-		fatalf("%q is not versioned", p)
-	}
-	// Use an intermediate step so that we can use QuoteMeta after
-	// matching against versPat.  (versPat won't match quoted
-	// metacharacters).
-	// Note that  '#' is an invalid character in an import path
-	p = versRe.ReplaceAllString(p, "#")
-	p = regexp.QuoteMeta(p)
-	// BUG doesn't match "foo/v0/v1/bar", but do we care?
-	p = "^(" + strings.Replace(p, "#", versPat, -1) + ")(/|$)"
-	return regexp.MustCompile(p)
+type context struct {
+	cwd string
+
+	// newTree holds whether the tree was created by this
+	// run, as it is for -worktree and the patch subcommand.
+	newTree bool
+
+	// step holds the operation to record
+	// in the recipe named by -record.
+	step []string
+
+	// invocation holds the operation being run, in the same
+	// form as step, for the message of a patch or worktree
+	// commit.
+	invocation []string
+
+	// dir holds the root of the tree to check, and
+	// packages holds the patterns selecting the packages
+	// within it to change, as given by parsePatterns.
+	dir      string
+	packages []string
+
+	// roots holds the patterns given by -roots,
+	// relative to dir.
+	roots []string
+
+	rules     vers.Rules
+	buildCtxt build.Context
+	result    *vers.Result
+
+	// overrides holds the rules for subdirectories
+	// of the tree found by findOverrides, and
+	// overrideFiles the file each was read from.
+	overrides     []*vers.Override
+	overrideFiles map[*vers.Override]string
+
+	// reports holds the reports requested with -report,
+	// and diffs holds the diff of the changes to each file,
+	// keyed by path, as recorded for them by recordDiffs.
+	reports []reportSpec
+	diffs   map[string]string
+
+	// fetched holds the versions of the modules
+	// downloaded by -fetch, keyed by module path.
+	fetched map[string]string
+
+	// pins holds the module versions given
+	// to the pin subcommand or -require.
+	pins []*pin
+
+	// incompatible holds the paths of modules required
+	// at +incompatible versions whose imports are being
+	// changed to use a major version suffix.
+	incompatible []string
+
+	// checkOnly holds whether the tree is being
+	// checked without any changes being made.
+	checkOnly bool
+
+	// changed holds the number of packages changed
+	// in each module.
+	changed map[*vers.Module]int
+
+	// generated holds any generated files that
+	// were left unchanged because of -skip-generated.
+	generated []string
+
+	// reviewer holds the state of the interactive
+	// review started by the -review flag.
+	reviewer reviewer
+
+	// renames holds the identifiers to rename,
+	// as given by -rename.
+	renames []*vers.Rename
+
+	// fixers holds the fixers to apply,
+	// as given by -fix.
+	fixers []*vers.Fixer
+
+	// mapper, if non-nil, holds the external program
+	// started by the -rewriter flag, which is used
+	// in place of rules.
+	mapper *mapper
+}
+
+// inScope reports whether the file with the given
+// path is within the scope given with -scope.
+func inScope(path string) bool {
+	switch isTest := strings.HasSuffix(path, "_test.go"); *scope {
+	case "tests":
+		return isTest
+	case "code":
+		return !isTest
+	}
+	return true
+}
+
+// filterPlan removes the changes from the plan that
+// should not be made: those to generated files when
+// -skip-generated is given, those to files outside
+// the scope given with -scope, and those rejected
+// during an interactive review.
+func (ctxt *context) filterPlan(plan *vers.Plan) {
+	for _, edit := range plan.Files {
+		if *skipGenerated && edit.Generated {
+			ctxt.generated = append(ctxt.generated, edit.Path)
+			edit.Changes = nil
+			continue
+		}
+		if !inScope(edit.Path) {
+			edit.Changes = nil
+			continue
+		}
+		if !*review || *noEdit || *printPlan {
+			continue
+		}
+		var accepted []*vers.ImportChange
+		for _, c := range edit.Changes {
+			if ctxt.reviewChange(c) {
+				accepted = append(accepted, c)
+			}
+		}
+		edit.Changes = accepted
+	}
 }
 
 func logf(f string, a ...interface{}) {
@@ -348,5 +2536,9 @@ func logf(f string, a ...interface{}) {
 
 func fatalf(f string, a ...interface{}) {
 	logf(f, a...)
+	if events != nil {
+		events.close(2, fmt.Sprintf(f, a...))
+	}
+	worktree.remove()
 	os.Exit(2)
 }
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// needsDiffs reports whether any of the reports requested
+// with -report show the changes to each file, so that
+// recordDiffs must be called before they are made.
+func (ctxt *context) needsDiffs() bool {
+	for _, r := range ctxt.reports {
+		if r.format == "html" {
+			return true
+		}
+	}
+	return false
+}
+
+// recordDiffs records, for the HTML report, the diff of the
+// changes to each file in plan. It must be called before the
+// changes are applied.
+func (ctxt *context) recordDiffs(rw *vers.Rewriter, plan *vers.Plan) {
+	if !ctxt.needsDiffs() {
+		return
+	}
+	ctxt.diffs = make(map[string]string)
+	for _, edit := range plan.Files {
+		old, new, err := rw.Content(edit)
+		if err != nil {
+			logf("cannot show changes for the report: %v", err)
+			continue
+		}
+		name := filepath.ToSlash(ctxt.relPath(edit.Path))
+		ctxt.diffs[edit.Path] = unifiedDiff("a/"+name, "b/"+name, old, new)
+	}
+}
+
+// htmlPackage holds a changed package as shown in the HTML report.
+type htmlPackage struct {
+	ImportPath string
+	Files      []htmlFile
+}
+
+type htmlFile struct {
+	Name  string
+	Lines []htmlDiffLine
+}
+
+// htmlDiffLine holds a line of a diff and the class
+// that it is shown with.
+type htmlDiffLine struct {
+	Class, Text string
+}
+
+type htmlPathChange struct {
+	Old, New string
+}
+
+// writeHTMLReport writes a self-contained HTML page describing the
+// changes in plan, as written by -report html, so that a migration
+// can be reviewed in a browser: a summary, the import paths
+// changed, the changes to each package, the inconsistent
+// dependencies found and the work that remains.
+func (ctxt *context) writeHTMLReport(w io.Writer, plan *vers.Plan) error {
+	data := struct {
+		Verb      string
+		Files     int
+		Imports   int
+		Paths     []htmlPathChange
+		Packages  []htmlPackage
+		Findings  []*vers.Finding
+		Remaining []string
+	}{
+		Verb:      "Changed",
+		Remaining: ctxt.markdownWarnings(),
+	}
+	if *noEdit || ctxt.checkOnly {
+		data.Verb = "Would change"
+	}
+	seenPath := make(map[htmlPathChange]bool)
+	var last *vers.Package
+	for _, edit := range plan.Files {
+		if len(edit.Changes) == 0 {
+			continue
+		}
+		if edit.Package != last {
+			data.Packages = append(data.Packages, htmlPackage{ImportPath: edit.Package.ImportPath})
+			last = edit.Package
+		}
+		data.Files++
+		data.Imports += len(edit.Changes)
+		for _, c := range edit.Changes {
+			pc := htmlPathChange{c.Old, c.New}
+			if !seenPath[pc] {
+				seenPath[pc] = true
+				data.Paths = append(data.Paths, pc)
+			}
+		}
+		f := htmlFile{
+			Name: ctxt.relPath(edit.Path),
+		}
+		for _, line := range strings.SplitAfter(ctxt.diffs[edit.Path], "\n") {
+			if line == "" {
+				continue
+			}
+			class := ""
+			switch {
+			case strings.HasPrefix(line, "---"), strings.HasPrefix(line, "+++"):
+				class = "file"
+			case strings.HasPrefix(line, "@@"):
+				class = "hunk"
+			case strings.HasPrefix(line, "-"):
+				class = "del"
+			case strings.HasPrefix(line, "+"):
+				class = "add"
+			}
+			f.Lines = append(f.Lines, htmlDiffLine{class, line})
+		}
+		pkg := &data.Packages[len(data.Packages)-1]
+		pkg.Files = append(pkg.Files, f)
+	}
+	sort.Slice(data.Paths, func(i, j int) bool {
+		return data.Paths[i].Old < data.Paths[j].Old
+	})
+	data.Findings = plan.Result.Findings
+	return htmlReportTemplate.Execute(w, data)
+}
+
+// count returns n followed by noun,
+// made plural if n is not one.
+func count(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// codeSpans returns the Markdown text s as HTML, with each
+// span quoted in backquotes shown as code.
+func codeSpans(s string) template.HTML {
+	var buf strings.Builder
+	for i, part := range strings.Split(s, "`") {
+		part = template.HTMLEscapeString(part)
+		if i%2 == 1 {
+			part = "<code>" + part + "</code>"
+		}
+		buf.WriteString(part)
+	}
+	return template.HTML(buf.String())
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"codeSpans": codeSpans,
+	"count":     count,
+	"join":      strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>govers report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.2em 0.6em; text-align: left; }
+code, pre { font-family: monospace; }
+pre { background: #f6f8fa; padding: 0.5em; overflow-x: auto; }
+.add { background: #e6ffec; }
+.del { background: #ffebe9; }
+.hunk { color: #6f42c1; }
+.file { font-weight: bold; }
+summary { cursor: pointer; }
+</style>
+</head>
+<body>
+<h1>govers report</h1>
+<h2>Summary</h2>
+<p>{{.Verb}} {{count .Imports "import"}} in {{count .Files "file"}} in {{count (len .Packages) "package"}}.
+{{- with .Findings}} Found {{count (len .) "inconsistent import"}} in dependencies.{{end}}
+{{- with .Remaining}} {{count (len .) "item"}} of work remaining.{{end}}</p>
+{{- with .Paths}}
+<h2>Import paths</h2>
+<table>
+<tr><th>Old path</th><th>New path</th></tr>
+{{- range .}}
+<tr><td><code>{{.Old}}</code></td><td><code>{{.New}}</code></td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- with .Packages}}
+<h2>Packages</h2>
+{{- range .}}
+<details>
+<summary><code>{{.ImportPath}}</code> ({{count (len .Files) "file"}})</summary>
+{{- range .Files}}
+<pre>
+{{- range .Lines}}<span{{with .Class}} class="{{.}}"{{end}}>{{.Text}}</span>{{end -}}
+</pre>
+{{- end}}
+</details>
+{{- end}}
+{{- end}}
+{{- with .Findings}}
+<h2>Dependency findings</h2>
+<table>
+<tr><th>Package</th><th>Inconsistent path</th><th>Expected path</th><th>Imported via</th></tr>
+{{- range .}}
+<tr><td><code>{{.Importer}}</code></td><td><code>{{.ImportPath}}</code></td><td><code>{{.Expected}}</code></td><td><code>{{join .Chain " → "}}</code></td></tr>
+{{- end}}
+</table>
+{{- end}}
+{{- with .Remaining}}
+<h2>Remaining work</h2>
+<ul>
+{{- range .}}
+<li>{{codeSpans .}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// modRequirement holds a requirement found
+// in one of the tree's go.mod files.
+type modRequirement struct {
+	gomod         string
+	path, version string
+}
+
+// treeRequirements returns all the requirements in the go.mod
+// files in and below dir, and in the go.mod file of the module
+// containing dir.
+func treeRequirements(dir string) []modRequirement {
+	var files []string
+	for d := dir; ; {
+		gomod := filepath.Join(d, "go.mod")
+		if _, err := os.Stat(gomod); err == nil {
+			if d != dir {
+				files = append(files, gomod)
+			}
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && path != dir && strings.HasPrefix(d.Name(), ".") && (!*hidden || contains(vcsDirs, d.Name())) {
+			return filepath.SkipDir
+		}
+		if !d.IsDir() && d.Name() == "go.mod" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	var reqs []modRequirement
+	for _, gomod := range files {
+		data, err := os.ReadFile(gomod)
+		if err != nil {
+			continue
+		}
+		for _, r := range parseGoMod(data).requires() {
+			reqs = append(reqs, modRequirement{
+				gomod:   gomod,
+				path:    r.path,
+				version: r.version,
+			})
+		}
+	}
+	return reqs
+}
+
+var slashMajorPat = regexp.MustCompile(`^(.+)/v([0-9]+)$`)
+
+// addIncompatibleRules looks for rules that move to a module
+// with a /vN major version suffix whose unsuffixed path is
+// required by one of the tree's modules at a +incompatible
+// version, as happens when a project that published v2 or
+// later without a go.mod file adopts semantic import versioning.
+// Such imports carry no version element, so for each one a
+// rule is added that changes the unsuffixed path too.
+func (ctxt *context) addIncompatibleRules() {
+	var reqs []modRequirement
+	var added vers.Rules
+	for _, r := range ctxt.rules {
+		m := slashMajorPat.FindStringSubmatch(r.NewPackage)
+		if m == nil {
+			continue
+		}
+		if reqs == nil {
+			reqs = treeRequirements(ctxt.cwd)
+		}
+		base := m[1]
+		found := false
+		for _, req := range reqs {
+			if req.path != base || !strings.HasSuffix(req.version, "+incompatible") {
+				continue
+			}
+			found = true
+			logf("%s requires %s %s; imports of %s will be changed to %s", ctxt.relPath(req.gomod), req.path, req.version, base, r.NewPackage)
+		}
+		if !found {
+			continue
+		}
+		added = append(added, &vers.Rule{
+			Arg:           r.Arg,
+			NewPackage:    r.NewPackage,
+			OldPackagePat: regexp.MustCompile("^(" + regexp.QuoteMeta(base) + ")(/|$)"),
+		})
+		ctxt.incompatible = append(ctxt.incompatible, base)
+	}
+	// The added rules come last so that the rule
+	// for the suffixed path is found first.
+	ctxt.rules = append(ctxt.rules, added...)
+}
+
+// reportIncompatible prints guidance for any +incompatible
+// requirements that remain after rewriting because no
+// version was given with -require.
+func (ctxt *context) reportIncompatible() {
+	if len(ctxt.incompatible) == 0 || len(ctxt.pins) > 0 {
+		return
+	}
+	for _, base := range ctxt.incompatible {
+		r, _ := ctxt.rules.Find(base)
+		logf("go.mod files still require %s at a +incompatible version; use -require to replace the requirement, or run \"go get %s\" in each module", base, r.NewPackage)
+	}
+}
+
+// relPath returns path relative to the current
+// directory if it is within it.
+func (ctxt *context) relPath(path string) string {
+	if rel, err := filepath.Rel(ctxt.cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// parseIncompatible sets ctxt.rules and ctxt.pins to move every
+// module required at a +incompatible version by any of the
+// tree's go.mod files to the earliest module with a major version
+// suffix that has since been published, at its latest version.
+// If args are given, only the named modules are considered.
+func (ctxt *context) parseIncompatible(args []string) {
+	proxy := newGoProxy()
+	if !proxy.usable() {
+		fatalf("the incompatible subcommand requires a module proxy, but GOPROXY does not name one")
+	}
+	seen := make(map[string]bool)
+	for _, req := range treeRequirements(ctxt.cwd) {
+		if !strings.HasSuffix(req.version, "+incompatible") || seen[req.path] {
+			continue
+		}
+		seen[req.path] = true
+		if len(args) > 0 && !contains(args, req.path) {
+			continue
+		}
+		major, err := strconv.Atoi(strings.SplitN(strings.TrimPrefix(req.version, "v"), ".", 2)[0])
+		if err != nil {
+			continue
+		}
+		newPath, private := "", false
+		// A project adopting modules often does so
+		// with its next major version.
+		for n := major; n <= major+1 && !private; n++ {
+			p := fmt.Sprintf("%s/v%d", req.path, n)
+			ok, err := proxy.published(p)
+			if errors.Is(err, errPrivate) {
+				private = true
+				continue
+			}
+			if err != nil {
+				fatalf("cannot query module proxy: %v", err)
+			}
+			if ok {
+				newPath = p
+				break
+			}
+		}
+		if private {
+			logf("%s %s: private module (matched by GONOPROXY or GOPRIVATE), so not looked up", req.path, req.version)
+			continue
+		}
+		if newPath == "" {
+			logf("%s %s: no module with a major version suffix has been published", req.path, req.version)
+			continue
+		}
+		version, err := proxy.latestVersion(newPath)
+		if err != nil {
+			fatalf("cannot query module proxy: %v", err)
+		}
+		r, err := vers.ParseRule(newPath, "", *versFlag)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		ctxt.rules = append(ctxt.rules, r)
+		ctxt.pins = append(ctxt.pins, newPin(newPath, version, r))
+	}
+	if len(ctxt.rules) == 0 {
+		logf("no +incompatible requirements to migrate")
+		os.Exit(0)
+	}
+	ctxt.addIncompatibleRules()
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// junitSuites holds a report as written by -report junit,
+// in the JUnit XML format read by CI systems such as
+// Jenkins and GitLab.
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Name     string       `xml:"name,attr"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// writeJUnitReport writes a report of the check in the JUnit
+// XML format, as printed by -report junit: a test suite for each
+// module, holding a test case for each package in the tree that
+// was checked. A package fails if it depends on a package using
+// inconsistent paths (unless -dep-check=warn is given) or, when
+// no changes are being made, if any of its imports would change.
+func (ctxt *context) writeJUnitReport(w io.Writer, plan *vers.Plan) error {
+	problems := make(map[*vers.Package][]string)
+	pkgs := make(map[string]*vers.Package)
+	for _, p := range plan.Result.Packages {
+		pkgs[p.ImportPath] = p
+	}
+	if *depCheck == "error" {
+		for _, f := range plan.Result.Findings {
+			if p := pkgs[f.Chain[0]]; p != nil {
+				problems[p] = append(problems[p], fmt.Sprintf("%s: dependency %q uses inconsistent path %q, not %q (imported via %s)", f.Chain[0], f.Importer, f.ImportPath, f.Expected, strings.Join(f.Chain, " -> ")))
+			}
+		}
+	}
+	if ctxt.checkOnly || *noEdit {
+		for _, edit := range plan.Files {
+			for _, c := range edit.Changes {
+				problems[edit.Package] = append(problems[edit.Package], fmt.Sprintf("%s: import %q should be %q", c.Pos, c.Old, c.New))
+			}
+		}
+	}
+	out := junitSuites{
+		Name: "govers",
+	}
+	for _, mod := range plan.Result.Modules {
+		suite := junitSuite{
+			Name: mod.Name(),
+		}
+		for _, p := range plan.Result.Packages {
+			if p.Module != mod || p.External {
+				continue
+			}
+			tc := junitCase{
+				Name:      p.ImportPath,
+				ClassName: mod.Name(),
+			}
+			if msgs := problems[p]; len(msgs) > 0 {
+				msg := "1 inconsistent import"
+				if len(msgs) != 1 {
+					msg = fmt.Sprintf("%d inconsistent imports", len(msgs))
+				}
+				tc.Failure = &junitFailure{
+					Message: msg,
+					Type:    "govers",
+					Text:    strings.Join(msgs, "\n") + "\n",
+				}
+				suite.Failures++
+			}
+			suite.Cases = append(suite.Cases, tc)
+			suite.Tests++
+		}
+		if suite.Tests == 0 {
+			continue
+		}
+		out.Suites = append(out.Suites, suite)
+		out.Tests += suite.Tests
+		out.Failures += suite.Failures
+	}
+	data, err := xml.MarshalIndent(out, "", "\t")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
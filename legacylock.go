@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lockedProject holds a project pinned by a lock file
+// written by one of the dependency managers that
+// preceded modules.
+type lockedProject struct {
+	file string
+	line int
+	name string
+
+	// version holds the version or branch that the
+	// project is pinned at, and revision holds the
+	// revision that it resolved to.
+	version  string
+	revision string
+}
+
+// pinned returns the version or branch of the
+// project, or its revision if it has neither.
+func (p *lockedProject) pinned() string {
+	if p.version != "" {
+		return p.version
+	}
+	return p.revision
+}
+
+// lockMismatch holds an import whose major version
+// disagrees with the version pinned by a lock file.
+type lockMismatch struct {
+	project    *lockedProject
+	importer   string
+	importPath string
+}
+
+func (m *lockMismatch) String() string {
+	return fmt.Sprintf("%s:%d: %s is pinned at %s, but %s imports %s", m.project.file, m.project.line, m.project.name, m.project.pinned(), m.importer, m.importPath)
+}
+
+// legacyLockFiles maps the name of each lock file that
+// is checked to the function used to read it.
+var legacyLockFiles = map[string]func(file string) ([]*lockedProject, error){
+	"Gopkg.lock": readGopkgLock,
+	"glide.lock": readGlideLock,
+}
+
+// readLegacyLocks reads the lock files in the current directory,
+// or in the nearest parent directory up to the repository root
+// that holds any.
+func (ctxt *context) readLegacyLocks() []*lockedProject {
+	for dir := ctxt.cwd; ; {
+		var projects []*lockedProject
+		found := false
+		for name, read := range legacyLockFiles {
+			file := filepath.Join(dir, name)
+			if _, err := os.Stat(file); err != nil {
+				continue
+			}
+			found = true
+			ps, err := read(file)
+			if err != nil {
+				logf("cannot read lock file: %v", err)
+				continue
+			}
+			for _, p := range ps {
+				p.file = ctxt.relPath(p.file)
+			}
+			projects = append(projects, ps...)
+		}
+		if found || isRepoRoot(dir) {
+			return projects
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// readGopkgLock reads the projects from a Gopkg.lock file,
+// as written by dep. The file is TOML, of which only the
+// [[projects]] tables are read.
+func readGopkgLock(file string) ([]*lockedProject, error) {
+	var projects []*lockedProject
+	var p *lockedProject
+	err := scanLines(file, func(lineNum int, line string) {
+		if strings.HasPrefix(line, "[") {
+			p = nil
+			if line == "[[projects]]" {
+				p = &lockedProject{file: file}
+				projects = append(projects, p)
+			}
+			return
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if p == nil || !ok {
+			return
+		}
+		val, err := strconv.Unquote(strings.TrimSpace(val))
+		if err != nil {
+			return
+		}
+		switch strings.TrimSpace(key) {
+		case "name":
+			p.name, p.line = val, lineNum
+		case "version", "branch":
+			p.version = val
+		case "revision":
+			p.revision = val
+		}
+	})
+	return projects, err
+}
+
+// readGlideLock reads the projects from a glide.lock file.
+// The file is YAML, of which only the entries of the imports
+// and testImports lists are read. Glide records the revision
+// that each project resolved to in its version field, which
+// names a major version only when it is a tag.
+func readGlideLock(file string) ([]*lockedProject, error) {
+	var projects []*lockedProject
+	var p *lockedProject
+	err := scanLines(file, func(lineNum int, line string) {
+		if strings.HasPrefix(line, "- name:") {
+			p = &lockedProject{
+				file: file,
+				line: lineNum,
+				name: unquoteYAML(strings.TrimPrefix(line, "- name:")),
+			}
+			projects = append(projects, p)
+			return
+		}
+		if p != nil && strings.HasPrefix(line, "version:") {
+			p.revision = unquoteYAML(strings.TrimPrefix(line, "version:"))
+		}
+	})
+	return projects, err
+}
+
+// scanLines calls f with each non-blank line of the given
+// file that is not a comment, with surrounding white
+// space removed.
+func scanLines(file string, f func(lineNum int, line string)) error {
+	r, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	scan := bufio.NewScanner(r)
+	for lineNum := 1; scan.Scan(); lineNum++ {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f(lineNum, line)
+	}
+	return scan.Err()
+}
+
+func unquoteYAML(s string) string {
+	s = strings.TrimSpace(s)
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return strings.Trim(s, "'")
+}
+
+var (
+	// majorElemPat matches a major version element at the
+	// start of the rest of an import path after a project name.
+	majorElemPat = regexp.MustCompile(`^/v([0-9]+)(/|$)`)
+
+	// majorElemAnywherePat matches a major version
+	// element anywhere in an import path.
+	majorElemAnywherePat = regexp.MustCompile(`[./]v[0-9]+(/|$)`)
+
+	// pinnedMajorPat matches a version or branch that
+	// names a major version, such as v2, v2.1.0 or v2.x.
+	pinnedMajorPat = regexp.MustCompile(`^v([0-9]+)(\.|$)`)
+)
+
+// checkLegacyLocks returns the imports of the packages in the tree
+// whose major version disagrees with that pinned by a lock file: an
+// import of a project whose pinned version has a different major
+// version, or an import of a different major version of a project
+// in the same family as one that is pinned.
+func (ctxt *context) checkLegacyLocks() []*lockMismatch {
+	projects := ctxt.readLegacyLocks()
+	if len(projects) == 0 {
+		return nil
+	}
+	inTree := make(map[string]bool)
+	for _, p := range ctxt.result.Packages {
+		if !p.External {
+			inTree[p.ImportPath] = true
+		}
+	}
+	var mismatches []*lockMismatch
+	seen := make(map[string]bool)
+	for _, imp := range ctxt.result.Imports {
+		if !inTree[imp.From] || isStandard(imp.To) || inTree[imp.To] {
+			continue
+		}
+		p := lockedProjectFor(projects, imp.To)
+		switch {
+		case p != nil:
+			major, pinned := importMajor(p.name, imp.To), pinnedMajor(p.pinned())
+			if major == "" || pinned == "" || major == pinned {
+				continue
+			}
+		case majorElemAnywherePat.MatchString(imp.To):
+			// An import from a project that isn't pinned
+			// may be a different major version of one that is.
+			family := majorElemAnywherePat.ReplaceAllString(imp.To, "$1")
+			for _, q := range projects {
+				if hasPathPrefix(family, majorElemAnywherePat.ReplaceAllString(q.name, "$1")) {
+					p = q
+				}
+			}
+			if p == nil {
+				continue
+			}
+		default:
+			continue
+		}
+		m := &lockMismatch{
+			project:    p,
+			importer:   imp.From,
+			importPath: imp.To,
+		}
+		if key := m.String(); !seen[key] {
+			seen[key] = true
+			mismatches = append(mismatches, m)
+		}
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		return mismatches[i].String() < mismatches[j].String()
+	})
+	return mismatches
+}
+
+// lockedProjectFor returns the pinned project
+// holding the package with the given import path.
+func lockedProjectFor(projects []*lockedProject, path string) *lockedProject {
+	var found *lockedProject
+	for _, p := range projects {
+		if hasPathPrefix(path, p.name) && (found == nil || len(p.name) > len(found.name)) {
+			found = p
+		}
+	}
+	return found
+}
+
+// importMajor returns the major version of the project
+// with the given name named by the import path: the
+// version element at the end of the name, or just after
+// it. It returns "" if the path has no version element.
+func importMajor(name, path string) string {
+	if m := majorSuffixPat.FindStringSubmatch(name); m != nil {
+		return m[1]
+	}
+	if m := majorElemPat.FindStringSubmatch(path[len(name):]); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// pinnedMajor returns the major version named by a pinned
+// version or branch, treating v0 as major version 1. It
+// returns "" if the major version is unknown, as for a
+// revision.
+func pinnedMajor(version string) string {
+	m := pinnedMajorPat.FindStringSubmatch(version)
+	if m == nil {
+		return ""
+	}
+	if m[1] == "0" {
+		return "1"
+	}
+	return m[1]
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
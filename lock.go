@@ -0,0 +1,39 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+)
+
+// lockTree takes an advisory lock on the repository holding
+// the current directory, so that two runs that change files
+// in the same checkout cannot interleave their writes. The
+// lock is held until govers exits. The lock file is kept
+// outside the tree, in the locks directory of the cache
+// directory (or in govers-locks in the temporary directory
+// when the cache is disabled), named by the repository's root,
+// so that nothing is left behind in the tree.
+func (ctxt *context) lockTree() {
+	root := repoRoot(ctxt.cwd)
+	if dir, err := filepath.EvalSymlinks(root); err == nil {
+		root = dir
+	}
+	dir := filepath.Join(os.TempDir(), "govers-locks")
+	if cache := cacheDir(); cache != "" {
+		dir = filepath.Join(cache, "locks")
+	}
+	if err := os.MkdirAll(dir, 0o777); err != nil {
+		fatalf("cannot lock %s: %v", root, err)
+	}
+	sum := sha256.Sum256([]byte(root))
+	file := filepath.Join(dir, hex.EncodeToString(sum[:16])+".lock")
+	held, err := lockFile(file)
+	if err != nil {
+		fatalf("cannot lock %s: %v", root, err)
+	}
+	if held {
+		fatalf("another govers run is in progress in %s (lock file %s)", root, file)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix && !windows
+
+package main
+
+// lockFile does nothing on systems without file locking.
+func lockFile(name string) (held bool, err error) {
+	return false, nil
+}
@@ -0,0 +1,32 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockedFile holds the file locked by lockFile. It must stay
+// reachable, as closing it, which its finalizer would do
+// once it had been garbage collected, releases the lock.
+var lockedFile *os.File
+
+// lockFile takes an exclusive lock on the named file, creating
+// it if necessary, and reports whether another process already
+// holds it. The lock is released when the process exits.
+func lockFile(name string) (held bool, err error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0o666)
+	if err != nil {
+		return false, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err == syscall.EWOULDBLOCK {
+			return true, nil
+		}
+		return false, err
+	}
+	lockedFile = f
+	return false, nil
+}
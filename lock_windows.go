@@ -0,0 +1,25 @@
+package main
+
+import (
+	"syscall"
+)
+
+// errorSharingViolation is the error returned when
+// a file is opened by another process without sharing.
+const errorSharingViolation syscall.Errno = 32
+
+// lockFile opens the named file, creating it if necessary,
+// without allowing it to be shared, and reports whether another
+// process already has it open. The file is closed, and so
+// unlocked, when the process exits.
+func lockFile(name string) (held bool, err error) {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return false, err
+	}
+	_, err = syscall.CreateFile(p, syscall.GENERIC_READ|syscall.GENERIC_WRITE, 0, nil, syscall.OPEN_ALWAYS, syscall.FILE_ATTRIBUTE_NORMAL, 0)
+	if err == errorSharingViolation {
+		return true, nil
+	}
+	return false, err
+}
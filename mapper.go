@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// mapper decides how import paths should be changed by
+// asking an external program, as named by the -rewriter
+// flag. The program is started once and is sent each
+// candidate import path on a line of its standard input.
+// For each one, it replies with a line on its standard
+// output holding either the path to change it to or
+// "keep" to leave it alone. It should exit when its
+// standard input is closed, as happens when govers exits.
+type mapper struct {
+	name string
+	in   io.Writer
+	out  *bufio.Reader
+
+	mu      sync.Mutex
+	replies map[string]string
+}
+
+// newMapper starts the given rewriter command, which
+// may include arguments separated by white space.
+func newMapper(command string) (*mapper, error) {
+	args := strings.Fields(command)
+	if len(args) == 0 {
+		return nil, fmt.Errorf("empty rewriter command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start rewriter: %v", err)
+	}
+	return &mapper{
+		name:    args[0],
+		in:      in,
+		out:     bufio.NewReader(out),
+		replies: make(map[string]string),
+	}, nil
+}
+
+// mapPath implements vers.MapFunc. Standard library paths
+// are never sent to the program, and the reply for each
+// path is remembered so that it is asked only once.
+func (m *mapper) mapPath(p string) (string, bool) {
+	if isStandard(p) {
+		return "", false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reply, ok := m.replies[p]
+	if !ok {
+		reply = m.ask(p)
+		m.replies[p] = reply
+	}
+	if reply == "keep" || reply == p {
+		return "", false
+	}
+	return reply, true
+}
+
+// ask sends p to the program and returns its reply.
+// As a partial answer would leave the tree inconsistent,
+// any failure is fatal.
+func (m *mapper) ask(p string) string {
+	if _, err := fmt.Fprintf(m.in, "%s\n", p); err != nil {
+		fatalf("cannot send %q to rewriter %s: %v", p, m.name, err)
+	}
+	line, err := m.out.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		fatalf("no reply from rewriter %s for %q: %v", m.name, p, err)
+	}
+	reply := strings.TrimSpace(line)
+	if reply == "" || strings.ContainsAny(reply, " \t\"") {
+		fatalf("invalid reply from rewriter %s for %q: %q", m.name, p, reply)
+	}
+	return reply
+}
+
+// isStandard reports whether the import
+// path names a standard library package.
+func isStandard(p string) bool {
+	elem, _, _ := strings.Cut(p, "/")
+	return !strings.Contains(elem, ".")
+}
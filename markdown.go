@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// writeMarkdownSummary writes a summary of the changes in
+// plan, as printed by -report md, in a form suitable for
+// pasting into the description of a pull request: the import
+// paths changed, a table of the packages changed with the
+// number of files changed in each, and any warnings.
+func (ctxt *context) writeMarkdownSummary(w io.Writer, plan *vers.Plan) error {
+	type pathChange struct {
+		old, new string
+	}
+	var paths []pathChange
+	seenPath := make(map[pathChange]bool)
+	var pkgs []*vers.Package
+	files := make(map[*vers.Package]int)
+	for _, edit := range plan.Files {
+		if len(edit.Changes) == 0 {
+			continue
+		}
+		if files[edit.Package] == 0 {
+			pkgs = append(pkgs, edit.Package)
+		}
+		files[edit.Package]++
+		for _, c := range edit.Changes {
+			pc := pathChange{c.Old, c.New}
+			if !seenPath[pc] {
+				seenPath[pc] = true
+				paths = append(paths, pc)
+			}
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].old < paths[j].old
+	})
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].ImportPath < pkgs[j].ImportPath
+	})
+	verb := "Changed"
+	if *noEdit || ctxt.checkOnly {
+		verb = "Would change"
+	}
+	fmt.Fprintf(w, "## Import path changes\n\n")
+	if len(paths) == 0 {
+		fmt.Fprintf(w, "No imports needed changing.\n")
+	} else {
+		fmt.Fprintf(w, "| Old path | New path |\n")
+		fmt.Fprintf(w, "|---|---|\n")
+		for _, pc := range paths {
+			fmt.Fprintf(w, "| `%s` | `%s` |\n", pc.old, pc.new)
+		}
+		fmt.Fprintf(w, "\n### %s packages\n\n", verb)
+		fmt.Fprintf(w, "| Package | Files |\n")
+		fmt.Fprintf(w, "|---|---:|\n")
+		total := 0
+		for _, p := range pkgs {
+			fmt.Fprintf(w, "| `%s` | %d |\n", p.ImportPath, files[p])
+			total += files[p]
+		}
+		fileCount := "1 file"
+		if total != 1 {
+			fileCount = fmt.Sprintf("%d files", total)
+		}
+		fmt.Fprintf(w, "\n%s %s in %s.\n", verb, fileCount, packageCount(len(pkgs)))
+	}
+	warnings := ctxt.markdownWarnings()
+	if len(warnings) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(w, "\n### Remaining warnings\n\n")
+	for _, warning := range warnings {
+		_, err = fmt.Fprintf(w, "- %s\n", warning)
+	}
+	return err
+}
+
+// markdownWarnings returns the problems that remain
+// after the changes, each formatted as Markdown.
+func (ctxt *context) markdownWarnings() []string {
+	var warnings []string
+	for _, f := range ctxt.result.Findings {
+		warnings = append(warnings, fmt.Sprintf("`%s` is using inconsistent path `%s`", f.Importer, f.ImportPath))
+	}
+	for _, f := range ctxt.result.Waived {
+		warnings = append(warnings, fmt.Sprintf("`%s` is using inconsistent path `%s` (waived by `-allow`)", f.Importer, f.ImportPath))
+	}
+	for _, dir := range ctxt.result.SkippedModules {
+		warnings = append(warnings, fmt.Sprintf("nested module in `%s` was not changed", ctxt.relPath(dir)))
+	}
+	for _, r := range ctxt.result.StaleRequires {
+		warnings = append(warnings, fmt.Sprintf("`%s` still requires `%s`, not `%s`", ctxt.relPath(r.Pos.Filename), r.Path, r.Expected))
+	}
+	for _, file := range ctxt.generated {
+		warnings = append(warnings, fmt.Sprintf("generated file `%s` was not changed", ctxt.relPath(file)))
+	}
+	return warnings
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// matchPaths holds the import paths given to the match subcommand.
+var matchPaths []string
+
+// parseMatch parses the arguments to the match subcommand:
+// new-package-path arguments, as for the rewrite subcommand,
+// followed by "--" and the import paths to try. Without "--",
+// the first argument is the only new-package-path.
+func (ctxt *context) parseMatch(args []string) {
+	n := -1
+	for i, arg := range args {
+		if arg == "--" {
+			n = i
+			matchPaths = args[i+1:]
+			break
+		}
+	}
+	switch {
+	case n < 0 && *rewriterCmd != "":
+		// The program takes the place of the
+		// new-package-path arguments.
+		n, matchPaths = 0, args
+	case n < 0 && len(args) > 0:
+		n, matchPaths = 1, args[1:]
+	case n < 0:
+		n = 0
+	}
+	if len(matchPaths) == 0 {
+		fatalf("no import paths given")
+	}
+	ctxt.parseRules(args[:n])
+}
+
+// runMatch prints, for each import path given, whether it
+// is matched by the rules and, if so, how and what it would
+// be changed to, without looking at any packages.
+func runMatch(ctxt *context) {
+	for _, p := range matchPaths {
+		if ctxt.mapper != nil {
+			if np, ok := ctxt.mapper.mapPath(p); ok {
+				fmt.Printf("%s: mapped by %s\n\twould be changed to: %s\n", p, *rewriterCmd, np)
+			} else {
+				fmt.Printf("%s: left alone by %s\n", p, *rewriterCmd)
+			}
+			continue
+		}
+		r, i := ctxt.rules.Find(p)
+		if r == nil && len(ctxt.rules) > 0 && ctxt.rules[0].Excludes(p) {
+			fmt.Printf("%s: excluded by -M %s\n", p, *notMatch)
+			continue
+		}
+		if r == nil {
+			fmt.Printf("%s: not matched\n", p)
+			for _, r := range ctxt.rules {
+				fmt.Printf("\tpattern: %s\n", r.OldPackagePat)
+			}
+			continue
+		}
+		fmt.Printf("%s: matched\n", p)
+		fmt.Printf("\tpattern: %s (%s)\n", r.OldPackagePat, ruleOrigin(r))
+		fmt.Printf("\tmatched prefix: %s\n", p[0:i])
+		if fixed := vers.Rules([]*vers.Rule{r}).Fix(p); fixed != p {
+			fmt.Printf("\twould be changed to: %s\n", fixed)
+		} else {
+			fmt.Printf("\talready uses %s\n", r.NewPackage)
+		}
+	}
+}
+
+// ruleOrigin describes where the pattern of r came from.
+func ruleOrigin(r *vers.Rule) string {
+	if r.Arg != r.NewPackage || *match != "" {
+		return "given explicitly"
+	}
+	return "derived from " + r.NewPackage
+}
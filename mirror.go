@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"regexp"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var mirrors stringsValue
+
+func init() {
+	flag.Var(&mirrors, "mirror", "treat imports with the import path prefix `alias=path` as the same packages as those with prefix path, changing them to use it (may be repeated)")
+}
+
+// addMirrorRules adds rules for the mappings given with -mirror,
+// each between an alias, such as a corporate mirror or another
+// hosting of a project, and the path prefix it stands for. Each
+// rule whose new path is within a mapped path is extended to
+// match the corresponding alias, whatever its version, so that
+// the alias is treated as the same family, and a rule is added
+// to change any other imports of the alias to use the path.
+func (ctxt *context) addMirrorRules() {
+	if ctxt.mapper != nil {
+		fatalf("-mirror cannot be used with -rewriter")
+	}
+	var added vers.Rules
+	for _, arg := range mirrors {
+		alias, path, ok := strings.Cut(arg, "=")
+		alias, path = vers.NormalizePath(alias), vers.NormalizePath(path)
+		if !ok || alias == "" || path == "" || alias == path {
+			fatalf("invalid -mirror %q; expected alias=path", arg)
+		}
+		for _, r := range ctxt.rules {
+			rest, ok := strings.CutPrefix(r.NewPackage, path)
+			if !ok || rest != "" && rest[0] != '/' {
+				continue
+			}
+			pat, err := vers.PathVersionPat(alias+rest, *versFlag)
+			if err != nil {
+				// An alias without a version
+				// element matches only itself.
+				pat = prefixPat(alias + rest)
+			}
+			added = append(added, &vers.Rule{
+				Arg:           r.Arg,
+				NewPackage:    r.NewPackage,
+				OldPackagePat: pat,
+			})
+		}
+		// The rule has no argument, as -mirror
+		// will add it again wherever it is run.
+		added = append(added, &vers.Rule{
+			NewPackage:    path,
+			OldPackagePat: prefixPat(alias),
+		})
+	}
+	// The added rules come last so that the rules
+	// given explicitly are found first.
+	ctxt.rules = append(ctxt.rules, added...)
+}
+
+// prefixPat returns a pattern matching import paths
+// that have p as a leading sequence of elements.
+func prefixPat(p string) *regexp.Regexp {
+	return regexp.MustCompile("^(" + regexp.QuoteMeta(p) + ")(/|$)")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// patchDir holds the directory named by the -o flag of
+// the patch subcommand, made absolute by parseModulePatch.
+var patchDir string
+
+// patchModule holds the module@version
+// given to the patch subcommand.
+var patchModule string
+
+// parseModulePatch parses the arguments to the patch subcommand:
+// a module-path@version argument followed by new-package-path
+// arguments, as for the rewrite subcommand. It extracts that
+// version of the module into the directory named by -o, which
+// becomes the tree to change.
+func (ctxt *context) parseModulePatch(args []string) {
+	if patchDir == "" {
+		fatalf("the patch subcommand requires -o")
+	}
+	arg := args[0]
+	i := strings.LastIndex(arg, "@")
+	if i <= 0 || i == len(arg)-1 {
+		fatalf("invalid argument %q; expected module-path@version", arg)
+	}
+	modPath, version := arg[0:i], arg[i+1:]
+	if !strings.HasPrefix(version, "v") {
+		fatalf("invalid version %q; versions must start with v", version)
+	}
+	dir, err := filepath.Abs(patchDir)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	// The go command only takes an unversioned replacement to
+	// be a directory if it is absolute or starts with ./ or ../,
+	// so the directory is given as an absolute path.
+	patchDir = dir
+	if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+		fatalf("cannot extract %s to %s: directory is not empty", arg, patchDir)
+	}
+	data, err := ctxt.moduleZip(modPath, version)
+	if err != nil {
+		fatalf("cannot download %s: %v", arg, err)
+	}
+	if err := extractModule(dir, modPath, version, data); err != nil {
+		fatalf("cannot extract %s: %v", arg, err)
+	}
+	patchModule = arg
+	ctxt.cwd, ctxt.dir = dir, dir
+	ctxt.newTree = true
+	ctxt.parseRules(args[1:])
+}
+
+// runModulePatch changes the module extracted by
+// parseModulePatch, as the rewrite subcommand would.
+func runModulePatch(ctxt *context) {
+	runRewrite(ctxt)
+	if *noEdit {
+		return
+	}
+	modPath := patchModule[:strings.LastIndex(patchModule, "@")]
+	logf("wrote changed %s to %s; to use it, run:\n\tgo mod edit -replace %s=%s", patchModule, patchDir, modPath, shellQuote(patchDir))
+}
+
+// moduleZip returns the zip file holding the given version
+// of a module, from the module cache if it has been
+// downloaded, and otherwise from the module proxy.
+func (ctxt *context) moduleZip(modPath, version string) ([]byte, error) {
+	if data, err := ctxt.moduleCacheFile(modPath, version, ".zip"); err == nil {
+		return data, nil
+	}
+	data, err := newGoProxy().get(modPath, "@v/"+escapePath(version)+".zip")
+	if errors.Is(err, errPrivate) {
+		return nil, fmt.Errorf("%v; run \"go mod download %s@%s\" to add it to the module cache", err, modPath, version)
+	}
+	return data, err
+}
+
+// moduleCacheFile returns the file with the given extension,
+// such as ".mod" or ".zip", for the given version of a module
+// from the download cache within the module cache.
+func (ctxt *context) moduleCacheFile(modPath, version, ext string) ([]byte, error) {
+	cache := os.Getenv("GOMODCACHE")
+	if gopath := filepath.SplitList(ctxt.buildCtxt.GOPATH); cache == "" && len(gopath) > 0 && gopath[0] != "" {
+		cache = filepath.Join(gopath[0], "pkg", "mod")
+	}
+	if cache == "" {
+		return nil, os.ErrNotExist
+	}
+	return os.ReadFile(filepath.Join(cache, "cache", "download", filepath.FromSlash(escapePath(modPath)), "@v", escapePath(version)+ext))
+}
+
+// extractModule extracts the module zip file held in data, for
+// the given version of a module, into dir. A go.mod file naming
+// the module is added if the module has none, so that the
+// directory can be used in a replace directive.
+func extractModule(dir, modPath, version string, data []byte) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("cannot read module zip: %v", err)
+	}
+	prefix := modPath + "@" + version + "/"
+	hasGoMod := false
+	for _, f := range zr.File {
+		name := strings.TrimPrefix(f.Name, prefix)
+		if strings.HasSuffix(name, "/") {
+			continue
+		}
+		if name == f.Name || path.Clean(name) != name || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("unexpected file %q in module zip", f.Name)
+		}
+		hasGoMod = hasGoMod || name == "go.mod"
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o777); err != nil {
+			return err
+		}
+		if err := extractFile(file, f); err != nil {
+			return err
+		}
+	}
+	if !hasGoMod {
+		if err := os.MkdirAll(dir, 0o777); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module "+modPath+"\n"), 0o666)
+	}
+	return nil
+}
+
+// extractFile writes the contents of f to the named file.
+func extractFile(file string, f *zip.File) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o666)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// moveFrom and moveTo hold the import paths
+// given to the move subcommand.
+var moveFrom, moveTo string
+
+// parseMove parses the arguments to the move subcommand, the
+// import path of the package to move and its new import path,
+// setting ctxt.rules to change the imports of the package and
+// of any packages below it.
+func (ctxt *context) parseMove(args []string) {
+	if len(args) != 2 {
+		fatalf("the move subcommand takes two arguments, the old and new import paths")
+	}
+	moveFrom, moveTo = vers.NormalizePath(args[0]), vers.NormalizePath(args[1])
+	if moveFrom == moveTo {
+		fatalf("the old and new import paths are the same")
+	}
+	if strings.HasPrefix(moveTo, moveFrom+"/") {
+		fatalf("cannot move %s to %s, which is within it", moveFrom, moveTo)
+	}
+	ctxt.rules = vers.Rules{{
+		Arg:           moveTo,
+		NewPackage:    moveTo,
+		OldPackagePat: regexp.MustCompile("^(" + regexp.QuoteMeta(moveFrom) + ")(/|$)"),
+	}}
+}
+
+// runMove moves the package named by moveFrom, along with
+// any packages below it, to the directory for the import path
+// moveTo, changing the imports of it throughout the tree and
+// any canonical import comments in it to match. Within a git
+// repository the move is made with "git mv", so that it is
+// staged. The package name is left unchanged.
+func runMove(ctxt *context) {
+	if !*noEdit {
+		ctxt.lockTree()
+	}
+	rw := ctxt.newRewriter(vers.WithoutDependencies(true))
+	result, err := rw.Scan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.result = result
+	var pkg *vers.Package
+	for _, p := range result.Packages {
+		if p.ImportPath == moveFrom && !p.External {
+			pkg = p
+		}
+	}
+	if pkg == nil {
+		fatalf("package %s not found in the tree", moveFrom)
+	}
+	newDir, ok := moveDir(pkg, moveTo)
+	if !ok {
+		fatalf("cannot move %s to %s, which is outside its module", moveFrom, moveTo)
+	}
+	if _, err := os.Stat(newDir); err == nil {
+		fatalf("cannot move %s: %s already exists", moveFrom, ctxt.relPath(newDir))
+	}
+	plan, err := rw.Plan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.filterPlan(plan)
+	applyErr := rw.Apply(plan)
+	var last *vers.Package
+	for _, edit := range plan.Files {
+		if p := edit.Package; len(edit.Changes) > 0 && p != last {
+			last = p
+			fmt.Printf("%s\n", p.ImportPath)
+		}
+	}
+	if applyErr != nil {
+		fatalf("%v", applyErr)
+	}
+	if err := updateImportComments(pkg.Dir, moveFrom, moveTo); err != nil {
+		fatalf("cannot update import comments: %v", err)
+	}
+	if *noEdit {
+		logf("would move %s to %s", ctxt.relPath(pkg.Dir), ctxt.relPath(newDir))
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(newDir), 0o777); err != nil {
+		fatalf("cannot move %s: %v", moveFrom, err)
+	}
+	// Files that git does not track, or a tree outside any
+	// repository, are moved directly.
+	if _, err := runGit(pkg.Dir, "mv", pkg.Dir, newDir); err != nil {
+		if err := os.Rename(pkg.Dir, newDir); err != nil {
+			fatalf("cannot move %s: %v", moveFrom, err)
+		}
+	}
+	logf("moved %s to %s", ctxt.relPath(pkg.Dir), ctxt.relPath(newDir))
+}
+
+// moveDir returns the directory for the package with import
+// path newPath, found from the directory of p and its import
+// path. It reports false if newPath is not within the module
+// holding p.
+func moveDir(p *vers.Package, newPath string) (string, bool) {
+	root, rootDir := "", ""
+	if mod := p.Module; mod != nil && mod.Path != "" {
+		root, rootDir = mod.Path, mod.Dir
+	} else {
+		// Outside a module, the directory
+		// ends with the import path.
+		rootDir = p.Dir
+		for range strings.Split(p.ImportPath, "/") {
+			rootDir = filepath.Dir(rootDir)
+		}
+	}
+	rel := newPath
+	if root != "" {
+		var ok bool
+		if rel, ok = strings.CutPrefix(newPath, root); !ok || rel != "" && rel[0] != '/' {
+			return "", false
+		}
+	}
+	return filepath.Join(rootDir, filepath.FromSlash(rel)), true
+}
+
+var importCommentPat = regexp.MustCompile(`^(//|/\*)\s*import\s+("[^"]*"|` + "`[^`]*`" + `)`)
+
+// updateImportComments changes each canonical import comment,
+// such as // import "example.com/foo", in the Go files in and
+// below dir that names oldPath or a package below it, so that
+// it names the corresponding package below newPath.
+func updateImportComments(dir, oldPath, newPath string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && (d.Name() == "vendor" || d.Name() == "testdata" || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, path, src, parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil {
+			// The file is left for the go command to report.
+			return nil
+		}
+		line := fset.Position(f.Name.End()).Line
+		for _, cg := range f.Comments {
+			c := cg.List[0]
+			if fset.Position(c.Pos()).Line != line || c.Pos() < f.Name.End() {
+				continue
+			}
+			m := importCommentPat.FindStringSubmatchIndex(c.Text)
+			if m == nil {
+				break
+			}
+			old, err := strconv.Unquote(c.Text[m[4]:m[5]])
+			if err != nil {
+				break
+			}
+			rest, ok := strings.CutPrefix(old, oldPath)
+			if !ok || rest != "" && rest[0] != '/' {
+				break
+			}
+			start := fset.Position(c.Pos()).Offset + m[4]
+			end := fset.Position(c.Pos()).Offset + m[5]
+			newSrc := string(src[:start]) + strconv.Quote(newPath+rest) + string(src[end:])
+			if *noEdit {
+				logf("%s: import comment would name %s", path, newPath+rest)
+				break
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(path, []byte(newSrc), info.Mode().Perm())
+		}
+		return nil
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+var (
+	netTimeout  = flag.Duration("net-timeout", 30*time.Second, "time allowed for each network request, including reading its response")
+	netRetries  = flag.Int("net-retries", 2, "number of times to retry a network request that fails or gets a server error")
+	netDeadline = flag.Duration("net-deadline", 0, "time after govers starts by which all network requests must have finished (0 for no limit)")
+)
+
+// maxResponse holds the largest response
+// body that netGet will read.
+const maxResponse = 512 << 20
+
+// netGet fetches the given URL, returning the response and its
+// body, which has been read and closed. Each attempt must finish
+// within the time allowed by -net-timeout, and all of them within
+// -net-deadline of govers starting. An attempt that fails, or gets
+// a 5xx or 429 status from the server, is retried up to -net-retries
+// times after a growing delay. A response with any other status is
+// returned as it is, for the caller to check.
+func netGet(url string) (*http.Response, []byte, error) {
+	delay := time.Second
+	for attempt := 0; ; attempt++ {
+		timeout, ok := netTimeLeft(*netTimeout)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s: not fetched, as the time allowed by -net-deadline %v has passed", url, *netDeadline)
+		}
+		resp, data, err := netAttempt(url, timeout)
+		if err == nil && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return resp, data, nil
+		}
+		if attempt >= *netRetries {
+			return resp, data, err
+		}
+		wait, ok := netTimeLeft(delay)
+		if !ok {
+			return resp, data, err
+		}
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+// netTimeLeft returns d, or the time left before -net-deadline
+// if that is sooner, and whether there is any time left at all.
+func netTimeLeft(d time.Duration) (time.Duration, bool) {
+	if *netDeadline <= 0 {
+		return d, true
+	}
+	left := time.Until(startTime.Add(*netDeadline))
+	if left <= 0 {
+		return 0, false
+	}
+	if d <= 0 || left < d {
+		d = left
+	}
+	return d, true
+}
+
+// netAttempt makes a single attempt to fetch the given URL,
+// returning the response and its body, which must be read
+// within the given time.
+func netAttempt(url string, timeout time.Duration) (*http.Response, []byte, error) {
+	client := &http.Client{
+		Timeout: timeout,
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", url, err)
+	}
+	return resp, data, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// outdatedFamilies holds the package families
+// given to the outdated subcommand.
+var outdatedFamilies []string
+
+// parseOutdated parses the arguments to the outdated
+// subcommand, the package families to consider, all
+// those imported by the tree if none are given.
+func (ctxt *context) parseOutdated(args []string) {
+	for _, family := range args {
+		outdatedFamilies = append(outdatedFamilies, strings.TrimSuffix(family, "/"))
+	}
+}
+
+var versionElemPat = regexp.MustCompile(`^(.+?)([/.])v([0-9]+)(?:/|$)`)
+
+// runOutdated reports each package family imported by the
+// packages in the tree for which the module proxy has published
+// a later major version than the highest one imported, with
+// the govers command that moves the tree to it. The families
+// are those with a major version element in their import paths,
+// such as gopkg.in/yaml.v2 or github.com/owner/repo/v2, and the
+// modules required by the tree's go.mod files whose paths have
+// none, which are at major version 1.
+func runOutdated(ctxt *context) {
+	proxy := newGoProxy()
+	if !proxy.usable() {
+		fatalf("the outdated subcommand requires a module proxy, but GOPROXY does not name one")
+	}
+	rw := ctxt.newRewriter(vers.WithoutDependencies(true), vers.WithDryRun(true))
+	result, err := rw.Scan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.result = result
+	inTree := make(map[string]bool)
+	for _, p := range result.Packages {
+		if !p.External {
+			inTree[p.ImportPath] = true
+		}
+	}
+	var unversioned []string
+	for _, r := range treeRequirements(ctxt.cwd) {
+		if !majorSuffixPat.MatchString(r.path) && !strings.HasPrefix(r.path, "gopkg.in/") && !contains(unversioned, r.path) {
+			unversioned = append(unversioned, r.path)
+		}
+	}
+	seen := make(map[string]bool)
+	var families []string
+	for _, imp := range result.Imports {
+		if !inTree[imp.From] || inTree[imp.To] || isStandard(imp.To) {
+			continue
+		}
+		family := ""
+		if m := versionElemPat.FindStringSubmatch(imp.To); m != nil {
+			// API versions such as k8s.io/api/core/v1
+			// are not module major versions.
+			if n, _ := strconv.Atoi(m[3]); n >= 2 || m[2] == "." {
+				family = m[1]
+			}
+		}
+		if family == "" {
+			for _, mod := range unversioned {
+				if imp.To == mod || strings.HasPrefix(imp.To, mod+"/") {
+					family = mod
+				}
+			}
+		}
+		if family == "" || seen[family] || len(outdatedFamilies) > 0 && !contains(outdatedFamilies, family) {
+			continue
+		}
+		seen[family] = true
+		families = append(families, family)
+	}
+	sort.Strings(families)
+	behind := 0
+	for _, family := range families {
+		major, sep, _ := highestMajor(result, family)
+		latest, err := latestMajor(proxy, family, sep, major)
+		if errors.Is(err, errPrivate) {
+			continue
+		}
+		if err != nil {
+			logf("cannot find the latest major version of %s: %v", family, err)
+			continue
+		}
+		if latest <= major {
+			continue
+		}
+		behind++
+		fmt.Printf("%s: v%d imported, v%d published\n\tgovers bump -latest %s\n", family, major, latest, family)
+	}
+	if behind == 0 {
+		logf("no family imported has a later major version published")
+	}
+}
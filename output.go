@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var outputDir = flag.String("o", "", "write the changed files under `dir`, keeping their paths relative to the current directory, rather than changing them in place")
+
+// writeOutputDir writes the files changed by plan, along with any
+// go.mod files changed by -require, under the directory named by
+// -o, at the same paths relative to it as they have relative to
+// the current directory, leaving the tree itself unchanged.
+func (ctxt *context) writeOutputDir(rw *vers.Rewriter, plan *vers.Plan) {
+	n := 0
+	write := func(file string, data []byte) {
+		rel, err := filepath.Rel(ctxt.cwd, file)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			fatalf("cannot write %s to %s: it is outside the current directory", file, *outputDir)
+		}
+		perm := os.FileMode(0o666)
+		if info, err := os.Stat(file); err == nil {
+			perm = info.Mode().Perm()
+		}
+		dst := filepath.Join(*outputDir, rel)
+		if err := os.MkdirAll(filepath.Dir(dst), 0o777); err != nil {
+			fatalf("%v", err)
+		}
+		if err := os.WriteFile(dst, data, perm); err != nil {
+			fatalf("cannot write changed file: %v", err)
+		}
+		n++
+	}
+	var last *vers.Package
+	for _, edit := range plan.Files {
+		if len(edit.Changes) == 0 {
+			continue
+		}
+		_, data, err := rw.Content(edit)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		write(edit.Path, data)
+		if p := edit.Package; p != last {
+			last = p
+			if ctxt.printsPackages() {
+				fmt.Printf("%s\n", p.ImportPath)
+			}
+			ctxt.changed[p.Module]++
+		}
+	}
+	if len(ctxt.pins) > 0 {
+		for _, mod := range ctxt.result.Modules {
+			if mod.Path == "" || mod.Failed || ctxt.changed[mod] == 0 {
+				continue
+			}
+			old, new, err := ctxt.pinnedGoMod(mod, ctxt.pins)
+			if err != nil {
+				fatalf("module %s: cannot update go.mod: %v", mod.Name(), err)
+			}
+			if !bytes.Equal(old, new) {
+				write(filepath.Join(mod.Dir, "go.mod"), new)
+			}
+		}
+	}
+	if n == 0 {
+		logf("no changes to write to %s", *outputDir)
+		return
+	}
+	logf("wrote %d changed files to %s", n, *outputDir)
+}
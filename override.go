@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// findOverrides sets ctxt.overrides from the configuration files
+// in the directories below the root of the tree, other than
+// primary, the one whose settings are in use. Each can give
+// "rewrites" to use in place of the usual rules for the packages
+// in its directory and below, or set "disable" to leave them
+// alone, for example to keep examples deliberately using an
+// old version. Nothing else can be set in such a file.
+func (ctxt *context) findOverrides(primary *config) {
+	filepath.WalkDir(ctxt.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != ctxt.dir && strings.HasPrefix(d.Name(), ".") && (!*hidden || contains(vcsDirs, d.Name())) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dir := filepath.Dir(path)
+		if d.Name() != configFile || dir == ctxt.dir || primary != nil && path == primary.path {
+			return nil
+		}
+		cfg, err := readConfig(path)
+		if err != nil {
+			fatalf("cannot read configuration: %v", err)
+		}
+		if len(cfg.flags) > 0 {
+			fatalf("%s: only rewrites and disable can be set for a subdirectory", ctxt.relPath(path))
+		}
+		if !cfg.disable && len(cfg.rewrites) == 0 {
+			fatalf("%s: neither rewrites nor disable is set", ctxt.relPath(path))
+		}
+		rel, _ := filepath.Rel(ctxt.dir, dir)
+		o := &vers.Override{
+			Dir:     filepath.ToSlash(rel),
+			Disable: cfg.disable,
+		}
+		if !o.Disable {
+			if ctxt.mapper != nil {
+				fatalf("%s: rewrites cannot be overridden with -rewriter", ctxt.relPath(path))
+			}
+			for _, arg := range cfg.rewrites {
+				r, err := vers.ParseRule(arg, "", *versFlag)
+				if err != nil {
+					fatalf("%s: %v", ctxt.relPath(path), err)
+				}
+				o.Rules = append(o.Rules, r)
+			}
+		}
+		ctxt.overrides = append(ctxt.overrides, o)
+		ctxt.overrideFiles[o] = path
+		return nil
+	})
+}
+
+// reportOverrides notes each override that applied
+// to any of the directories in the tree.
+func (ctxt *context) reportOverrides() {
+	for _, o := range ctxt.result.Overrides {
+		dir := ctxt.relPath(filepath.Join(ctxt.dir, filepath.FromSlash(o.Dir)))
+		file := ctxt.relPath(ctxt.overrideFiles[o])
+		if o.Disable {
+			logf("not changing %s, as disabled by %s", dir, file)
+		} else {
+			logf("using the rewrites in %s for %s", file, dir)
+		}
+	}
+}
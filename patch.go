@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// writePatch writes the changes in plan, along with any
+// go.mod changes needed by -require, to the file named
+// by -patch as a single patch in mailbox format, as
+// accepted by "git am", without changing the tree.
+func (ctxt *context) writePatch(rw *vers.Rewriter, plan *vers.Plan) {
+	root := repoRoot(ctxt.cwd)
+	var diffs []string
+	addDiff := func(file string, old, new []byte) {
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			rel = file
+		}
+		rel = filepath.ToSlash(rel)
+		if d := unifiedDiff("a/"+rel, "b/"+rel, old, new); d != "" {
+			diffs = append(diffs, fmt.Sprintf("diff --git a/%s b/%s\n%s", rel, rel, d))
+		}
+	}
+	for _, edit := range plan.Files {
+		if len(edit.Changes) == 0 {
+			continue
+		}
+		old, new, err := rw.Content(edit)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		addDiff(edit.Path, old, new)
+		ctxt.changed[edit.Package.Module]++
+	}
+	if len(ctxt.pins) > 0 {
+		for _, mod := range ctxt.result.Modules {
+			if mod.Path == "" || mod.Failed || ctxt.changed[mod] == 0 {
+				continue
+			}
+			old, new, err := ctxt.pinnedGoMod(mod, ctxt.pins)
+			if err != nil {
+				fatalf("module %s: cannot update go.mod: %v", mod.Name(), err)
+			}
+			addDiff(filepath.Join(mod.Dir, "go.mod"), old, new)
+		}
+	}
+	if len(diffs) == 0 {
+		logf("no changes to write to %s", *patchFile)
+		return
+	}
+	subject, body := ctxt.commitMessage(plan)
+	var patch strings.Builder
+	fmt.Fprintf(&patch, "From 0000000000000000000000000000000000000000 Mon Sep 17 00:00:00 2001\n")
+	fmt.Fprintf(&patch, "From: %s\n", patchAuthor())
+	fmt.Fprintf(&patch, "Date: %s\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&patch, "Subject: [PATCH] %s\n\n", subject)
+	fmt.Fprintf(&patch, "%s---\n", body)
+	for _, d := range diffs {
+		patch.WriteString(d)
+	}
+	patch.WriteString("-- \ngovers\n")
+	if err := os.WriteFile(*patchFile, []byte(patch.String()), 0o666); err != nil {
+		fatalf("cannot write patch: %v", err)
+	}
+	logf("wrote %d changed files to %s", len(diffs), *patchFile)
+}
+
+// commitMessage returns the subject and body of a commit
+// message describing the changes in plan.
+func (ctxt *context) commitMessage(plan *vers.Plan) (subject, body string) {
+	type pathChange struct {
+		old, new string
+	}
+	var paths []pathChange
+	seen := make(map[pathChange]bool)
+	for _, edit := range plan.Files {
+		for _, c := range edit.Changes {
+			if pc := (pathChange{c.Old, c.New}); !seen[pc] {
+				seen[pc] = true
+				paths = append(paths, pc)
+			}
+		}
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		return paths[i].old < paths[j].old
+	})
+	subject = "Change import paths"
+	if len(paths) == 1 {
+		subject = fmt.Sprintf("Change imports of %s to %s", paths[0].old, paths[0].new)
+	}
+	var b strings.Builder
+	b.WriteString("This change was made by running:\n\n")
+	fmt.Fprintf(&b, "\tgovers %s\n\nwhich changed these import paths:\n\n", quoteArgs(ctxt.invocation))
+	for _, pc := range paths {
+		fmt.Fprintf(&b, "\t%s -> %s\n", pc.old, pc.new)
+	}
+	return subject, b.String()
+}
+
+// patchAuthor returns the author for a patch, as configured
+// for git if possible.
+func patchAuthor() string {
+	config := func(name string) string {
+		out, err := exec.Command("git", "config", name).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+	name, email := config("user.name"), config("user.email")
+	if name == "" {
+		name = "govers"
+	}
+	if email == "" {
+		email = "govers@localhost"
+	}
+	return fmt.Sprintf("%s <%s>", name, email)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// pin holds a module version given to the pin subcommand
+// or the -require flag. The pin applies to requirements on
+// modules matched by any rule whose new path is the pin's path.
+type pin struct {
+	rule    *vers.Rule
+	path    string
+	version string
+}
+
+var majorSuffixPat = regexp.MustCompile(`[/.]v([0-9]+)$`)
+
+// parsePins sets ctxt.pins and ctxt.rules from
+// arguments of the form module-path@version.
+func (ctxt *context) parsePins(args []string) {
+	for _, arg := range args {
+		i := strings.LastIndex(arg, "@")
+		if i <= 0 || i == len(arg)-1 {
+			fatalf("invalid argument %q; expected module-path@version", arg)
+		}
+		pn := newPin(arg[0:i], arg[i+1:], nil)
+		ctxt.rules = append(ctxt.rules, pn.rule)
+		ctxt.pins = append(ctxt.pins, pn)
+	}
+	ctxt.addIncompatibleRules()
+}
+
+// newPin returns a pin of the module with the given
+// path to the given version, checking that the version
+// is compatible with the path. The pin's family is
+// matched by r, or by a rule derived from the path
+// if r is nil.
+func newPin(path, version string, r *vers.Rule) *pin {
+	if !strings.HasPrefix(version, "v") {
+		fatalf("invalid version %q; versions must start with v", version)
+	}
+	if m := majorSuffixPat.FindStringSubmatch(path); m != nil {
+		if major := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 2)[0]; major != m[1] {
+			fatalf("version %s does not match the major version of %s", version, path)
+		}
+	}
+	if r == nil {
+		var err error
+		r, err = vers.ParseRule(path, "", *versFlag)
+		if err != nil {
+			fatalf("%v", err)
+		}
+	}
+	return &pin{
+		rule:    r,
+		path:    path,
+		version: version,
+	}
+}
+
+// checkPinnedMajors checks that each module in ctxt.pins with a
+// major version suffix, such as example.com/lib/v2, is published
+// at the version it is pinned to, looking for its go.mod file in
+// the module cache and then on the module proxy. The go command
+// finds such a module whichever way upstream publishes its major
+// versions: in a v2 subdirectory of the repository, or on a branch
+// whose go.mod file at the repository root declares the /v2 path.
+// The check fails if neither provides the module at that version,
+// or if the go.mod file found declares another module path. Modules
+// that the current module's go.mod file replaces, and private
+// modules, are not checked, and other lookup failures are only
+// reported.
+func (ctxt *context) checkPinnedMajors() {
+	var gomod *goMod
+	if data, err := os.ReadFile(filepath.Join(moduleRoot(ctxt.dir), "go.mod")); err == nil {
+		gomod = parseGoMod(data)
+	}
+	var proxy *goProxy
+	for _, pn := range ctxt.pins {
+		m := majorSuffixPat.FindStringSubmatch(pn.path)
+		if m == nil || m[0][0] != '/' || m[1] == "0" || m[1] == "1" {
+			continue
+		}
+		if gomod != nil {
+			if _, ok := gomod.replacement(pn.path); ok {
+				continue
+			}
+		}
+		data, err := ctxt.moduleCacheFile(pn.path, pn.version, ".mod")
+		if err != nil {
+			if proxy == nil {
+				proxy = newGoProxy()
+			}
+			data, err = proxy.get(pn.path, "@v/"+escapePath(pn.version)+".mod")
+		}
+		switch {
+		case errors.Is(err, errNotFound):
+			fatalf("%s", unpublishedMajor(proxy, pn, "v"+m[1]))
+		case errors.Is(err, errPrivate):
+			continue
+		case err != nil:
+			logf("cannot check that %s@%s is published: %v", pn.path, pn.version, err)
+			continue
+		}
+		if declared := parseGoMod(data).module(); declared != "" && declared != pn.path {
+			fatalf("%s@%s is not published: its go.mod file declares module %s", pn.path, pn.version, declared)
+		}
+	}
+}
+
+// unpublishedMajor returns the error message for a pinned module
+// with the given major version element that is not published at
+// the pinned version, listing the versions that are published.
+func unpublishedMajor(proxy *goProxy, pn *pin, major string) string {
+	msg := fmt.Sprintf("%s@%s is not published: upstream has no %s subdirectory or %s branch providing it at that version", pn.path, pn.version, major, major)
+	data, err := proxy.get(pn.path, "@v/list")
+	if err != nil {
+		return msg
+	}
+	versions := strings.Fields(string(data))
+	if len(versions) == 0 {
+		return fmt.Sprintf("%s; no versions of %s are published", msg, pn.path)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return vers.CompareVersions(versions[i], versions[j]) < 0
+	})
+	return fmt.Sprintf("%s; published versions: %s", msg, strings.Join(versions, " "))
+}
+
+// requirePins updates the go.mod file of each module in the
+// tree that was changed, so that it requires the version
+// given with the -require flag.
+func (ctxt *context) requirePins() bool {
+	ok := true
+	for _, mod := range ctxt.result.Modules {
+		if mod.Path == "" || mod.Failed || ctxt.changed[mod] == 0 {
+			continue
+		}
+		changed, err := ctxt.pinModule(mod, ctxt.pins)
+		if err != nil {
+			if changed {
+				logf("module %s: %v", mod.Name(), err)
+			} else {
+				logf("module %s: cannot update go.mod: %v", mod.Name(), err)
+			}
+			ok = false
+			continue
+		}
+		if !changed {
+			continue
+		}
+		for _, pn := range ctxt.pins {
+			if *noEdit {
+				logf("module %s: would require %s %s", mod.Name(), pn.path, pn.version)
+			} else {
+				logf("module %s: now requires %s %s", mod.Name(), pn.path, pn.version)
+			}
+		}
+	}
+	return ok
+}
+
+// runPin sets the requirement on each pinned module in the
+// go.mod file of every module in the tree that requires or
+// imports its family, after checking that the packages in the
+// module import the pinned major version.
+func runPin(ctxt *context) {
+	if !*noEdit {
+		ctxt.lockTree()
+	}
+	// Pinning applies to every module in the tree.
+	rw := ctxt.newRewriter(vers.WithoutDependencies(true), vers.WithDryRun(true), vers.WithoutNestedModules(false))
+	result, err := rw.Scan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.result = result
+	inTree := make(map[string]bool)
+	for _, p := range result.Packages {
+		if !p.External {
+			inTree[p.ImportPath] = true
+		}
+	}
+	failed := false
+	for _, mod := range result.Modules {
+		modFailed := false
+		var imported []*pin
+		for _, pn := range ctxt.pins {
+			for _, imp := range result.Imports {
+				if imp.Module != mod || !inTree[imp.From] {
+					continue
+				}
+				if r, _ := ctxt.rules.Find(imp.To); r == nil || r.NewPackage != pn.path {
+					continue
+				}
+				if fixed := ctxt.rules.Fix(imp.To); fixed != imp.To {
+					logf("module %s: package %q imports %q, not %s; run govers %s first", mod.Name(), imp.From, imp.To, pn.path, pn.path)
+					modFailed = true
+					continue
+				}
+				imported = append(imported, pn)
+			}
+		}
+		if mod.Path == "" {
+			if len(imported) > 0 {
+				logf("module %s: not changed; there is no go.mod file", mod.Name())
+			}
+			continue
+		}
+		if modFailed {
+			failed = true
+			continue
+		}
+		changed, err := ctxt.pinModule(mod, imported)
+		if err != nil {
+			logf("module %s: %v", mod.Name(), err)
+			failed = true
+		}
+		if changed {
+			fmt.Printf("%s\n", ctxt.relPath(filepath.Join(mod.Dir, "go.mod")))
+		}
+	}
+	if failed {
+		ctxt.exit(1)
+	}
+}
+
+// pinModule updates the go.mod file of mod so that it requires
+// each pinned module in place of any other version of its
+// family. A requirement is added for each pin in imported
+// that is not already required. Unless a replace directive
+// names a directory for it, each module then required is
+// downloaded with "go mod download", which adds its checksums
+// to the go.sum file. It reports whether the go.mod file was
+// changed, which it may have been even when an error is
+// returned.
+func (ctxt *context) pinModule(mod *vers.Module, imported []*pin) (bool, error) {
+	gomod := filepath.Join(mod.Dir, "go.mod")
+	data, newData, err := ctxt.pinnedGoMod(mod, imported)
+	if err != nil {
+		return false, err
+	}
+	if string(newData) == string(data) {
+		return false, nil
+	}
+	if *noEdit {
+		return true, nil
+	}
+	info, err := os.Stat(gomod)
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(gomod, newData, info.Mode().Perm()); err != nil {
+		return false, err
+	}
+	// Without the checksums of the modules now required,
+	// the go command would refuse to build the module.
+	m := parseGoMod(newData)
+	for _, r := range m.requires() {
+		for _, pn := range ctxt.pins {
+			if r.path != pn.path || r.version != pn.version || m.dirReplaced(pn.path) {
+				continue
+			}
+			if _, err := goModDownloadIn(mod.Dir, pn.path+"@"+pn.version); err != nil {
+				return true, fmt.Errorf("go.mod updated, but cannot add go.sum entries for %s %s: %v", pn.path, pn.version, err)
+			}
+		}
+	}
+	return true, nil
+}
+
+// pinnedGoMod returns the current contents of the go.mod
+// file of mod and the contents that pinModule would give it.
+func (ctxt *context) pinnedGoMod(mod *vers.Module, imported []*pin) (old, new []byte, err error) {
+	data, err := os.ReadFile(filepath.Join(mod.Dir, "go.mod"))
+	if err != nil {
+		return nil, nil, err
+	}
+	m := parseGoMod(data)
+	var remove []int
+	for _, pn := range ctxt.pins {
+		found := false
+		for _, r := range m.requires() {
+			if rule, i := ctxt.rules.Find(r.path); rule == nil || rule.NewPackage != pn.path || i != len(r.path) {
+				continue
+			}
+			if found {
+				remove = append(remove, r.index)
+				continue
+			}
+			found = true
+			if r.path != pn.path || r.version != pn.version {
+				m.setRequire(r, pn.path, pn.version)
+			}
+		}
+		if !found && containsPin(imported, pn) {
+			m.addRequire(pn.path, pn.version)
+		}
+	}
+	sort.Ints(remove)
+	m.removeLines(remove)
+	return data, m.bytes(), nil
+}
+
+func containsPin(pins []*pin, pn *pin) bool {
+	for _, p := range pins {
+		if p == pn {
+			return true
+		}
+	}
+	return false
+}
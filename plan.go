@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// jsonPlan holds the form of a plan printed by -plan.
+type jsonPlan struct {
+	Files []jsonFileEdit
+}
+
+type jsonFileEdit struct {
+	Path    string
+	Package string
+	Edits   []jsonEdit
+}
+
+type jsonEdit struct {
+	Line        int
+	Offset      int
+	End         int
+	Old         string
+	New         string
+	Replacement string
+}
+
+// writePlan writes the given plan to w as JSON.
+func writePlan(w io.Writer, plan *vers.Plan) error {
+	out := jsonPlan{
+		Files: []jsonFileEdit{},
+	}
+	for _, edit := range plan.Files {
+		if len(edit.Changes) == 0 {
+			continue
+		}
+		fe := jsonFileEdit{
+			Path:    edit.Path,
+			Package: edit.Package.ImportPath,
+		}
+		for _, c := range edit.Changes {
+			fe.Edits = append(fe.Edits, jsonEdit{
+				Line:        c.Pos.Line,
+				Offset:      c.Offset,
+				End:         c.End,
+				Old:         c.Old,
+				New:         c.New,
+				Replacement: c.Replacement,
+			})
+		}
+		out.Files = append(out.Files, fe)
+	}
+	data, err := json.MarshalIndent(out, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
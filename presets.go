@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// builtinPresets holds the migrations known to the migrate
+// subcommand, in the format described by readPresets.
+const builtinPresets = `
+yaml	gopkg.in/yaml.v3	# gopkg.in/yaml.v2 to gopkg.in/yaml.v3
+mgo	gopkg\.in/mgo\.v2=github.com/globalsign/mgo	# gopkg.in/mgo.v2 to the maintained fork
+check	gopkg\.in/check\.v1=github.com/go-check/check	# gopkg.in/check.v1 to its GitHub home
+uuid	github\.com/satori/go\.uuid=github.com/gofrs/uuid	# github.com/satori/go.uuid to the maintained fork
+jwt	github\.com/dgrijalva/jwt-go=github.com/golang-jwt/jwt	# github.com/dgrijalva/jwt-go to the maintained fork
+`
+
+// preset holds a named migration.
+type preset struct {
+	name        string
+	description string
+
+	// args holds the new-package-path arguments
+	// that make up the migration.
+	args []string
+
+	// requires holds any module requirements to add,
+	// each of the form module-path@version.
+	requires []string
+}
+
+var (
+	presetsFile string
+	listPresets bool
+)
+
+// readPresets reads presets from the given text. Each line
+// holds the name of a preset followed by its new-package-path
+// arguments (which may specify a pattern explicitly with the
+// "regexp=" prefix) and any module requirements that the
+// migration needs, written as module-path@version, separated
+// by white space. Text after a '#' is taken as the preset's
+// description, and blank lines are ignored.
+func readPresets(source, text string) (map[string]*preset, error) {
+	presets := make(map[string]*preset)
+	scan := bufio.NewScanner(strings.NewReader(text))
+	for lineNum := 1; scan.Scan(); lineNum++ {
+		line, description := scan.Text(), ""
+		if i := strings.Index(line, "#"); i >= 0 {
+			line, description = line[0:i], strings.TrimSpace(line[i+1:])
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		p := &preset{
+			name:        fields[0],
+			description: description,
+		}
+		for _, f := range fields[1:] {
+			if strings.Contains(f, "@") {
+				p.requires = append(p.requires, f)
+			} else {
+				p.args = append(p.args, f)
+			}
+		}
+		if len(p.args) == 0 {
+			return nil, fmt.Errorf("%s:%d: preset %q has no new-package-path", source, lineNum, p.name)
+		}
+		presets[p.name] = p
+	}
+	return presets, nil
+}
+
+// loadPresets returns the built-in presets along with any in
+// the user's presets file (govers/presets within the user's
+// configuration directory) and the file named by -presets,
+// with later definitions replacing earlier ones of the same name.
+func loadPresets() map[string]*preset {
+	presets, err := readPresets("built-in presets", builtinPresets)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	var files []string
+	if dir, err := os.UserConfigDir(); err == nil {
+		files = append(files, filepath.Join(dir, "govers", "presets"))
+	}
+	if presetsFile != "" {
+		files = append(files, presetsFile)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			if os.IsNotExist(err) && file != presetsFile {
+				continue
+			}
+			fatalf("cannot read presets: %v", err)
+		}
+		more, err := readPresets(file, string(data))
+		if err != nil {
+			fatalf("%v", err)
+		}
+		for name, p := range more {
+			presets[name] = p
+		}
+	}
+	return presets
+}
+
+// parsePresets sets ctxt.rules and ctxt.pins from the
+// migrations named by args.
+func (ctxt *context) parsePresets(args []string) {
+	presets := loadPresets()
+	if listPresets {
+		var names []string
+		for name := range presets {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := presets[name]
+			fmt.Printf("%s\t%s\n\t%s\n", name, p.description, strings.Join(append(p.args, p.requires...), " "))
+		}
+		os.Exit(0)
+	}
+	if len(args) == 0 {
+		fatalf("no presets given; use -list to see the available presets")
+	}
+	for _, name := range args {
+		p := presets[name]
+		if p == nil {
+			fatalf("unknown preset %q; use -list to see the available presets", name)
+		}
+		var rules vers.Rules
+		for _, arg := range p.args {
+			r, err := vers.ParseRule(arg, "", *versFlag)
+			if err != nil {
+				fatalf("preset %s: %v", name, err)
+			}
+			rules = append(rules, r)
+		}
+		for _, req := range p.requires {
+			i := strings.LastIndex(req, "@")
+			path, version := req[0:i], req[i+1:]
+			var rule *vers.Rule
+			for _, r := range rules {
+				if path == r.NewPackage || strings.HasPrefix(path, r.NewPackage+"/") {
+					rule = r
+				}
+			}
+			if rule == nil {
+				fatalf("preset %s: requirement %s does not match any of its new package paths", name, req)
+			}
+			ctxt.pins = append(ctxt.pins, newPin(path, version, rule))
+		}
+		ctxt.rules = append(ctxt.rules, rules...)
+	}
+	ctxt.addIncompatibleRules()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"strconv"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// runProgress prints how far the tree has been migrated to
+// the new package paths: how many of the files and packages
+// importing the matched family already use only the new
+// paths, followed by the files that still use the old ones.
+func runProgress(ctxt *context) {
+	if ctxt.mapper != nil {
+		fatalf("the progress subcommand cannot be used with -rewriter")
+	}
+	rw := ctxt.newRewriter(vers.WithoutDependencies(true), vers.WithDryRun(true))
+	plan, err := rw.Plan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.result = plan.Result
+	ctxt.filterPlan(plan)
+	old := make(map[string]bool)
+	for _, edit := range plan.Files {
+		if len(edit.Changes) > 0 {
+			old[edit.Path] = true
+		}
+	}
+	var (
+		files, migratedFiles int
+		pkgs, migratedPkgs   int
+		remaining            []string
+	)
+	for _, p := range plan.Result.Packages {
+		if p.External {
+			continue
+		}
+		inFamily, migrated := false, true
+		for _, file := range p.GoFiles {
+			if !old[file] && !(inScope(file) && ctxt.importsNew(file)) {
+				continue
+			}
+			inFamily = true
+			files++
+			if old[file] {
+				migrated = false
+				remaining = append(remaining, ctxt.relPath(file))
+			} else {
+				migratedFiles++
+			}
+		}
+		if inFamily {
+			pkgs++
+			if migrated {
+				migratedPkgs++
+			}
+		}
+	}
+	fmt.Printf("files: %s\n", progress(migratedFiles, files))
+	fmt.Printf("packages: %s\n", progress(migratedPkgs, pkgs))
+	if len(remaining) > 0 {
+		fmt.Printf("remaining files:\n")
+		for _, file := range remaining {
+			fmt.Printf("\t%s\n", file)
+		}
+	}
+	ctxt.reportGenerated()
+}
+
+// importsNew reports whether the given file
+// imports any of the new package paths.
+func (ctxt *context) importsNew(file string) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+	if err != nil {
+		logf("cannot parse %s: %v", ctxt.relPath(file), err)
+		return false
+	}
+	for _, imp := range f.Imports {
+		p, err := strconv.Unquote(imp.Path.Value)
+		if err == nil && ctxt.inFamily(p) && ctxt.rules.Fix(p) == p {
+			return true
+		}
+	}
+	return false
+}
+
+// progress returns a description of n done out of total.
+func progress(n, total int) string {
+	if total == 0 {
+		return "0 of 0 migrated"
+	}
+	return fmt.Sprintf("%d of %d migrated (%.1f%%)", n, total, 100*float64(n)/float64(total))
+}
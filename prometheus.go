@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// startTime holds the time that govers started, from which
+// the duration of the run is reported and -net-deadline is
+// measured.
+var startTime = time.Now()
+
+// writePrometheusReport writes metrics describing the run in the
+// Prometheus text exposition format, as written by -report
+// prometheus, for the node exporter's textfile collector to pick
+// up, so that regular runs can track the drift of a migration.
+func (ctxt *context) writePrometheusReport(w io.Writer, plan *vers.Plan) error {
+	packages := 0
+	for _, p := range plan.Result.Packages {
+		if !p.External {
+			packages++
+		}
+	}
+	files, imports := 0, 0
+	for _, edit := range plan.Files {
+		if len(edit.Changes) > 0 {
+			files++
+			imports += len(edit.Changes)
+		}
+	}
+	metrics := []struct {
+		name, help string
+		value      float64
+	}{
+		{"packages_scanned", "Number of packages in the tree that were checked.", float64(packages)},
+		{"files_changed", "Number of files changed, or that would be changed without making changes.", float64(files)},
+		{"imports_changed", "Number of imports changed, or that would be changed without making changes.", float64(imports)},
+		{"inconsistencies_found", "Number of imports of inconsistent paths found in dependencies.", float64(len(plan.Result.Findings))},
+		{"problems", "Number of directories, files and packages that could not be processed.", float64(len(plan.Result.Problems))},
+		{"run_duration_seconds", "Time taken by the run, in seconds.", time.Since(startTime).Seconds()},
+	}
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP govers_%s %s\n# TYPE govers_%s gauge\ngovers_%s %g\n", m.name, m.help, m.name, m.name, m.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// errNotFound is returned by goProxy.get when none of
+// the proxies knows of the requested module.
+var errNotFound = errors.New("not found")
+
+// errPrivate is returned by goProxy.get for modules
+// that must not be looked up on a module proxy.
+var errPrivate = errors.New("private module not looked up on module proxies")
+
+// goProxy holds the module proxies listed in GOPROXY,
+// which are queried in turn as the go command queries them.
+type goProxy struct {
+	entries []proxyEntry
+
+	// noProxy holds the patterns, from GONOPROXY or
+	// GOPRIVATE, matching the paths of modules that
+	// are never looked up on a proxy.
+	noProxy string
+}
+
+// proxyEntry holds one element of GOPROXY.
+type proxyEntry struct {
+	// url holds the proxy's URL, or "direct" or "off".
+	url string
+
+	// anyError reports whether the next entry is tried
+	// after any error from this one (the entries were
+	// separated by "|"), rather than only when the module
+	// was not found (separated by ",").
+	anyError bool
+}
+
+// newGoProxy returns the proxies listed in GOPROXY.
+func newGoProxy() *goProxy {
+	env := os.Getenv("GOPROXY")
+	if env == "" {
+		env = "https://proxy.golang.org,direct"
+	}
+	p := &goProxy{
+		noProxy: privatePatterns("GONOPROXY"),
+	}
+	for env != "" {
+		i := strings.IndexAny(env, ",|")
+		var e proxyEntry
+		if i < 0 {
+			e.url, env = env, ""
+		} else {
+			e.url, e.anyError, env = env[:i], env[i] == '|', env[i+1:]
+		}
+		if e.url = strings.TrimSuffix(strings.TrimSpace(e.url), "/"); e.url != "" {
+			p.entries = append(p.entries, e)
+		}
+	}
+	return p
+}
+
+// usable reports whether GOPROXY names any proxy
+// that can be queried.
+func (p *goProxy) usable() bool {
+	for _, e := range p.entries {
+		switch e.url {
+		case "off":
+			return false
+		case "direct":
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// get returns the file with the given name, such as "@v/list",
+// for the module with the given path from the first proxy that
+// has it, moving on to the next as GOPROXY specifies. Only module
+// proxies are queried: reaching "direct" ends the search, as
+// govers cannot query version control systems itself, and
+// reaching "off" fails. It returns an error wrapping errNotFound
+// if no proxy knows of the module, and one wrapping errPrivate,
+// without querying any proxy, if the module is private.
+func (p *goProxy) get(modPath, name string) ([]byte, error) {
+	if matchPrefixPatterns(p.noProxy, modPath) {
+		return nil, fmt.Errorf("%s: %w", modPath, errPrivate)
+	}
+	var lastErr error
+	for _, e := range p.entries {
+		switch e.url {
+		case "off":
+			if lastErr == nil {
+				lastErr = fmt.Errorf("%s: module lookup disabled by GOPROXY=off", modPath)
+			}
+			return nil, lastErr
+		case "direct":
+			if lastErr == nil {
+				lastErr = fmt.Errorf("%s: cannot query the module's repository directly; GOPROXY must name a module proxy", modPath)
+			}
+			return nil, lastErr
+		}
+		data, err := fetchProxy(e.url, modPath, name)
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+		if !e.anyError && !errors.Is(err, errNotFound) {
+			return nil, err
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("%s: GOPROXY names no module proxy", modPath)
+	}
+	return nil, lastErr
+}
+
+// fetchProxy fetches the named file for the module with the
+// given path from a single proxy, which may be a file:// URL.
+func fetchProxy(proxy, modPath, name string) ([]byte, error) {
+	if strings.HasPrefix(proxy, "file://") {
+		u, err := url.Parse(proxy)
+		if err != nil {
+			return nil, err
+		}
+		data, err := os.ReadFile(filepath.Join(filepath.FromSlash(u.Path), filepath.FromSlash(escapePath(modPath)), filepath.FromSlash(name)))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%s: %w", modPath, errNotFound)
+		}
+		return data, err
+	}
+	resp, data, err := netGet(proxy + "/" + escapePath(modPath) + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return nil, fmt.Errorf("%s: %w", modPath, errNotFound)
+	default:
+		return nil, fmt.Errorf("%s: %s", modPath, resp.Status)
+	}
+	return data, nil
+}
+
+// privatePatterns returns the patterns held by the named
+// variable, GONOPROXY or GONOSUMDB, which default to
+// the value of GOPRIVATE when unset.
+func privatePatterns(name string) string {
+	if v := os.Getenv(name); v != "" {
+		return v
+	}
+	return os.Getenv("GOPRIVATE")
+}
+
+// matchPrefixPatterns reports whether the module path p, or a
+// leading sequence of its elements, matches any of the glob
+// patterns in the comma-separated list, as the go command
+// matches GOPRIVATE and the variables like it.
+func matchPrefixPatterns(patterns, p string) bool {
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.Trim(pattern, " /")
+		if pattern == "" {
+			continue
+		}
+		n := strings.Count(pattern, "/")
+		prefix := p
+		for i := 0; i < len(p); i++ {
+			if p[i] == '/' {
+				if n == 0 {
+					prefix = p[:i]
+					break
+				}
+				n--
+			}
+		}
+		if n > 0 {
+			// The pattern has more elements than p.
+			continue
+		}
+		if ok, _ := path.Match(pattern, prefix); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// published reports whether the proxy holds any
+// versions of the module with the given path.
+func (p *goProxy) published(modPath string) (bool, error) {
+	data, err := p.get(modPath, "@v/list")
+	if errors.Is(err, errNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(data)) != "", nil
+}
+
+// escapePath escapes a module path as the proxy
+// protocol requires, replacing each upper case
+// letter with '!' followed by its lower case form.
+func escapePath(p string) string {
+	var buf strings.Builder
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			buf.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// latestVersion returns the latest version of the module
+// with the given path known to the proxy.
+func (p *goProxy) latestVersion(modPath string) (string, error) {
+	data, err := p.get(modPath, "@latest")
+	if err != nil {
+		return "", err
+	}
+	var info struct {
+		Version string
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return "", fmt.Errorf("%s: cannot decode version info: %v", modPath, err)
+	}
+	return info.Version, nil
+}
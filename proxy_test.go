@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var matchPrefixPatternsTests = []struct {
+	patterns string
+	path     string
+	want     bool
+}{
+	{"", "example.com/priv", false},
+	{"example.com/priv", "example.com/priv", true},
+	{"example.com/priv", "example.com/priv/sub", true},
+	{"example.com/priv", "example.com/priv/sub/v2", true},
+	{"example.com/priv", "example.com/private", false},
+	{"example.com/priv", "example.com/pri", false},
+	{"example.com/priv", "example.com", false},
+	{"example.com/priv/", "example.com/priv/sub", true},
+	{"example.com", "example.com/priv", true},
+	{"example.com", "example.community/priv", false},
+	{"example.com/private", "example.com/priv", false},
+	{"example.com/priv,corp.example.org", "corp.example.org/x", true},
+	{"example.com/priv,corp.example.org", "example.com/priv", true},
+	{"example.com/priv,corp.example.org", "example.com/public", false},
+	{"example.com/priv, corp.example.org", "corp.example.org/x", true},
+	{",,example.com/priv,", "example.com/priv", true},
+	{"*.corp.example.org", "git.corp.example.org/team/repo", true},
+	{"*.corp.example.org", "corp.example.org/team/repo", false},
+	{"example.com/*/internal", "example.com/team/internal/x", true},
+	{"example.com/*/internal", "example.com/team/public", false},
+	{"example.com/*/internal", "example.com/team", false},
+	{"example.com/*", "example.com/team/repo", true},
+	{"example.com/*", "example.com", false},
+	{"example.com/priv*", "example.com/private", true},
+	{"example.com/priv*", "example.com/pub", false},
+	{"example.com/te?m", "example.com/team/repo", true},
+	{"example.com/[a-m]*", "example.com/gopher", true},
+	{"example.com/[a-m]*", "example.com/zebra", false},
+}
+
+func TestMatchPrefixPatterns(t *testing.T) {
+	for _, test := range matchPrefixPatternsTests {
+		if got := matchPrefixPatterns(test.patterns, test.path); got != test.want {
+			t.Errorf("matchPrefixPatterns(%q, %q) = %v; want %v", test.patterns, test.path, got, test.want)
+		}
+	}
+}
+
+var privatePatternsTests = []struct {
+	goprivate string
+	gonoproxy string
+	gonosumdb string
+	path      string
+	noProxy   bool
+	noSumDB   bool
+}{
+	{"", "", "", "example.com/priv", false, false},
+	{"example.com/priv", "", "", "example.com/priv/sub", true, true},
+	{"example.com/priv", "", "", "example.com/private", false, false},
+	{"example.com/priv", "none", "", "example.com/priv", false, true},
+	{"example.com/priv", "", "none", "example.com/priv", true, false},
+	{"", "example.com/priv", "", "example.com/priv", true, false},
+	{"", "", "example.com/priv", "example.com/priv", false, true},
+	{"example.com/priv", "corp.example.org", "", "corp.example.org/x", true, false},
+	{"*.corp.example.org,example.com/priv", "", "", "git.corp.example.org/x", true, true},
+}
+
+func TestPrivatePatterns(t *testing.T) {
+	for _, test := range privatePatternsTests {
+		t.Setenv("GOPRIVATE", test.goprivate)
+		t.Setenv("GONOPROXY", test.gonoproxy)
+		t.Setenv("GONOSUMDB", test.gonosumdb)
+		if got := matchPrefixPatterns(privatePatterns("GONOPROXY"), test.path); got != test.noProxy {
+			t.Errorf("GOPRIVATE=%q GONOPROXY=%q: %s matched by GONOPROXY: %v; want %v", test.goprivate, test.gonoproxy, test.path, got, test.noProxy)
+		}
+		if got := matchPrefixPatterns(privatePatterns("GONOSUMDB"), test.path); got != test.noSumDB {
+			t.Errorf("GOPRIVATE=%q GONOSUMDB=%q: %s matched by GONOSUMDB: %v; want %v", test.goprivate, test.gonosumdb, test.path, got, test.noSumDB)
+		}
+	}
+}
+
+func TestProxyGetPrivate(t *testing.T) {
+	var requested []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requested = append(requested, req.URL.Path)
+		w.Write([]byte("v1.0.0\n"))
+	}))
+	defer srv.Close()
+	t.Setenv("GOPROXY", srv.URL)
+	t.Setenv("GOPRIVATE", "example.com/priv")
+	t.Setenv("GONOPROXY", "")
+	p := newGoProxy()
+
+	_, err := p.get("example.com/priv/repo", "@v/list")
+	if !errors.Is(err, errPrivate) {
+		t.Fatalf("get of private module returned %v; want errPrivate", err)
+	}
+	if len(requested) > 0 {
+		t.Fatalf("private module requested from the proxy: %q", requested)
+	}
+
+	// A module outside the pattern is still looked up.
+	data, err := p.get("example.com/private", "@v/list")
+	if err != nil {
+		t.Fatalf("get of public module: %v", err)
+	}
+	if string(data) != "v1.0.0\n" {
+		t.Errorf("get of public module returned %q; want %q", data, "v1.0.0\n")
+	}
+	if want := "/example.com/private/@v/list"; len(requested) != 1 || requested[0] != want {
+		t.Errorf("proxy requests %q; want [%q]", requested, want)
+	}
+}
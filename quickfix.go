@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// writeQuickfixReport writes r as printed by -format quickfix,
+// with one line of the form file:line:col: message for each
+// import that would be changed, each import of an inconsistent
+// path by a dependency whose position is known, and each
+// disagreeing legacy lock file entry (which has no column), as
+// read by the quickfix lists and problem matchers of editors.
+// The files are given relative to the current directory when
+// they are within it.
+func writeQuickfixReport(w io.Writer, r *report) error {
+	cwd, _ := os.Getwd()
+	rel := func(path string) string {
+		if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+			return rel
+		}
+		return path
+	}
+	for _, c := range r.Changes {
+		verb := "imports"
+		if c.Directive {
+			verb = "links against"
+		}
+		if _, err := fmt.Fprintf(w, "%s:%d:%d: %s %s, want %s\n", rel(c.Pos.Filename), c.Pos.Line, c.Pos.Column, verb, c.Old, c.New); err != nil {
+			return err
+		}
+	}
+	for _, f := range r.Findings {
+		if !f.Pos.IsValid() {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s:%d:%d: dependency %s imports %s, want %s\n", rel(f.Pos.Filename), f.Pos.Line, f.Pos.Column, f.Importer, f.ImportPath, f.Expected); err != nil {
+			return err
+		}
+	}
+	for _, m := range r.LockMismatches {
+		if _, err := fmt.Fprintf(w, "%s:%d: %s is pinned at %s, but %s imports %s\n", rel(m.project.file), m.project.line, m.project.name, m.project.pinned(), m.importer, m.importPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
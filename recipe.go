@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var recordFile = flag.String("record", "", "append the operation to the recipe in `file` once it has succeeded")
+
+// replaySteps holds the steps of the recipe
+// given to the replay subcommand.
+var replaySteps [][]string
+
+// recipeHeader starts each recipe file written by -record.
+const recipeHeader = `# govers recipe; apply it with "govers replay <file>"
+steps:
+`
+
+// recordedStep returns the step to record for the current
+// operation: the subcommand name followed by each flag set
+// (other than -record, -worktree and any flags named in omit)
+// and the arguments.
+func recordedStep(cmd *command, fs *flag.FlagSet, args []string, omit ...string) []string {
+	step := []string{cmd.name}
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range omit {
+			if f.Name == name {
+				return
+			}
+		}
+		switch v := f.Value.(type) {
+		case *stringsValue:
+			for _, val := range *v {
+				step = append(step, "-"+f.Name+"="+val)
+			}
+		case interface{ IsBoolFlag() bool }:
+			if v.IsBoolFlag() && f.Value.String() == "true" {
+				step = append(step, "-"+f.Name)
+				break
+			}
+			step = append(step, "-"+f.Name+"="+f.Value.String())
+		default:
+			if f.Name != "record" && f.Name != "worktree" {
+				step = append(step, "-"+f.Name+"="+f.Value.String())
+			}
+		}
+	})
+	return append(step, args...)
+}
+
+// recordStep appends ctxt.step to the recipe file
+// named by -record, creating it if needed.
+func (ctxt *context) recordStep() {
+	if *noEdit {
+		logf("not recording a dry run in %s", *recordFile)
+		return
+	}
+	f, err := os.OpenFile(*recordFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o666)
+	if err != nil {
+		fatalf("cannot record step: %v", err)
+	}
+	defer f.Close()
+	var buf strings.Builder
+	if info, err := f.Stat(); err == nil && info.Size() == 0 {
+		buf.WriteString(recipeHeader)
+	}
+	fmt.Fprintf(&buf, "- %s\n", quoteArgs(ctxt.step))
+	if _, err := f.WriteString(buf.String()); err != nil {
+		fatalf("cannot record step: %v", err)
+	}
+}
+
+// readRecipe reads the steps from the given recipe file. In the
+// same subset of YAML as the configuration file, it holds a
+// "steps:" line followed by a list of steps, each written as a
+// govers command line without the leading "govers", with any
+// arguments quoted as for a shell.
+func readRecipe(file string) ([][]string, error) {
+	r, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var steps [][]string
+	scan := bufio.NewScanner(r)
+	for lineNum := 1; scan.Scan(); lineNum++ {
+		line := strings.TrimSpace(scan.Text())
+		if line == "" || strings.HasPrefix(line, "#") || line == "steps:" {
+			continue
+		}
+		if !strings.HasPrefix(line, "- ") {
+			return nil, fmt.Errorf("%s:%d: expected a step written as \"- subcommand args...\"", file, lineNum)
+		}
+		step, err := splitCommandLine(strings.TrimPrefix(line, "- "))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", file, lineNum, err)
+		}
+		cmd := lookupCommand(step[0])
+		if cmd == nil || cmd.name == "help" || cmd.name == "replay" {
+			return nil, fmt.Errorf("%s:%d: invalid subcommand %q", file, lineNum, step[0])
+		}
+		steps = append(steps, step)
+	}
+	return steps, scan.Err()
+}
+
+// splitCommandLine splits s into words separated by white space,
+// removing the quotes from words quoted by shellQuote or with
+// double quotes.
+func splitCommandLine(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(s[i+1:], c)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted argument")
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += 1 + end
+			inWord = true
+		case c == '\\' && i+1 < len(s):
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty step")
+	}
+	return words, nil
+}
+
+// parseRecipe sets replaySteps from the
+// recipe file given as the only argument.
+func (ctxt *context) parseRecipe(args []string) {
+	if len(args) != 1 {
+		fatalf("replay takes exactly one recipe file")
+	}
+	steps, err := readRecipe(args[0])
+	if err != nil {
+		fatalf("cannot read recipe: %v", err)
+	}
+	replaySteps = steps
+}
+
+// runReplay runs each step of the recipe in turn in the
+// current directory, stopping at the first that fails.
+// With -n, each step is run with -n too.
+func runReplay(ctxt *context) {
+	exe, err := os.Executable()
+	if err != nil {
+		fatalf("cannot find govers executable: %v", err)
+	}
+	for i, step := range replaySteps {
+		args := step
+		if *noEdit {
+			args = append([]string{step[0], "-n"}, step[1:]...)
+		}
+		logf("step %d of %d: govers %s", i+1, len(replaySteps), quoteArgs(args))
+		cmd := exec.Command(exe, args...)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			logf("step %d failed: %v; the remaining steps were not run", i+1, err)
+			os.Exit(1)
+		}
+	}
+}
+
+// quoteArgs returns args as a shell command line.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var releaseSubdir bool
+
+// release holds the module moved to a new major
+// version by the release subcommand.
+var release struct {
+	// dir holds the root directory of the module
+	// to change, which is a copy with -subdir.
+	dir string
+
+	oldPath, newPath string
+
+	// subdir holds the directory for the new major
+	// version with -subdir, and deeper whether that
+	// is within the module's original directory.
+	subdir string
+	deeper bool
+}
+
+// parseRelease parses the argument to the release subcommand,
+// the major version to move the module in the current directory
+// to, such as v2, setting ctxt.rules to change the imports of
+// the module's packages to use its new path. With -subdir, it
+// copies the module into the subdirectory for the new version,
+// which becomes the tree to change.
+func (ctxt *context) parseRelease(args []string) {
+	if len(args) != 1 {
+		fatalf("the release subcommand takes one argument, the new major version")
+	}
+	m := regexp.MustCompile(`^v([0-9]+)$`).FindStringSubmatch(args[0])
+	if m == nil {
+		fatalf("invalid major version %q; expected a version such as v2", args[0])
+	}
+	next, _ := strconv.Atoi(m[1])
+	gomod := filepath.Join(ctxt.cwd, "go.mod")
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		fatalf("the release subcommand must be run in the root directory of a module: %v", err)
+	}
+	oldPath := parseGoMod(data).module()
+	if oldPath == "" {
+		fatalf("%s: no module path found", ctxt.relPath(gomod))
+	}
+	family, sep, major := oldPath, "", 1
+	if sm := majorSuffixPat.FindStringSubmatch(oldPath); sm != nil {
+		family, sep = oldPath[:len(oldPath)-len(sm[0])], sm[0][:1]
+		major, _ = strconv.Atoi(sm[1])
+	}
+	if next <= major {
+		fatalf("%s is already at major version v%d", oldPath, major)
+	}
+	if next < 2 {
+		fatalf("cannot move %s to major version v%d", oldPath, next)
+	}
+	newPath := majorPath(family, sep, next)
+	r := &vers.Rule{
+		Arg:           newPath,
+		NewPackage:    newPath,
+		OldPackagePat: prefixPat(oldPath),
+	}
+	if sep == "" {
+		// The other major versions of the module
+		// have paths within the old one.
+		r.Exclude = regexp.MustCompile("^" + regexp.QuoteMeta(family) + `[/.]v[0-9]+(/|$)`)
+	}
+	ctxt.rules = vers.Rules{r}
+	// No dependency can import the new
+	// version before it is released.
+	*noDependencies = true
+	release.dir = ctxt.cwd
+	release.oldPath, release.newPath = oldPath, newPath
+	if !releaseSubdir {
+		return
+	}
+	if strings.HasPrefix(oldPath, "gopkg.in/") {
+		fatalf("-subdir cannot be used with gopkg.in modules, whose major version is chosen by branch")
+	}
+	release.subdir, release.deeper = filepath.Join(ctxt.cwd, "v"+m[1]), true
+	if filepath.Base(ctxt.cwd) == fmt.Sprintf("v%d", major) && sep != "" {
+		// The module is itself in a major
+		// subdirectory of an older version.
+		release.subdir, release.deeper = filepath.Join(filepath.Dir(ctxt.cwd), "v"+m[1]), false
+	}
+	if _, err := os.Stat(release.subdir); err == nil {
+		fatalf("cannot copy %s to %s: it already exists", oldPath, ctxt.relPath(release.subdir))
+	}
+	if *noEdit {
+		// The imports to change are
+		// found in the original.
+		logf("would copy the module to %s", ctxt.relPath(release.subdir))
+		return
+	}
+	if err := copyModule(ctxt.cwd, release.subdir); err != nil {
+		fatalf("cannot copy %s to %s: %v", oldPath, ctxt.relPath(release.subdir), err)
+	}
+	release.dir = release.subdir
+	ctxt.dir = release.subdir
+	ctxt.newTree = true
+}
+
+// runRelease moves the module parsed by parseRelease to its
+// new major version, changing the imports of its packages as
+// the rewrite subcommand would, and then the module path in
+// its go.mod file.
+func runRelease(ctxt *context) {
+	runRewrite(ctxt)
+	gomod := filepath.Join(release.dir, "go.mod")
+	data, err := os.ReadFile(gomod)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	m := parseGoMod(data)
+	m.setModule(release.newPath)
+	if release.deeper {
+		// The copy is one directory further
+		// from any local replacements.
+		m.moveReplaceDirs("..")
+	}
+	if *noEdit {
+		if release.subdir != "" {
+			gomod = filepath.Join(release.subdir, "go.mod")
+		}
+		logf("%s: would declare module %s", ctxt.relPath(gomod), release.newPath)
+		return
+	}
+	info, err := os.Stat(gomod)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	if err := os.WriteFile(gomod, m.bytes(), info.Mode().Perm()); err != nil {
+		fatalf("cannot update %s: %v", ctxt.relPath(gomod), err)
+	}
+	if release.subdir != "" {
+		logf("copied %s to %s as %s", release.oldPath, ctxt.relPath(release.subdir), release.newPath)
+	} else {
+		logf("%s now declares module %s", ctxt.relPath(gomod), release.newPath)
+	}
+}
+
+// copyModule copies the files of the module in dir to the new
+// directory to, leaving out nested modules, such as the major
+// subdirectories of other versions, directories whose names
+// start with a dot, and to itself when it is within dir.
+func copyModule(dir, to string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(to, rel)
+		if d.IsDir() {
+			if path == to {
+				// With -subdir the copy is made within
+				// dir, so the walk comes to it, and it
+				// must not be copied into itself.
+				return filepath.SkipDir
+			}
+			if path != dir {
+				if strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+					return filepath.SkipDir
+				}
+			}
+			return os.MkdirAll(target, 0o777)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return copyFile(target, path, info.Mode().Perm())
+	})
+}
+
+// copyFile copies the file from to the new file to,
+// which is created with the given permissions.
+func copyFile(to, from string, perm fs.FileMode) error {
+	r, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	w, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, r)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
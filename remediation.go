@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// printRemediation prints, for each repository holding
+// a package that uses an inconsistent path, a command
+// that can be used to fix it.
+func (ctxt *context) printRemediation() {
+	if !ctxt.result.Failed() {
+		return
+	}
+	repos := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, f := range ctxt.result.Findings {
+		if seen[f.Importer] {
+			continue
+		}
+		seen[f.Importer] = true
+		root := repoRoot(f.Dir)
+		repos[root] = append(repos[root], f.Importer)
+	}
+	roots := make([]string, 0, len(repos))
+	for root := range repos {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	args, newPackages := ctxt.fixCommand()
+	uses := strings.Join(newPackages, ", ")
+	if ctxt.mapper != nil {
+		uses = "the new paths"
+	}
+	fmt.Fprintf(os.Stderr, "\nTo fix the inconsistent dependencies:\n")
+	for _, root := range roots {
+		pkgs := repos[root]
+		sort.Strings(pkgs)
+		fmt.Fprintf(os.Stderr, "\n\t# %s\n", strings.Join(pkgs, ", "))
+		if vers.InModuleCache(root) {
+			// The module cache is read-only, so the
+			// best we can do is suggest an alternative.
+			fmt.Fprintf(os.Stderr, "\t# %s is in the module cache; fork it and run\n", root)
+			fmt.Fprintf(os.Stderr, "\t#\t%s\n", args)
+			fmt.Fprintf(os.Stderr, "\t# in the fork, or go get a version that already uses %s\n", uses)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "\tcd %s && %s\n", shellQuote(root), args)
+	}
+}
+
+// fixCommand returns a govers command line that makes
+// the same changes as the current one, for running in
+// another repository, along with the new package paths
+// given by the rules.
+func (ctxt *context) fixCommand() (string, []string) {
+	args := "govers"
+	if *match != "" {
+		args += " -m " + shellQuote(*match)
+	}
+	if *notMatch != "" {
+		args += " -M " + shellQuote(*notMatch)
+	}
+	if *rewriterCmd != "" {
+		// The command is run from each repository's
+		// root, so a relative program name must be
+		// made absolute.
+		rewriter := *rewriterCmd
+		if prog := strings.Fields(rewriter)[0]; strings.ContainsRune(prog, filepath.Separator) && !filepath.IsAbs(prog) {
+			rewriter = filepath.Join(ctxt.cwd, prog) + strings.TrimPrefix(strings.TrimSpace(rewriter), prog)
+		}
+		args += " -rewriter " + shellQuote(rewriter)
+	}
+	for _, m := range mirrors {
+		args += " -mirror " + shellQuote(m)
+	}
+	if *vanity {
+		args += " -vanity"
+	}
+	var newPackages []string
+	seenArgs := make(map[string]bool)
+	for _, r := range ctxt.rules {
+		// Rules added for +incompatible requirements
+		// share the argument of the rule they extend,
+		// and those added by flags have none.
+		if seenArgs[r.Arg] || r.Arg == "" {
+			continue
+		}
+		seenArgs[r.Arg] = true
+		args += " " + shellQuote(r.Arg)
+		newPackages = append(newPackages, r.NewPackage)
+	}
+	return args, newPackages
+}
+
+// vcsDirs holds the names of the metadata directories
+// that mark the root of a repository.
+var vcsDirs = []string{".git", ".hg", ".bzr", ".svn"}
+
+// repoRoot returns the root of the repository containing
+// dir. If no repository is found, it returns dir itself.
+func repoRoot(dir string) string {
+	for d := dir; ; {
+		if isRepoRoot(d) {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d || filepath.Base(parent) == "src" {
+			break
+		}
+		d = parent
+	}
+	return dir
+}
+
+// shellQuote quotes s so that it can be safely
+// pasted into a shell command line.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:@=+,") == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/token"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var renameArgs stringsValue
+
+func init() {
+	flag.Var(&renameArgs, "rename", "rename the identifier `old=new` in files whose imports are changed (may be repeated)")
+}
+
+// parseRenames sets ctxt.renames from the -rename flags. Each
+// holds a qualified identifier, written as the old import path
+// of its package followed by a dot and its name, such as
+// gopkg.in/yaml.v2.UnmarshalStrict, then an equals sign and the
+// identifier's new name, optionally qualified in the same way by
+// the new import path of the package.
+func (ctxt *context) parseRenames() {
+	for _, arg := range renameArgs {
+		r, err := ctxt.parseRename(arg)
+		if err != nil {
+			fatalf("invalid -rename %q: %v", arg, err)
+		}
+		ctxt.renames = append(ctxt.renames, r)
+	}
+}
+
+func (ctxt *context) parseRename(arg string) (*vers.Rename, error) {
+	old, new, ok := strings.Cut(arg, "=")
+	if !ok {
+		return nil, fmt.Errorf("no = found")
+	}
+	oldPath, oldName, ok := splitQualified(old)
+	if !ok {
+		return nil, fmt.Errorf("%q is not a qualified identifier such as example.com/pkg.Name", old)
+	}
+	newName := new
+	if strings.Contains(new, ".") {
+		newPath, name, ok := splitQualified(new)
+		if !ok {
+			return nil, fmt.Errorf("%q is not an identifier or qualified identifier", new)
+		}
+		if ctxt.mapper == nil {
+			if fixed := ctxt.rules.Fix(oldPath); fixed != newPath {
+				return nil, fmt.Errorf("%s will be changed to %s, not %s", oldPath, fixed, newPath)
+			}
+		}
+		newName = name
+	}
+	if !token.IsIdentifier(newName) || !token.IsExported(newName) {
+		return nil, fmt.Errorf("%q is not an exported identifier", newName)
+	}
+	return &vers.Rename{
+		Path: oldPath,
+		Old:  oldName,
+		New:  newName,
+	}, nil
+}
+
+// splitQualified splits a qualified identifier such as
+// example.com/pkg.Name into its import path and name.
+func splitQualified(s string) (path, name string, ok bool) {
+	i := strings.LastIndex(s, ".")
+	if i < 0 || i < strings.LastIndex(s, "/") {
+		return "", "", false
+	}
+	path, name = s[0:i], s[i+1:]
+	if path == "" || !token.IsIdentifier(name) || !token.IsExported(name) {
+		return "", "", false
+	}
+	return path, name, true
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// reportFormats holds the output formats accepted by
+// the -format flag of the check subcommand, keyed by name.
+var reportFormats = map[string]func(w io.Writer, r *report) error{
+	"text":       writeTextReport,
+	"json":       writeJSONReport,
+	"checkstyle": writeCheckstyleReport,
+	"csv":        writeCSVReport,
+	"quickfix":   writeQuickfixReport,
+}
+
+// formatNames returns the names of the
+// available report formats.
+func formatNames() string {
+	var names []string
+	for name := range reportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// report holds the problems found by the check subcommand.
+type report struct {
+	// Findings holds the dependencies using
+	// inconsistent paths, and Waived holds those
+	// allowed to by -allow.
+	Findings []*vers.Finding
+	Waived   []*vers.Finding
+
+	// Changes holds the imports that would be
+	// rewritten, in file order.
+	Changes []*vers.ImportChange
+
+	// LockMismatches holds the imports that disagree
+	// with the versions pinned by legacy lock files.
+	LockMismatches []*lockMismatch
+
+	// MixedMajors holds the packages that import more
+	// than one major version of the same family.
+	MixedMajors []*vers.MixedMajors
+
+	// AllMajors holds the families imported under more
+	// than one major version anywhere in the import graph,
+	// when the check subcommand is given -all-majors.
+	AllMajors []*vers.FamilyMajors
+
+	// importers holds the package making each change.
+	importers map[*vers.ImportChange]*vers.Package
+
+	// changeStatus describes the state of the changes,
+	// such as "to change", for formats that show it.
+	changeStatus string
+}
+
+func newReport(plan *vers.Plan) *report {
+	r := &report{
+		Findings:     plan.Result.Findings,
+		Waived:       plan.Result.Waived,
+		MixedMajors:  plan.Result.MixedMajors,
+		importers:    make(map[*vers.ImportChange]*vers.Package),
+		changeStatus: "to change",
+	}
+	for _, edit := range plan.Files {
+		r.Changes = append(r.Changes, edit.Changes...)
+		for _, c := range edit.Changes {
+			r.importers[c] = edit.Package
+		}
+	}
+	return r
+}
+
+// failed reports whether any problems were found.
+func (r *report) failed() bool {
+	return len(r.Findings) > 0 && *depCheck == "error" || len(r.Changes) > 0 || len(r.LockMismatches) > 0 || len(r.MixedMajors) > 0 || len(r.AllMajors) > 0
+}
+
+func writeTextReport(w io.Writer, r *report) error {
+	for _, c := range r.Changes {
+		if _, err := fmt.Fprintf(w, "%s: import %q should be %q\n", c.Pos, c.Old, c.New); err != nil {
+			return err
+		}
+	}
+	for _, m := range r.LockMismatches {
+		if _, err := fmt.Fprintf(w, "%s\n", m); err != nil {
+			return err
+		}
+	}
+	for _, m := range r.MixedMajors {
+		if _, err := fmt.Fprintf(w, "package %q mixes major versions of %s: %s\n", m.Importer, m.Family, strings.Join(m.Paths, ", ")); err != nil {
+			return err
+		}
+	}
+	for _, m := range r.AllMajors {
+		var majors []string
+		for _, major := range m.Majors {
+			majors = append(majors, fmt.Sprintf("%s (imported by %s)", major, importerList(m.Importers[major])))
+		}
+		if _, err := fmt.Fprintf(w, "%s is imported under more than one major version: %s\n", m.Family, strings.Join(majors, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importerList describes the given importing packages,
+// naming only the first when there are several.
+func importerList(importers []string) string {
+	switch len(importers) {
+	case 1:
+		return fmt.Sprintf("%q", importers[0])
+	case 2:
+		return fmt.Sprintf("%q and 1 other", importers[0])
+	}
+	return fmt.Sprintf("%q and %d others", importers[0], len(importers)-1)
+}
+
+// jsonReport holds the form of a report
+// printed by -format json.
+type jsonReport struct {
+	Findings       []jsonFinding
+	Waived         []jsonFinding
+	Changes        []jsonChange
+	LockMismatches []jsonLockMismatch
+	MixedMajors    []jsonMixedMajors
+	AllMajors      []jsonFamilyMajors `json:",omitempty"`
+}
+
+type jsonFinding struct {
+	Importer   string
+	ImportPath string
+	Expected   string
+	Pos        string `json:",omitempty"`
+	Module     string
+	Chain      []string
+	TopLevel   string
+	VendorDir  string `json:",omitempty"`
+}
+
+type jsonChange struct {
+	Path string
+	Line int
+	Old  string
+	New  string
+}
+
+type jsonLockMismatch struct {
+	Path       string
+	Line       int
+	Project    string
+	Version    string
+	Importer   string
+	ImportPath string
+}
+
+type jsonFamilyMajors struct {
+	Family    string
+	Majors    []string
+	Importers map[string][]string
+}
+
+type jsonMixedMajors struct {
+	Importer string
+	Family   string
+	Paths    []string
+	Module   string
+}
+
+func newJSONFinding(f *vers.Finding) jsonFinding {
+	jf := jsonFinding{
+		Importer:   f.Importer,
+		ImportPath: f.ImportPath,
+		Expected:   f.Expected,
+		Module:     f.Module.Name(),
+		Chain:      f.Chain,
+		TopLevel:   f.TopLevel,
+		VendorDir:  f.VendorDir,
+	}
+	if f.Pos.IsValid() {
+		jf.Pos = f.Pos.String()
+	}
+	return jf
+}
+
+func writeJSONReport(w io.Writer, r *report) error {
+	out := jsonReport{
+		Findings:       []jsonFinding{},
+		Waived:         []jsonFinding{},
+		Changes:        []jsonChange{},
+		LockMismatches: []jsonLockMismatch{},
+		MixedMajors:    []jsonMixedMajors{},
+	}
+	for _, f := range r.Findings {
+		out.Findings = append(out.Findings, newJSONFinding(f))
+	}
+	for _, f := range r.Waived {
+		out.Waived = append(out.Waived, newJSONFinding(f))
+	}
+	for _, c := range r.Changes {
+		out.Changes = append(out.Changes, jsonChange{
+			Path: c.Pos.Filename,
+			Line: c.Pos.Line,
+			Old:  c.Old,
+			New:  c.New,
+		})
+	}
+	for _, m := range r.LockMismatches {
+		out.LockMismatches = append(out.LockMismatches, jsonLockMismatch{
+			Path:       m.project.file,
+			Line:       m.project.line,
+			Project:    m.project.name,
+			Version:    m.project.pinned(),
+			Importer:   m.importer,
+			ImportPath: m.importPath,
+		})
+	}
+	for _, m := range r.MixedMajors {
+		out.MixedMajors = append(out.MixedMajors, jsonMixedMajors{
+			Importer: m.Importer,
+			Family:   m.Family,
+			Paths:    m.Paths,
+			Module:   m.Module.Name(),
+		})
+	}
+	for _, m := range r.AllMajors {
+		out.AllMajors = append(out.AllMajors, jsonFamilyMajors{
+			Family:    m.Family,
+			Majors:    m.Majors,
+			Importers: m.Importers,
+		})
+	}
+	data, err := json.MarshalIndent(out, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// summaryFormats holds the formats accepted by the -report flag,
+// keyed by name. Each writes a report of the changes in plan,
+// which holds no changes when the checks failed before any
+// were planned.
+var summaryFormats = map[string]func(ctxt *context, w io.Writer, plan *vers.Plan) error{
+	"md":         (*context).writeMarkdownSummary,
+	"junit":      (*context).writeJUnitReport,
+	"checkstyle": (*context).writeCheckstyleSummary,
+	"csv":        (*context).writeCSVSummary,
+	"html":       (*context).writeHTMLReport,
+	"prometheus": (*context).writePrometheusReport,
+}
+
+// summaryFormatNames returns the names of the
+// formats accepted by the -report flag.
+func summaryFormatNames() string {
+	var names []string
+	for name := range summaryFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// reportSpec holds a report requested with -report.
+type reportSpec struct {
+	format string
+
+	// file holds the file to write the report to,
+	// or "" for standard output.
+	file string
+}
+
+// parseReports sets ctxt.reports from the -report flags,
+// each a format optionally followed by "=" and the file to
+// write the report to. Only one report can be printed.
+func (ctxt *context) parseReports() {
+	printed := 0
+	for _, arg := range reportArgs {
+		format, file, _ := strings.Cut(arg, "=")
+		if summaryFormats[format] == nil {
+			fatalf("invalid -report %q; format must be one of %s", arg, summaryFormatNames())
+		}
+		if file == "" {
+			printed++
+		}
+		ctxt.reports = append(ctxt.reports, reportSpec{format, file})
+	}
+	if printed > 1 {
+		fatalf("only one -report can be printed; give the others a file")
+	}
+	if printed > 0 && *eventsFile == "-" {
+		fatalf("-events - cannot be used with a -report printed to standard output; give the report a file")
+	}
+}
+
+// printsReport reports whether a report is to be printed
+// in place of the import paths of the changed packages.
+func (ctxt *context) printsReport() bool {
+	for _, r := range ctxt.reports {
+		if r.file == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// printsPackages reports whether the import paths of the
+// changed packages are printed, as they are unless a report
+// or the -events stream is printed to standard output instead.
+func (ctxt *context) printsPackages() bool {
+	return !ctxt.printsReport() && *eventsFile != "-"
+}
+
+// writeReports writes each report requested with -report.
+func (ctxt *context) writeReports(plan *vers.Plan) {
+	for _, r := range ctxt.reports {
+		write := summaryFormats[r.format]
+		if r.file == "" {
+			if err := write(ctxt, os.Stdout, plan); err != nil {
+				fatalf("cannot write report: %v", err)
+			}
+			continue
+		}
+		// The report is written to a temporary file that then
+		// replaces the file, so that anything reading it, such
+		// as a metrics collector, never sees a partial report.
+		f, err := os.CreateTemp(filepath.Dir(r.file), ".govers-report")
+		if err != nil {
+			fatalf("cannot write report: %v", err)
+		}
+		err = write(ctxt, f, plan)
+		if err == nil {
+			err = f.Chmod(0o644)
+		}
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), r.file)
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			fatalf("cannot write report to %s: %v", r.file, err)
+		}
+	}
+}
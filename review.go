@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// reviewContext holds the number of lines shown
+// on each side of a change under review.
+const reviewContext = 3
+
+const reviewHelp = `y - make this change
+n - don't make this change
+a - make this change and all later changes
+q - don't make this change or any later changes
+`
+
+// reviewer holds the state of an interactive review.
+type reviewer struct {
+	in *bufio.Reader
+
+	// decided holds whether all remaining changes
+	// have already been accepted or rejected,
+	// and accept holds which.
+	decided bool
+	accept  bool
+}
+
+// reviewChange shows the given change with its surrounding
+// context and asks whether it should be made.
+func (ctxt *context) reviewChange(c *vers.ImportChange) bool {
+	rv := &ctxt.reviewer
+	if rv.decided {
+		return rv.accept
+	}
+	if rv.in == nil {
+		rv.in = bufio.NewReader(os.Stdin)
+	}
+	pos := c.Pos
+	fmt.Fprintf(os.Stderr, "%s:%d\n", pos.Filename, pos.Line)
+	if data, err := ioutil.ReadFile(pos.Filename); err == nil {
+		lines := strings.Split(string(data), "\n")
+		for i := pos.Line - 1 - reviewContext; i <= pos.Line-1+reviewContext; i++ {
+			switch {
+			case i < 0 || i >= len(lines):
+			case i == pos.Line-1:
+				fmt.Fprintf(os.Stderr, "-%s\n", lines[i])
+				fmt.Fprintf(os.Stderr, "+%s\n", strings.Replace(lines[i], c.Old, c.New, 1))
+			default:
+				fmt.Fprintf(os.Stderr, " %s\n", lines[i])
+			}
+		}
+	}
+	for {
+		fmt.Fprintf(os.Stderr, "Change this import [y,n,a,q,?]? ")
+		line, err := rv.in.ReadString('\n')
+		if err != nil {
+			// No more input; leave everything else alone.
+			fmt.Fprintf(os.Stderr, "\n")
+			rv.decided = true
+			return false
+		}
+		switch strings.TrimSpace(line) {
+		case "y":
+			return true
+		case "n":
+			return false
+		case "a":
+			rv.decided, rv.accept = true, true
+			return true
+		case "q":
+			rv.decided, rv.accept = true, false
+			return false
+		default:
+			fmt.Fprintf(os.Stderr, "%s", reviewHelp)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package main
+
+import "flag"
+
+var roots stringsValue
+
+func init() {
+	flag.Var(&roots, "roots", "check and change only the packages reachable from those matching the package `pattern`, such as ./cmd/... (may be repeated)")
+}
+
+// parseRoots sets ctxt.roots from the -roots patterns,
+// which are relative to the current directory, so that
+// they are relative to the root of the tree instead.
+func (ctxt *context) parseRoots() {
+	for _, pat := range roots {
+		ctxt.roots = append(ctxt.roots, ctxt.relPattern(pat, ctxt.dir))
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+var verifySum = flag.Bool("verify-sum", false, "verify each version to be required in go.mod against the checksum database before making any changes")
+
+// sumDB holds the checksum database named by GOSUMDB.
+type sumDB struct {
+	name string
+	url  string
+}
+
+// newSumDB returns the checksum database named by GOSUMDB,
+// or nil if GOSUMDB is off.
+func newSumDB() *sumDB {
+	env := os.Getenv("GOSUMDB")
+	if env == "" {
+		env = "sum.golang.org"
+	}
+	if env == "off" {
+		return nil
+	}
+	// GOSUMDB holds the database's name, optionally followed
+	// by its public key, and then optionally by its URL.
+	fields := strings.Fields(env)
+	db := &sumDB{
+		name: strings.SplitN(fields[0], "+", 2)[0],
+	}
+	db.url = "https://" + db.name
+	if len(fields) > 1 {
+		db.url = strings.TrimSuffix(fields[1], "/")
+	}
+	return db
+}
+
+// verifySums checks each version in ctxt.pins against the
+// checksum database, failing if the module proxy serves content
+// for it that does not match the hashes the database records,
+// so that a migration cannot require a version that the go
+// command would refuse to download. Modules matched by
+// GONOSUMDB (or GOPRIVATE) are not looked up.
+func (ctxt *context) verifySums() {
+	db := newSumDB()
+	if db == nil {
+		fatalf("-verify-sum cannot be used with GOSUMDB=off")
+	}
+	proxy := newGoProxy()
+	noSumDB := privatePatterns("GONOSUMDB")
+	for _, pn := range ctxt.pins {
+		if matchPrefixPatterns(noSumDB, pn.path) {
+			logf("%s@%s: private module (matched by GONOSUMDB or GOPRIVATE), so not verified", pn.path, pn.version)
+			continue
+		}
+		if err := db.verify(proxy, pn.path, pn.version); err != nil {
+			fatalf("%v", err)
+		}
+	}
+}
+
+// verify checks the go.mod file and source of the given version
+// of a module, as served by proxy, against the hashes recorded
+// for it in the database. Note that, unlike the go command, it
+// does not itself check that the record is included in the
+// database's signed tree.
+func (db *sumDB) verify(proxy *goProxy, modPath, version string) error {
+	want, err := db.lookup(modPath, version)
+	if err != nil {
+		return fmt.Errorf("verifying %s@%s: %v", modPath, version, err)
+	}
+	for _, name := range []string{"go.mod", "zip"} {
+		key := version
+		if name == "go.mod" {
+			key += "/go.mod"
+		}
+		if want[key] == "" {
+			return fmt.Errorf("verifying %s@%s: %s has no %s hash for it", modPath, version, db.name, name)
+		}
+		var got string
+		if name == "go.mod" {
+			data, err := proxy.get(modPath, "@v/"+escapePath(version)+".mod")
+			if err != nil {
+				return fmt.Errorf("verifying %s@%s: cannot download go.mod: %v", modPath, version, err)
+			}
+			got, _ = hashFiles([]string{"go.mod"}, func(string) ([]byte, error) {
+				return data, nil
+			})
+		} else {
+			data, err := proxy.get(modPath, "@v/"+escapePath(version)+".zip")
+			if err != nil {
+				return fmt.Errorf("verifying %s@%s: cannot download module: %v", modPath, version, err)
+			}
+			if got, err = hashZip(data); err != nil {
+				return fmt.Errorf("verifying %s@%s: %v", modPath, version, err)
+			}
+		}
+		if got != want[key] {
+			return fmt.Errorf("verifying %s@%s: %s checksum mismatch\n\tdownloaded: %s\n\t%s: %s", modPath, version, name, got, db.name, want[key])
+		}
+	}
+	return nil
+}
+
+// lookup returns the hashes that the database records for
+// the given version of a module, keyed by the version for
+// the module's source and by the version followed by
+// "/go.mod" for its go.mod file.
+func (db *sumDB) lookup(modPath, version string) (map[string]string, error) {
+	resp, data, err := netGet(db.url + "/lookup/" + escapePath(modPath) + "@" + escapePath(version))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg := strings.SplitN(strings.TrimSpace(string(data)), "\n", 2)[0]
+		return nil, fmt.Errorf("%s: %s: %s", db.name, resp.Status, msg)
+	}
+	// The record's first line holds its number in the log,
+	// and it ends at the blank line before the signed tree.
+	hashes := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		if line == "" {
+			break
+		}
+		f := strings.Fields(line)
+		if len(f) == 3 && f[0] == modPath {
+			hashes[f[1]] = f[2]
+		}
+	}
+	return hashes, nil
+}
+
+// hashZip returns the hash of the module zip file held in data,
+// as recorded in go.sum files.
+func hashZip(data []byte) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("cannot read module zip: %v", err)
+	}
+	files := make(map[string]*zip.File)
+	var names []string
+	for _, f := range zr.File {
+		files[f.Name] = f
+		names = append(names, f.Name)
+	}
+	return hashFiles(names, func(name string) ([]byte, error) {
+		r, err := files[name].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	})
+}
+
+// hashFiles returns the "h1:" hash of the named files, whose
+// contents are returned by open, computed as the go command
+// computes it: the SHA-256 hash of a summary listing the
+// SHA-256 hash and name of each file in name order.
+func hashFiles(names []string, open func(string) ([]byte, error)) (string, error) {
+	names = append([]string(nil), names...)
+	sort.Strings(names)
+	summary := sha256.New()
+	for _, name := range names {
+		if strings.Contains(name, "\n") {
+			return "", fmt.Errorf("file name %q contains a newline", name)
+		}
+		data, err := open(name)
+		if err != nil {
+			return "", fmt.Errorf("cannot read %s: %v", name, err)
+		}
+		fmt.Fprintf(summary, "%x  %s\n", sha256.Sum256(data), name)
+	}
+	return "h1:" + base64.StdEncoding.EncodeToString(summary.Sum(nil)), nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// printSummary prints the results for each module
+// when the tree contains more than one. The applied
+// parameter holds whether changes have been made to
+// the modules that passed their checks.
+func (ctxt *context) printSummary(applied bool) {
+	if len(ctxt.result.Modules) < 2 {
+		return
+	}
+	for _, mod := range ctxt.result.Modules {
+		name := mod.Name()
+		var offenders []string
+		if mod.Failed {
+			seen := make(map[string]bool)
+			for _, f := range ctxt.result.Findings {
+				if f.Module == mod && !seen[f.Importer] {
+					seen[f.Importer] = true
+					offenders = append(offenders, f.Importer)
+				}
+			}
+			sort.Strings(offenders)
+		}
+		var msg string
+		switch {
+		case mod.Failed && *depCheck == "error":
+			logf("module %s: not changed; inconsistent dependencies: %s", name, strings.Join(offenders, ", "))
+			continue
+		case ctxt.checkOnly:
+			msg = "ok"
+		case !applied:
+			msg = "ok, but not changed because other modules failed (see -isolate)"
+		case *noEdit:
+			msg = fmt.Sprintf("ok, %s would be changed", packageCount(ctxt.changed[mod]))
+		default:
+			msg = fmt.Sprintf("ok, %s changed", packageCount(ctxt.changed[mod]))
+		}
+		if mod.Failed {
+			// With -dep-check=warn, the module is
+			// changed despite its findings.
+			msg += "; warning: inconsistent dependencies: " + strings.Join(offenders, ", ")
+		}
+		logf("module %s: %s", name, msg)
+	}
+}
+
+func packageCount(n int) string {
+	if n == 1 {
+		return "1 package"
+	}
+	return fmt.Sprintf("%d packages", n)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"time"
+)
+
+var (
+	trace       = flag.Bool("x", false, "print each phase with its duration, and each directory, package and file as it is processed")
+	debugTiming = flag.Bool("debug-timing", false, "print the time taken by each phase of the work")
+)
+
+// phaseFunc returns the function to report the time taken by
+// each phase, or nil if neither -x nor -debug-timing was given.
+func phaseFunc() func(name string, d time.Duration) {
+	if !*trace && !*debugTiming {
+		return nil
+	}
+	return func(name string, d time.Duration) {
+		logf("%s took %v", name, d.Round(time.Microsecond))
+	}
+}
+
+// tracefFunc returns the function to trace each directory,
+// package and file as it is processed, or nil if -x was not
+// given.
+func tracefFunc() func(f string, a ...interface{}) {
+	if !*trace {
+		return nil
+	}
+	return logf
+}
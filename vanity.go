@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/build"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var vanity = flag.Bool("vanity", false, "also change imports that use a repository's own path in place of its vanity import path")
+
+// vanityHosts holds the code hosting sites whose repositories
+// are commonly imported through vanity import paths.
+var vanityHosts = []string{"github.com", "gitlab.com", "bitbucket.org"}
+
+// addVanityRules adds a rule to ctxt.rules for each repository
+// that the tree imports by its path on a code hosting site in
+// place of the vanity import path that it declares, as when
+// golang.org/x/net is imported as github.com/golang/net. The
+// vanity path is found from the canonical import comment of
+// an imported package, and is only used if the meta tags served
+// for it name the same repository (see checkVanityPath).
+func (ctxt *context) addVanityRules() {
+	if ctxt.mapper != nil {
+		fatalf("-vanity cannot be used with -rewriter")
+	}
+	rw := ctxt.newRewriter(vers.WithoutDependencies(true), vers.WithDryRun(true))
+	result, err := rw.Scan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	seen := make(map[string]bool)
+	found := make(map[string]string)
+	var direct []string
+	for _, imp := range result.Imports {
+		p := imp.To
+		if seen[p] || isStandard(p) || !onVanityHost(p) {
+			continue
+		}
+		seen[p] = true
+		pkg, err := ctxt.buildCtxt.Import(p, ctxt.dir, build.ImportComment)
+		if err != nil || pkg.ImportComment == "" || pkg.ImportComment == p {
+			continue
+		}
+		old, new, ok := vanityRoot(p, pkg.ImportComment)
+		if !ok || found[old] != "" {
+			continue
+		}
+		found[old] = new
+		direct = append(direct, old)
+	}
+	sort.Strings(direct)
+	for _, old := range direct {
+		new := found[old]
+		if err := checkVanityPath(new, old); err != nil {
+			logf("not changing imports of %s to %s: %v", old, new, err)
+			continue
+		}
+		logf("imports of %s bypass its vanity import path; they will be changed to %s", old, new)
+		// The rule has no argument, as -vanity
+		// will add it again wherever it is run.
+		ctxt.rules = append(ctxt.rules, &vers.Rule{
+			NewPackage:    new,
+			OldPackagePat: regexp.MustCompile("^(" + regexp.QuoteMeta(old) + ")(/|$)"),
+		})
+	}
+}
+
+// onVanityHost reports whether p is on one of vanityHosts.
+func onVanityHost(p string) bool {
+	host, _, _ := strings.Cut(p, "/")
+	return contains(vanityHosts, host)
+}
+
+// vanityRoot returns the root of the repository holding the
+// package with import path p on a code hosting site, such as
+// github.com/golang/net, and the corresponding prefix of the
+// canonical import path of the package, such as golang.org/x/net.
+// It reports false if the canonical path does not have the same
+// path within the repository.
+func vanityRoot(p, canonical string) (root, vanityPath string, ok bool) {
+	elems := strings.SplitN(p, "/", 4)
+	if len(elems) < 3 {
+		return "", "", false
+	}
+	root = strings.Join(elems[:3], "/")
+	rest := p[len(root):]
+	vanityPath, ok = strings.CutSuffix(canonical, rest)
+	if !ok || vanityPath == "" || vanityPath == root {
+		return "", "", false
+	}
+	return root, vanityPath, true
+}
+
+var (
+	metaTagPat  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrPat = regexp.MustCompile(`(?s)([a-zA-Z-]+)\s*=\s*("[^"]*"|'[^']*')`)
+)
+
+// checkVanityPath checks that the go-import meta tag served for
+// the vanity import path names the repository at the given path
+// on a code hosting site, or that its go-source meta tag does, as
+// it does when that repository is a mirror, such as the GitHub
+// mirrors of the golang.org/x repositories.
+func checkVanityPath(vanityPath, repoPath string) error {
+	resp, data, err := netGet("https://" + vanityPath + "?go-get=1")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", vanityPath, resp.Status)
+	}
+	var served []string
+	for _, tag := range metaTags(string(data)) {
+		if tag.prefix != vanityPath && !strings.HasPrefix(vanityPath, tag.prefix+"/") {
+			continue
+		}
+		if repoURLPath(tag.url) == strings.ToLower(repoPath) {
+			return nil
+		}
+		served = append(served, tag.url)
+	}
+	if len(served) == 0 {
+		return fmt.Errorf("no go-import meta tag found for %s", vanityPath)
+	}
+	return fmt.Errorf("%s is served from %s, not %s", vanityPath, strings.Join(served, ", "), repoPath)
+}
+
+// repoURLPath returns the host and path of a repository URL,
+// without any trailing slash or ".git", in lower case.
+func repoURLPath(u string) string {
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+3:]
+	}
+	u = strings.TrimSuffix(strings.TrimSuffix(u, "/"), ".git")
+	return strings.ToLower(u)
+}
+
+// metaTag holds the import path prefix and repository URL
+// given by a go-import meta tag, or the prefix and home page
+// given by a go-source meta tag.
+type metaTag struct {
+	prefix, url string
+}
+
+// metaTags returns the go-import and go-source
+// meta tags in the given HTML.
+func metaTags(html string) []metaTag {
+	var tags []metaTag
+	for _, tag := range metaTagPat.FindAllString(html, -1) {
+		attrs := make(map[string]string)
+		for _, m := range metaAttrPat.FindAllStringSubmatch(tag, -1) {
+			attrs[strings.ToLower(m[1])] = m[2][1 : len(m[2])-1]
+		}
+		f := strings.Fields(attrs["content"])
+		switch {
+		case attrs["name"] == "go-import" && len(f) == 3:
+			tags = append(tags, metaTag{f[0], f[2]})
+		case attrs["name"] == "go-source" && len(f) >= 2:
+			tags = append(tags, metaTag{f[0], f[1]})
+		}
+	}
+	return tags
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// journal records the original contents of the files
+// that govers changes, so that the changes can be undone.
+type journal struct {
+	files []string
+
+	// saved maps from each file recorded to its original
+	// contents, or nil if it did not exist.
+	saved map[string][]byte
+}
+
+func newJournal() *journal {
+	return &journal{
+		saved: make(map[string][]byte),
+	}
+}
+
+// record records the current contents of the given
+// file, unless they have already been recorded.
+func (j *journal) record(file string) error {
+	if _, ok := j.saved[file]; ok {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	j.files = append(j.files, file)
+	j.saved[file] = data
+	return nil
+}
+
+// restore puts back the recorded contents of each file,
+// removing those that did not exist. It reports whether
+// all of them were restored.
+func (j *journal) restore() bool {
+	ok := true
+	for _, file := range j.files {
+		var err error
+		if data := j.saved[file]; data == nil {
+			err = os.Remove(file)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			mode := os.FileMode(0o666)
+			if info, serr := os.Stat(file); serr == nil {
+				mode = info.Mode().Perm()
+			}
+			err = os.WriteFile(file, data, mode)
+		}
+		if err != nil {
+			logf("cannot restore %s: %v", file, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// recordPlan records the files that may be changed by plan:
+// those to be edited, and the go.mod and go.sum files of the
+// modules in the tree, which may be changed by -require or
+// by the go command while verifying the changes.
+func (j *journal) recordPlan(ctxt *context, plan *vers.Plan) error {
+	for _, edit := range plan.Files {
+		if len(edit.Changes) > 0 {
+			if err := j.record(edit.Path); err != nil {
+				return err
+			}
+		}
+	}
+	for _, mod := range ctxt.result.Modules {
+		if mod.Path == "" {
+			continue
+		}
+		for _, name := range []string{"go.mod", "go.sum"} {
+			if err := j.record(filepath.Join(mod.Dir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// verifyChanges runs "go build" and then "go test" on the
+// changed packages in the tree, in the module holding each,
+// reporting whether they all succeeded. The output of each
+// command that fails is printed, followed by a list of the
+// failures.
+func (ctxt *context) verifyChanges(changed []*vers.Package) bool {
+	dirs := make(map[string][]string)
+	var roots []string
+	for _, p := range changed {
+		if p.External {
+			continue
+		}
+		root := p.Module.Dir
+		dir, err := filepath.Rel(root, p.Dir)
+		if err != nil {
+			dir = p.Dir
+		} else if dir != "." {
+			dir = "." + string(filepath.Separator) + dir
+		}
+		if _, ok := dirs[root]; !ok {
+			roots = append(roots, root)
+		}
+		dirs[root] = append(dirs[root], dir)
+	}
+	sort.Strings(roots)
+	var failures []string
+	for _, root := range roots {
+		for _, verb := range []string{"build", "test"} {
+			args := append([]string{verb}, dirs[root]...)
+			cmd := exec.Command("go", args...)
+			cmd.Dir = root
+			var out bytes.Buffer
+			cmd.Stdout = &out
+			cmd.Stderr = &out
+			if err := cmd.Run(); err != nil {
+				os.Stderr.Write(out.Bytes())
+				failures = append(failures, fmt.Sprintf("go %s in %s: %v", strings.Join(args, " "), ctxt.relPath(root), err))
+				// There is no point testing what
+				// does not build.
+				break
+			}
+		}
+	}
+	if len(failures) == 0 {
+		return true
+	}
+	logf("verification failed:")
+	for _, f := range failures {
+		fmt.Fprintf(os.Stderr, "\t%s\n", f)
+	}
+	return false
+}
+
+// undoChanges restores the files recorded in the journal
+// after a failure, and exits; it does not return.
+func (ctxt *context) undoChanges(j *journal) {
+	if j.restore() {
+		logf("undid all changes (%d files restored)", len(j.files))
+	} else {
+		logf("could not undo all changes")
+	}
+	ctxt.exit(1)
+}
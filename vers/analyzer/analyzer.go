@@ -0,0 +1,248 @@
+// Package analyzer provides the check made by the govers command
+// as an analysis.Analyzer, so that it can be run by go vet -vettool,
+// gopls or a multichecker binary along with other analyzers. It
+// reports each import that needs changing by a set of rewrite rules,
+// with a suggested fix that changes it, and each import of a
+// dependency that uses, or depends on a package that uses, an
+// import path that needs changing.
+package analyzer
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+const doc = `check that imports use paths consistent with govers rewrite rules
+
+The govers analyzer reports each import path that needs changing
+by the rewrite rules given by the -new flag, a comma-separated list
+of new-package-path arguments as taken by the govers command, with
+a suggested fix that changes it. It also reports each import of a
+dependency that uses, or depends on a package that uses, an import
+path that needs changing.`
+
+// Analyzer reports the imports that need changing by the
+// new-package-path arguments given by its -new flag.
+var Analyzer = New(nil)
+
+// New returns an analyzer like Analyzer that, when no -new flag
+// is given, calls defaultRules with the directory of each package
+// to find the rules for it. Packages for which it returns no rules
+// are not checked themselves, but the inconsistent paths used by
+// their dependencies are still reported.
+func New(defaultRules func(dir string) (vers.Rules, error)) *analysis.Analyzer {
+	a := &analysis.Analyzer{
+		Name:             "govers",
+		Doc:              doc,
+		URL:              "https://github.com/rogpeppe/govers",
+		FactTypes:        []analysis.Fact{new(inconsistentImports)},
+		RunDespiteErrors: true,
+	}
+	var newPaths string
+	a.Flags.StringVar(&newPaths, "new", "", "comma-separated list of new-package-path arguments")
+	a.Run = func(pass *analysis.Pass) (interface{}, error) {
+		dir := packageDir(pass)
+		var rules vers.Rules
+		switch {
+		case newPaths != "":
+			for _, arg := range strings.Split(newPaths, ",") {
+				r, err := vers.ParseRule(arg, "", "")
+				if err != nil {
+					return nil, err
+				}
+				rules = append(rules, r)
+			}
+		case defaultRules != nil:
+			if dir == "" {
+				break
+			}
+			var err error
+			if rules, err = defaultRules(dir); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("no new-package-path given; use the -new flag")
+		}
+		return nil, run(pass, dir, rules)
+	}
+	return a
+}
+
+// inconsistentImports is the fact recorded for each package that
+// uses, or depends on a package that uses, an import path that
+// needs changing.
+type inconsistentImports struct {
+	Imports []inconsistentImport
+}
+
+func (*inconsistentImports) AFact() {}
+
+func (f *inconsistentImports) String() string {
+	var parts []string
+	for _, imp := range f.Imports {
+		parts = append(parts, fmt.Sprintf("%s uses %s, not %s", imp.Importer, imp.ImportPath, imp.Expected))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// inconsistentImport holds a single import that needs changing.
+type inconsistentImport struct {
+	Importer   string
+	ImportPath string
+	Expected   string
+}
+
+// packageDir returns the directory holding the
+// package's files, or "" if it has none.
+func packageDir(pass *analysis.Pass) string {
+	for _, f := range pass.Files {
+		if name := pass.Fset.File(f.FileStart).Name(); strings.HasSuffix(name, ".go") {
+			return filepath.Dir(name)
+		}
+	}
+	return ""
+}
+
+// run reports the imports in the package that need changing by
+// rules, as planned by a govers Rewriter over the package's
+// directory, and the imports of dependencies whose facts show that
+// they need changing, exporting the facts for the package itself.
+func run(pass *analysis.Pass, dir string, rules vers.Rules) error {
+	facts := new(inconsistentImports)
+	seen := make(map[inconsistentImport]bool)
+	addFact := func(imp inconsistentImport) {
+		if !seen[imp] {
+			seen[imp] = true
+			facts.Imports = append(facts.Imports, imp)
+		}
+	}
+	// files holds the package's files in dir by name, as the
+	// Rewriter may give dir in a different form, such as with
+	// a drive letter in upper case.
+	files := make(map[string]*token.File)
+	for _, f := range pass.Files {
+		tf := pass.Fset.File(f.FileStart)
+		if filepath.Dir(tf.Name()) == dir {
+			files[filepath.Base(tf.Name())] = tf
+		}
+	}
+	// changed holds the position of each import
+	// path that is itself reported as needing change.
+	changed := make(map[token.Pos]bool)
+	if len(rules) > 0 && dir != "" {
+		rw := vers.NewRewriter(
+			vers.WithDir(dir),
+			vers.WithRules(rules...),
+			vers.WithoutSubdirectories(true),
+			vers.WithoutDependencies(true),
+			vers.WithoutFailing(true),
+			vers.WithDryRun(true),
+		)
+		plan, err := rw.Plan()
+		if err != nil {
+			return err
+		}
+		for _, edit := range plan.Files {
+			tf := files[filepath.Base(edit.Path)]
+			if tf == nil {
+				// The file is not part of this
+				// build of the package.
+				continue
+			}
+			for _, c := range edit.Changes {
+				if c.End > tf.Size() {
+					return fmt.Errorf("%s has changed since it was analyzed", edit.Path)
+				}
+				pos, end := tf.Pos(c.Offset), tf.Pos(c.End)
+				changed[pos] = true
+				addFact(inconsistentImport{pass.Pkg.Path(), c.Old, c.New})
+				msg := fmt.Sprintf("import %q should be %q", c.Old, c.New)
+				fixMsg := fmt.Sprintf("Change the import to %q", c.New)
+				if c.Directive {
+					msg = fmt.Sprintf("//go:linkname target in %q should be in %q", c.Old, c.New)
+					fixMsg = fmt.Sprintf("Change the //go:linkname target to %q", c.New)
+				}
+				pass.Report(analysis.Diagnostic{
+					Pos:     pos,
+					End:     end,
+					Message: msg,
+					SuggestedFixes: []analysis.SuggestedFix{{
+						Message: fixMsg,
+						TextEdits: []analysis.TextEdit{{
+							Pos:     pos,
+							End:     end,
+							NewText: []byte(c.Replacement),
+						}},
+					}},
+				})
+			}
+		}
+	}
+	for _, f := range pass.Files {
+		for _, ispec := range f.Imports {
+			if changed[ispec.Path.Pos()] {
+				continue
+			}
+			dep := importedPackage(pass, ispec)
+			if dep == nil {
+				continue
+			}
+			var depFacts inconsistentImports
+			if !pass.ImportPackageFact(dep, &depFacts) || len(depFacts.Imports) == 0 {
+				continue
+			}
+			for _, imp := range depFacts.Imports {
+				addFact(imp)
+			}
+			pass.Report(analysis.Diagnostic{
+				Pos:     ispec.Path.Pos(),
+				End:     ispec.Path.End(),
+				Message: dependencyMessage(dep.Path(), depFacts.Imports),
+			})
+		}
+	}
+	if len(facts.Imports) > 0 {
+		sort.Slice(facts.Imports, func(i, j int) bool {
+			fi, fj := facts.Imports[i], facts.Imports[j]
+			if fi.Importer != fj.Importer {
+				return fi.Importer < fj.Importer
+			}
+			return fi.ImportPath < fj.ImportPath
+		})
+		pass.ExportPackageFact(facts)
+	}
+	return nil
+}
+
+// importedPackage returns the package imported by ispec,
+// or nil if it is not known.
+func importedPackage(pass *analysis.Pass, ispec *ast.ImportSpec) *types.Package {
+	if pkgName := pass.TypesInfo.PkgNameOf(ispec); pkgName != nil {
+		return pkgName.Imported()
+	}
+	return nil
+}
+
+// dependencyMessage returns the message reporting that the
+// dependency with the given path brings in the given imports
+// that need changing.
+func dependencyMessage(path string, imports []inconsistentImport) string {
+	imp := imports[0]
+	var more string
+	if len(imports) > 1 {
+		more = fmt.Sprintf(" (and %d more)", len(imports)-1)
+	}
+	if imp.Importer == path {
+		return fmt.Sprintf("dependency %s is using inconsistent path %s, not %s%s", path, imp.ImportPath, imp.Expected, more)
+	}
+	return fmt.Sprintf("dependency %s brings in %s, which is using inconsistent path %s, not %s%s", path, imp.Importer, imp.ImportPath, imp.Expected, more)
+}
@@ -0,0 +1,15 @@
+package analyzer
+
+import (
+	"testing"
+
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	if err := Analyzer.Flags.Set("new", "gopkg.in/tomb.v3"); err != nil {
+		t.Fatal(err)
+	}
+	defer Analyzer.Flags.Set("new", "")
+	analysistest.RunWithSuggestedFixes(t, analysistest.TestData(), Analyzer, "a", "b", "c", "d")
+}
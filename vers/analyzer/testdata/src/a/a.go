@@ -0,0 +1,9 @@
+package a // want package:`a uses gopkg.in/tomb.v2, not gopkg.in/tomb.v3`
+
+import (
+	"fmt"
+
+	"gopkg.in/tomb.v2" // want `import "gopkg.in/tomb.v2" should be "gopkg.in/tomb.v3"`
+)
+
+var _ = fmt.Sprint(tomb.New())
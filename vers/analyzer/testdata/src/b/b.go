@@ -0,0 +1,3 @@
+package b // want package:`c uses gopkg.in/tomb.v2, not gopkg.in/tomb.v3`
+
+import _ "c" // want `dependency c is using inconsistent path gopkg.in/tomb.v2, not gopkg.in/tomb.v3`
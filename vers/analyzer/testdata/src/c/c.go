@@ -0,0 +1,3 @@
+package c // want package:`c uses gopkg.in/tomb.v2, not gopkg.in/tomb.v3`
+
+import _ "gopkg.in/tomb.v2" // want `import "gopkg.in/tomb.v2" should be "gopkg.in/tomb.v3"`
@@ -0,0 +1,3 @@
+package d // want package:`c uses gopkg.in/tomb.v2, not gopkg.in/tomb.v3`
+
+import _ "b" // want `dependency b brings in c, which is using inconsistent path gopkg.in/tomb.v2, not gopkg.in/tomb.v3`
@@ -0,0 +1,3 @@
+package tomb
+
+func New() int { return 3 }
@@ -0,0 +1,148 @@
+package vers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// planCache records the files that Plan found to need no
+// changes, so that they need not be parsed again while their
+// content and the rules stay the same. Each entry maps a
+// file's path to a hash of the rules and the file's content.
+type planCache struct {
+	file    string
+	rules   string
+	mu      sync.Mutex
+	entries map[string]string
+	changed bool
+}
+
+// cacheFile holds the form of the file
+// in which a planCache is stored.
+type cacheFile struct {
+	Entries map[string]string
+}
+
+// openPlanCache returns the cache for the tree rooted at
+// dir, stored within cacheDir. It returns nil if no cache
+// should be used: when there is no cache directory, or
+// when the rules cannot be represented in a cache key
+// because a MapFunc is used. The import group that changes
+// are restricted to, if any, is part of the key with the rules.
+func (c *Checker) openPlanCache(cacheDir, importGroup string) *planCache {
+	if cacheDir == "" || c.Map != nil {
+		return nil
+	}
+	dir := c.Dir
+	if abs, err := filepath.Abs(dir); err == nil && c.FS == nil {
+		dir = abs
+	}
+	h := sha256.New()
+	for _, r := range c.Rules {
+		h.Write([]byte(r.OldPackagePat.String() + "\x00" + r.NewPackage + "\x00"))
+		if r.Exclude != nil {
+			h.Write([]byte("exclude:" + r.Exclude.String() + "\x00"))
+		}
+	}
+	for _, o := range c.Overrides {
+		h.Write([]byte("override:" + o.Dir + "\x00" + strconv.FormatBool(o.Disable) + "\x00"))
+		for _, r := range o.Rules {
+			h.Write([]byte(r.OldPackagePat.String() + "\x00" + r.NewPackage + "\x00"))
+		}
+	}
+	if c.FoldCase {
+		h.Write([]byte("foldcase\x00"))
+	}
+	if importGroup != "" {
+		h.Write([]byte("group:" + importGroup + "\x00"))
+	}
+	// Entries made before //go:linkname directives
+	// were changed too may leave some unchanged.
+	h.Write([]byte("linkname\x00"))
+	pc := &planCache{
+		file:    filepath.Join(cacheDir, hashString(dir)+".json"),
+		rules:   hex.EncodeToString(h.Sum(nil)),
+		entries: make(map[string]string),
+	}
+	if data, err := os.ReadFile(pc.file); err == nil {
+		var cf cacheFile
+		if json.Unmarshal(data, &cf) == nil && cf.Entries != nil {
+			pc.entries = cf.Entries
+		}
+	}
+	return pc
+}
+
+// key returns the cache key for the given file content.
+func (pc *planCache) key(src []byte) string {
+	return hashString(pc.rules + "\x00" + string(src))
+}
+
+// unchanged reports whether the file was found to
+// need no changes when it last had the given key.
+func (pc *planCache) unchanged(file, key string) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return pc.entries[file] == key
+}
+
+// record records whether the file with the given
+// key was found to need changes.
+func (pc *planCache) record(file, key string, needsChange bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	old, ok := pc.entries[file]
+	if needsChange {
+		if !ok {
+			return
+		}
+		delete(pc.entries, file)
+	} else {
+		if ok && old == key {
+			return
+		}
+		pc.entries[file] = key
+	}
+	pc.changed = true
+}
+
+// save writes the cache if it has changed. The file
+// is replaced atomically so that concurrent runs do
+// not see a partially written cache.
+func (pc *planCache) save() error {
+	if !pc.changed {
+		return nil
+	}
+	data, err := json.Marshal(cacheFile{Entries: pc.entries})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(pc.file), 0o777); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(pc.file), "tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), pc.file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,1026 @@
+package vers
+
+import (
+	"fmt"
+	"go/build"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Checker checks that the packages in a source tree, and
+// (recursively) their dependencies, use import paths that
+// are consistent with a set of rewrite rules.
+//
+// A package in the tree that imports a path matched by one of
+// the rules is marked as needing to be changed. A dependency
+// outside the tree that does so is inconsistent, and is reported
+// as a Finding.
+type Checker struct {
+	// Dir holds the root of the source tree. If it
+	// is empty, the current directory is used.
+	Dir string
+
+	// Rules holds the rewrite rules to check against.
+	Rules Rules
+
+	// Map, if non-nil, is used in place of Rules to decide
+	// how import paths should be changed. See MapFunc.
+	Map MapFunc
+
+	// BuildContext holds the build context used to resolve
+	// imports. If it is nil, build.Default is used.
+	BuildContext *build.Context
+
+	// NoDependencies suppresses checking of dependencies.
+	NoDependencies bool
+
+	// MaxDepth, if positive, limits how many levels of
+	// imports are followed from the packages in the tree
+	// when checking dependencies. With 1, only the direct
+	// dependencies of the packages in the tree are checked.
+	MaxDepth int
+
+	// NoNestedModules causes directories below Dir holding
+	// their own go.mod file to be left alone, as if excluded,
+	// rather than each being checked as a separate module.
+	NoNestedModules bool
+
+	// NoSubdirectories restricts the tree to Dir itself,
+	// so that only the package held there is checked,
+	// without walking the directories below it.
+	NoSubdirectories bool
+
+	// AllTests causes the test imports of dependencies
+	// to be checked as well as those of the packages
+	// in the tree.
+	AllTests bool
+
+	// Deep causes dependencies with inconsistent paths
+	// to be treated as packages needing change rather than
+	// as findings, when their source can be written.
+	Deep bool
+
+	// Excludes holds patterns matching directories in the
+	// tree whose packages should not be changed. A pattern
+	// containing a slash is matched against the slash-separated
+	// path of the directory relative to Dir; otherwise it is
+	// matched against the last element of the path.
+	Excludes []string
+
+	// Overrides holds rules that apply in place of Rules to
+	// the packages in particular directories of the tree.
+	// Dependencies, wherever they are imported from, are
+	// still checked against Rules.
+	Overrides []*Override
+
+	// Allow holds import path prefixes of dependencies that
+	// are allowed to use inconsistent paths, such as shims that
+	// deliberately use an old version for compatibility. The
+	// inconsistencies found in packages whose import paths
+	// have one of these prefixes are recorded in Result.Waived
+	// rather than Result.Findings, and do not cause failure.
+	Allow []string
+
+	// Hidden causes directories whose names start with a
+	// dot (other than version control metadata directories
+	// such as .git) to be searched for packages too. By
+	// default they are skipped, as the go command does.
+	Hidden bool
+
+	// Templates causes the import paths in text/template
+	// files in the tree, those whose names end in .tmpl or
+	// .gotmpl, to be changed too, so that the Go source
+	// generated from them uses the new paths. The templates
+	// are not parsed: the import declarations are found line
+	// by line, leaving out any path holding an action.
+	Templates bool
+
+	// Packages, if non-empty, restricts the packages in the
+	// tree that are checked and changed to those in the given
+	// directories, each a slash-separated path relative to
+	// Dir, optionally followed by "/..." to include all the
+	// directories below it too, as in the go command's package
+	// patterns. Other packages in the tree are treated as
+	// dependencies of the selected ones.
+	Packages []string
+
+	// Roots, if non-empty, restricts the packages in the tree
+	// that are checked and changed to those reachable from the
+	// packages in the given directories, which are patterns as
+	// for Packages, such as "cmd/...". The imports of each of
+	// those packages are followed into the tree, so that the
+	// packages in a single binary's dependency cone can be
+	// moved at a time; the other packages in the tree are left
+	// out of the check and the result altogether. Imports
+	// between packages in the tree are followed however deep
+	// they go, regardless of MaxDepth and NoDependencies.
+	Roots []string
+
+	// FS, if non-nil, holds the file system to read the source
+	// tree from. Dir and the paths in the result are then
+	// slash-separated paths within FS, and Dir defaults to ".".
+	// Absolute paths, such as those within GOROOT, still name
+	// files on the host, so a relative GOPATH entry in BuildContext
+	// can be used to find dependencies within FS. Packages in the
+	// tree are always resolved from their directories.
+	FS fs.FS
+
+	// PackagesDriver, if non-empty, names a program
+	// implementing the go/packages driver protocol (see
+	// GOPACKAGESDRIVER), which is used to load the packages
+	// in the tree and their dependencies in place of go/build,
+	// for build systems such as Bazel whose packages cannot
+	// otherwise be resolved. If the driver declines to handle
+	// the tree, go/build is used as usual. It cannot be
+	// used with FS.
+	PackagesDriver string
+
+	// Fetched holds versions of modules, keyed by module path,
+	// that have been downloaded to the module cache so that the
+	// packages they hold can be resolved even though the tree
+	// does not yet require them, as when the changes are to
+	// move the tree to a module it has never used. They are
+	// used only when a package cannot otherwise be found.
+	Fetched map[string]string
+
+	// Logf, if non-nil, is called to report problems that
+	// do not prevent the check from continuing, such as
+	// directories that cannot be read.
+	Logf func(f string, a ...interface{})
+
+	// Phase, if non-nil, is called at the end of each phase of
+	// the work, such as WalkPhase, with the time it took. Plan
+	// and Apply report their phases too.
+	Phase func(name string, d time.Duration)
+
+	// Tracef, if non-nil, is called as each directory is read,
+	// each package is checked and, by Plan and Apply, each file
+	// is parsed and written. It may be called concurrently.
+	Tracef func(f string, a ...interface{})
+
+	// Events, if non-nil, is called as each package in the tree
+	// is checked, each inconsistent dependency is found and each
+	// problem is encountered and, by Apply, as each file is
+	// changed. It may be called concurrently.
+	Events func(ev *Event)
+
+	// FoldCase causes import paths to be matched against the
+	// rules without regard to case, for trees on case-insensitive
+	// file systems, where imports differing only in case resolve
+	// to the same package. Matching paths are changed to the
+	// case used by the rules.
+	FoldCase bool
+
+	// FailFast causes the check to stop at the first problem
+	// that would otherwise be skipped and recorded in
+	// Result.Problems, returning it as the error from Check.
+	FailFast bool
+}
+
+// Result holds the results of a check.
+type Result struct {
+	// Packages holds all the packages found, ordered
+	// by import path.
+	Packages []*Package
+
+	// Modules holds all the modules found
+	// in the tree, outermost first.
+	Modules []*Module
+
+	// Findings holds all the inconsistencies found,
+	// in the order they were found.
+	Findings []*Finding
+
+	// Waived holds the inconsistencies found in packages
+	// allowed by Checker.Allow, in the order they were found.
+	Waived []*Finding
+
+	// Imports holds an entry for each import made by
+	// each package checked, in the order they were found.
+	Imports []*Import
+
+	// StaleRequires holds the requirements in go.mod files
+	// of modules nested within the tree that name modules
+	// whose paths would be changed, in the order they
+	// were found. The go.mod files in excluded directories
+	// are included.
+	StaleRequires []*StaleRequire
+
+	// SkippedModules holds the directories of the modules
+	// nested within the tree that were left alone because
+	// of NoNestedModules.
+	SkippedModules []string
+
+	// MixedMajors holds the packages checked that import
+	// more than one major version of a family with imports
+	// that would be changed, ordered by import path.
+	MixedMajors []*MixedMajors
+
+	// Overrides holds the members of Checker.Overrides that
+	// applied to any directory in the tree, in the order
+	// they were first applied.
+	Overrides []*Override
+
+	// Problems holds the problems that caused parts of the
+	// tree or its dependencies to be skipped, such as
+	// directories that could not be read, in the order they
+	// were found. Plan and Apply add any problems they find.
+	Problems []*Problem
+
+	// parsed holds the files in the tree
+	// that were parsed during the check.
+	parsed *fileCache
+}
+
+// StaleRequire holds a requirement in a go.mod file on
+// a module whose path would be changed.
+type StaleRequire struct {
+	// Pos holds the position of the requirement.
+	Pos token.Position
+
+	// Text holds the text of the require line.
+	Text string
+
+	// Path and Version hold the required module path and
+	// version, and Expected holds the path that would be
+	// required instead.
+	Path, Version string
+	Expected      string
+}
+
+// Import holds an import of one package by another.
+type Import struct {
+	// From and To hold the import paths of the importing
+	// and the imported package. To is as resolved from the
+	// importing package, before any rewriting.
+	From, To string
+
+	// Module holds the module that the import
+	// was resolved within.
+	Module *Module
+}
+
+// Failed reports whether any inconsistencies were found.
+func (r *Result) Failed() bool {
+	return len(r.Findings) > 0
+}
+
+// Package holds a package that may need to be changed.
+type Package struct {
+	// ImportPath holds the import path of the package.
+	ImportPath string
+
+	// Dir holds the directory containing the package.
+	Dir string
+
+	// GoFiles holds the paths of all the Go source
+	// files in the package directory.
+	GoFiles []string
+
+	// TemplateFiles holds the paths of the template files
+	// in the package directory when Checker.Templates is set.
+	TemplateFiles []string
+
+	// NeedsEdit holds whether the package imports
+	// any paths that need to be changed.
+	NeedsEdit bool
+
+	// Override holds the member of Checker.Overrides
+	// that applies to the package, if any.
+	Override *Override
+
+	// External holds whether the package lives outside
+	// the tree and was added because of Checker.Deep.
+	External bool
+
+	// Module holds the module that the package
+	// is resolved within.
+	Module *Module
+
+	// importsUnsafe holds whether the package imports
+	// unsafe, and so may hold //go:linkname directives
+	// naming paths that need to be changed.
+	importsUnsafe bool
+}
+
+// Finding describes a dependency that uses an inconsistent
+// import path.
+type Finding struct {
+	// Importer holds the import path of the package
+	// using the inconsistent path.
+	Importer string
+
+	// Dir holds the directory of the importing package.
+	Dir string
+
+	// ImportPath holds the inconsistent import path,
+	// as resolved from the importing package.
+	ImportPath string
+
+	// Pos holds the position of the import
+	// in the importing package's source.
+	Pos token.Position
+
+	// Expected holds the path that should have been
+	// imported instead.
+	Expected string
+
+	// Rule holds the rule that matched ImportPath, and
+	// Prefix holds the prefix of ImportPath that it matched.
+	// They are not set when Checker.Map is used.
+	Rule   *Rule
+	Prefix string
+
+	// Module holds the module that the importing
+	// package was resolved within.
+	Module *Module
+
+	// Chain holds the chain of imports from one of the
+	// packages in the tree to ImportPath, inclusive.
+	Chain []string
+
+	// TopLevel holds the first package in Chain outside
+	// the tree or vendored within it: the direct dependency
+	// of the tree that brought in the importing package.
+	TopLevel string
+
+	// VendorDir holds the directory of the copy of
+	// ImportPath that was used, when it was found in
+	// a vendor directory rather than resolved afresh.
+	VendorDir string
+}
+
+// checker holds the state of a single check.
+type checker struct {
+	*Checker
+	files     vfs
+	dir       string
+	buildCtxt *build.Context
+	pkgs      map[string]*Package
+	modules   []*Module
+	findings  []*Finding
+	waived    []*Finding
+	imports   []*Import
+
+	// driver holds the packages loaded by
+	// the packages driver, if any.
+	driver *driverPackages
+
+	// imported holds the result of each call to
+	// importPackage, so that each package is
+	// resolved only once.
+	imported map[importKey]importResult
+
+	// parsed holds the files parsed while
+	// checking the packages in the tree.
+	parsed *fileCache
+
+	staleRequires  []*StaleRequire
+	skippedModules []string
+	problems       []*Problem
+
+	// overrides holds the overrides applied so far,
+	// each also recorded in applied.
+	overrides []*Override
+	applied   map[*Override]bool
+
+	// stopped holds the problem that stopped
+	// the check, when FailFast is set.
+	stopped *Problem
+
+	// reached holds the import path of each
+	// package that has been checked.
+	reached map[string]bool
+}
+
+// Check runs the check over all packages in the tree.
+func (c *Checker) Check() (*Result, error) {
+	dir := c.Dir
+	if dir == "" && c.FS != nil {
+		dir = "."
+	}
+	if dir == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		dir = cwd
+	}
+	if c.FS == nil || filepath.IsAbs(dir) {
+		dir = cleanHostPath(dir)
+	}
+	buildCtxt := c.BuildContext
+	if buildCtxt == nil {
+		buildCtxt = &build.Default
+	}
+	files := vfs{c.FS}
+	ck := &checker{
+		Checker:   c,
+		files:     files,
+		dir:       dir,
+		buildCtxt: files.buildContext(buildCtxt),
+		pkgs:      make(map[string]*Package),
+		imported:  make(map[importKey]importResult),
+		parsed:    newFileCache(),
+		applied:   make(map[*Override]bool),
+		reached:   make(map[string]bool),
+	}
+	if c.PackagesDriver != "" {
+		if c.FS != nil {
+			return nil, fmt.Errorf("cannot use a packages driver with a non-host file system")
+		}
+		driver, err := ck.loadDriver(c.PackagesDriver, dir)
+		if err != nil {
+			return nil, err
+		}
+		ck.driver = driver
+	}
+	start := time.Now()
+	ck.walkDir(dir, ck.rootModule(dir))
+	c.endPhase(WalkPhase, start)
+	if ck.stopped != nil {
+		return nil, ck.stopped
+	}
+	var roots []string
+	for path, p := range ck.pkgs {
+		if len(c.Roots) == 0 || matchPatterns(c.Roots, ck.dir, p.Dir) {
+			roots = append(roots, path)
+		}
+	}
+	if len(roots) == 0 && len(c.Roots) > 0 {
+		return nil, fmt.Errorf("no packages found matching roots %s", strings.Join(c.Roots, " "))
+	}
+	if len(c.Roots) > 0 {
+		roots = ck.treeImports(roots)
+	}
+	sort.Strings(roots)
+	start = time.Now()
+	for _, path := range roots {
+		p := ck.pkgs[path]
+		ck.checkPackage(p.Module, path, p.Dir, 0)
+	}
+	c.endPhase(CheckPhase, start)
+	if ck.stopped != nil {
+		return nil, ck.stopped
+	}
+	if len(c.Roots) > 0 {
+		for path, p := range ck.pkgs {
+			if !p.External && !ck.reached[path] {
+				delete(ck.pkgs, path)
+			}
+		}
+	}
+	// Note that Deep may have added packages
+	// to ck.pkgs since roots was created.
+	result := &Result{
+		Modules:        ck.modules,
+		Findings:       ck.findings,
+		Waived:         ck.waived,
+		Imports:        ck.imports,
+		StaleRequires:  ck.staleRequires,
+		SkippedModules: ck.skippedModules,
+		MixedMajors:    ck.findMixedMajors(),
+		Overrides:      ck.overrides,
+		Problems:       ck.problems,
+		parsed:         ck.parsed,
+	}
+	for _, p := range ck.pkgs {
+		result.Packages = append(result.Packages, p)
+	}
+	sort.Slice(result.Packages, func(i, j int) bool {
+		return result.Packages[i].ImportPath < result.Packages[j].ImportPath
+	})
+	return result, nil
+}
+
+func (c *checker) logf(f string, a ...interface{}) {
+	if c.Logf != nil {
+		c.Logf(f, a...)
+	}
+}
+
+// walkDir walks all directories below path and
+// adds any packages to c.pkgs. A directory
+// containing a go.mod file starts a new module.
+func (c *checker) walkDir(path string, mod *Module) {
+	if c.stopped != nil {
+		return
+	}
+	if c.excluded(path) {
+		c.findStaleRequires(path)
+		return
+	}
+	override := c.overrideFor(path)
+	if override != nil && override.Disable {
+		return
+	}
+	c.tracef("walk %s", path)
+	entries, err := c.files.readDir(path)
+	if err != nil {
+		c.problem(&Problem{Kind: DirProblem, Path: path, Err: err})
+		return
+	}
+	if path != mod.Dir {
+		gomod := c.files.join(path, "go.mod")
+		if modPath, ok := c.readModulePath(gomod); ok {
+			if c.NoNestedModules {
+				c.skippedModules = append(c.skippedModules, path)
+				c.findStaleRequires(path)
+				return
+			}
+			mod = c.newModule(path, modPath)
+			c.checkRequires(gomod)
+		}
+	}
+	p := &Package{
+		Dir:      path,
+		Module:   mod,
+		Override: override,
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if !c.NoSubdirectories && !c.skipDir(entry.Name()) {
+				c.walkDir(c.files.join(path, entry.Name()), mod)
+			}
+		} else {
+			if strings.HasSuffix(entry.Name(), ".go") {
+				p.GoFiles = append(p.GoFiles, c.files.join(path, entry.Name()))
+			} else if c.Templates && isTemplateFile(entry.Name()) {
+				p.TemplateFiles = append(p.TemplateFiles, c.files.join(path, entry.Name()))
+			}
+		}
+	}
+	if !c.selected(path) {
+		return
+	}
+	if c.driver != nil {
+		if importPath, ok := c.driver.byDir[cleanHostPath(path)]; ok {
+			p.ImportPath = importPath
+			c.pkgs[importPath] = p
+		}
+		return
+	}
+	if mod.Path != "" {
+		if len(p.GoFiles) == 0 && len(p.TemplateFiles) == 0 {
+			return
+		}
+		if importPath, ok := mod.importPath(path); ok {
+			p.ImportPath = importPath
+			c.pkgs[importPath] = p
+		}
+		return
+	}
+	pkg, err := mod.buildCtxt.Import(".", path, build.FindOnly)
+	if err != nil {
+		// ignore directories that don't correspond to packages.
+		return
+	}
+	p.ImportPath = pkg.ImportPath
+	c.pkgs[pkg.ImportPath] = p
+}
+
+// findStaleRequires checks the requirements in all the
+// go.mod files in and below the given directory.
+func (c *checker) findStaleRequires(path string) {
+	entries, err := c.files.readDir(path)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.IsDir() && !c.skipDir(entry.Name()):
+			c.findStaleRequires(c.files.join(path, entry.Name()))
+		case entry.Name() == "go.mod":
+			c.checkRequires(c.files.join(path, entry.Name()))
+		}
+	}
+}
+
+// checkRequires records the requirements in the given go.mod
+// file on any modules whose paths would be changed.
+func (c *checker) checkRequires(gomod string) {
+	for _, r := range c.readModFile(gomod).requireLines {
+		if fixed := c.fixFor(c.overrideFor(filepath.Dir(gomod)), r.path); fixed != r.path {
+			c.staleRequires = append(c.staleRequires, &StaleRequire{
+				Pos: token.Position{
+					Filename: gomod,
+					Line:     r.line,
+				},
+				Text:     r.text,
+				Path:     r.path,
+				Version:  r.version,
+				Expected: fixed,
+			})
+		}
+	}
+}
+
+// vcsDirs holds the names of version control metadata
+// directories, which are never searched.
+var vcsDirs = map[string]bool{
+	".git": true,
+	".hg":  true,
+	".bzr": true,
+	".svn": true,
+}
+
+// skipDir reports whether the directory
+// with the given name should not be walked.
+func (c *checker) skipDir(name string) bool {
+	if c.Hidden {
+		return vcsDirs[name]
+	}
+	return strings.HasPrefix(name, ".")
+}
+
+// selected reports whether the package in the given
+// directory is one of those selected by Packages.
+func (c *checker) selected(dir string) bool {
+	return len(c.Packages) == 0 || matchPatterns(c.Packages, c.dir, dir)
+}
+
+// matchPatterns reports whether dir matches any of the
+// package patterns, which are relative to root. See
+// Checker.Packages.
+func matchPatterns(patterns []string, root, dir string) bool {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pat := range patterns {
+		pat = filepath.ToSlash(pat)
+		if base, ok := strings.CutSuffix(pat, "/..."); ok {
+			if base == "." || rel == base || strings.HasPrefix(rel, base+"/") {
+				return true
+			}
+		} else if pat == "..." || path.Clean(pat) == rel {
+			return true
+		}
+	}
+	return false
+}
+
+// excluded reports whether the given directory matches
+// any of the Excludes patterns.
+func (c *checker) excluded(dir string) bool {
+	rel, err := filepath.Rel(c.dir, dir)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, pat := range c.Excludes {
+		// Patterns and the paths they're matched against
+		// are slash-separated on all platforms.
+		pat = filepath.ToSlash(pat)
+		name := rel
+		if !strings.Contains(pat, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(pat, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// addExternal adds the external package pkg to the set of
+// packages to change, and returns it. It returns nil
+// if the package's source cannot be written.
+func (c *checker) addExternal(mod *Module, pkg *build.Package) *Package {
+	if pkg.Goroot || InModuleCache(pkg.Dir) || !c.files.writable(pkg.Dir) {
+		return nil
+	}
+	entries, err := c.files.readDir(pkg.Dir)
+	if err != nil {
+		c.problem(&Problem{Kind: DirProblem, Path: pkg.Dir, Err: err})
+		return nil
+	}
+	p := &Package{
+		ImportPath: pkg.ImportPath,
+		Dir:        pkg.Dir,
+		External:   true,
+		Module:     mod,
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") {
+			p.GoFiles = append(p.GoFiles, c.files.join(pkg.Dir, entry.Name()))
+		}
+	}
+	c.pkgs[pkg.ImportPath] = p
+	return p
+}
+
+// treeImports returns the import paths of the packages in the
+// tree that are reachable from those with the given paths by
+// following imports, including test imports, between packages in
+// the tree. Unlike the check itself, it is not limited by MaxDepth
+// or NoDependencies, so that every package in the roots' dependency
+// cone is checked and changed.
+func (c *checker) treeImports(roots []string) []string {
+	seen := make(map[string]bool)
+	var paths []string
+	var visit func(path string)
+	visit = func(path string) {
+		p := c.pkgs[path]
+		if p == nil || p.External || seen[path] {
+			return
+		}
+		seen[path] = true
+		paths = append(paths, path)
+		pkg, err := c.importPackage(p.Module, path, p.Dir)
+		if err != nil {
+			return
+		}
+		var allImports []string
+		allImports = append(allImports, pkg.Imports...)
+		allImports = append(allImports, pkg.TestImports...)
+		allImports = append(allImports, pkg.XTestImports...)
+		for _, impPath := range allImports {
+			if impPath == "C" {
+				continue
+			}
+			if impPkg, err := c.importPackage(p.Module, impPath, pkg.Dir); err == nil {
+				visit(impPkg.ImportPath)
+			}
+		}
+	}
+	for _, path := range roots {
+		visit(path)
+	}
+	return paths
+}
+
+// checkPackage checks all go files in the given
+// package, and all their dependencies, resolving
+// imports within the given module.
+func (c *checker) checkPackage(mod *Module, path, fromDir string, depth int) {
+	if path == "C" || c.stopped != nil {
+		return
+	}
+	checkedDepth, revisit := mod.checked[path]
+	if revisit && (c.MaxDepth <= 0 || checkedDepth <= depth) {
+		// The package has already been, is or being, checked
+		return
+	}
+	// Otherwise the package was checked when reached by
+	// a longer chain of imports, so its dependencies must be
+	// followed further, but its own imports have already
+	// been recorded.
+	c.tracef("check %s", path)
+	c.reached[path] = true
+	pkg, err := c.importPackage(mod, path, fromDir)
+	mod.checked[pkg.ImportPath] = depth
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); !ok {
+			c.problem(&Problem{Kind: ImportProblem, Path: path, Dir: fromDir, Err: err})
+		}
+		return
+	}
+	p := c.pkgs[path]
+	if p != nil && !revisit {
+		c.event(&Event{Kind: PackageEvent, Package: p})
+	}
+	// N.B. is it worth eliminating duplicates here?
+	var allImports []string
+	allImports = append(allImports, pkg.Imports...)
+	if c.pkgs[path] != nil || c.AllTests {
+		// The package is in our set of root packages (or
+		// we've been asked to check all tests) so
+		// add testing imports too.
+		allImports = append(allImports, pkg.TestImports...)
+		allImports = append(allImports, pkg.XTestImports...)
+	}
+	if p != nil && contains(allImports, "unsafe") {
+		p.importsUnsafe = true
+	}
+	for _, impPath := range allImports {
+		// Import the package to find out its absolute path
+		// including vendor directories before applying the
+		// rewrite.
+		impPkg, _ := c.importPackage(mod, impPath, pkg.Dir)
+		if err != nil {
+			continue
+		}
+		if impPath == "C" {
+			continue
+		}
+		if !revisit {
+			c.imports = append(c.imports, &Import{
+				From:   pkg.ImportPath,
+				To:     impPkg.ImportPath,
+				Module: mod,
+			})
+		}
+		resolved, next := impPkg.ImportPath, impPkg.ImportPath
+		if p == nil {
+			// A dependency's vendored copy of a package is
+			// judged by the path it was vendored from.
+			resolved = vendorlessPath(resolved)
+		}
+		var override *Override
+		if p != nil {
+			override = p.Override
+		}
+		if fixed := c.fixFor(override, resolved); fixed != resolved {
+			if p == nil && c.Deep {
+				p = c.addExternal(mod, pkg)
+			}
+			if p == nil {
+				if !revisit {
+					c.addFinding(mod, pkg, impPath, resolved, impPkg.Dir)
+				}
+				continue
+			}
+			p.NeedsEdit = true
+			impPath, next = fixed, fixed
+		}
+		if !c.NoDependencies && (c.MaxDepth <= 0 || depth < c.MaxDepth) {
+			// The chain is keyed by the path that the
+			// package will be checked as, which includes
+			// any vendor directory prefix.
+			if _, ok := mod.importedBy[next]; !ok {
+				mod.importedBy[next] = pkg.ImportPath
+			}
+			c.checkPackage(mod, impPath, impPkg.Dir, depth+1)
+		}
+	}
+}
+
+// fix returns the path that p should be changed to,
+// which is p itself if it should not be changed.
+func (c *Checker) fix(p string) string {
+	if c.Map == nil {
+		return c.fixRules(c.Rules, p)
+	}
+	if np, ok := c.Map(NormalizePath(p)); ok {
+		return np
+	}
+	return p
+}
+
+// fixRules returns p rewritten according to rs,
+// ignoring case if FoldCase is set.
+func (c *Checker) fixRules(rs Rules, p string) string {
+	fixed := rs.Fix(p)
+	if fixed == p && c.FoldCase {
+		fixed = rs.fixFold(p)
+	}
+	return fixed
+}
+
+// importKey identifies a call to importPackage.
+type importKey struct {
+	mod          *Module
+	path, srcDir string
+}
+
+type importResult struct {
+	pkg *build.Package
+	err error
+}
+
+// importPackage is like resolvePackage, but resolves each
+// package only once for each directory it is imported from.
+// As checkPackage imports each package again from its own
+// directory, the result is recorded for that too.
+func (c *checker) importPackage(mod *Module, path, srcDir string) (*build.Package, error) {
+	key := importKey{mod, path, srcDir}
+	if r, ok := c.imported[key]; ok {
+		return r.pkg, r.err
+	}
+	pkg, err := c.resolvePackage(mod, path, srcDir)
+	r := importResult{pkg, err}
+	c.imported[key] = r
+	if pkg != nil && pkg.Dir != "" && !build.IsLocalImport(path) {
+		own := importKey{mod, path, pkg.Dir}
+		if _, ok := c.imported[own]; !ok {
+			c.imported[own] = r
+		}
+	}
+	return pkg, err
+}
+
+// resolvePackage imports the package with the given path
+// from srcDir, resolving it within mod. Packages in the tree
+// are imported directly from their directories, so that
+// they can be found even when the build context
+// cannot resolve them by import path. Dependencies of
+// a module that cannot otherwise be found are looked
+// for in the module cache. When a packages driver is
+// in use, the packages it loaded take precedence.
+func (c *checker) resolvePackage(mod *Module, path, srcDir string) (*build.Package, error) {
+	if c.driver != nil {
+		if pkg := c.driver.byPath[path]; pkg != nil {
+			return pkg, nil
+		}
+	}
+	if p := c.pkgs[path]; p != nil && p.Module == mod && !p.External {
+		pkg, err := c.loadPackage(mod.buildCtxt, ".", p.Dir, true)
+		pkg.ImportPath = path
+		return pkg, err
+	}
+	pkg, err := c.loadPackage(mod.buildCtxt, path, srcDir, false)
+	if err != nil && mod.Path == "" && !isStandard(path) {
+		return c.resolveMajor(mod, path, pkg, err)
+	}
+	if err == nil || mod.Path == "" || isStandard(path) {
+		return pkg, err
+	}
+	if _, ok := err.(*build.NoGoError); ok {
+		return pkg, err
+	}
+	// The go command may be unavailable or may not be used
+	// (for example when reading from FS), so try to find
+	// the dependency's source in the module cache.
+	if dir, ok := c.moduleCacheDir(mod, path); ok {
+		if mpkg, merr := c.loadPackage(mod.buildCtxt, ".", dir, false); merr == nil {
+			mpkg.ImportPath = path
+			return mpkg, nil
+		}
+	}
+	if dir, ok := c.fetchedDir(path); ok {
+		if mpkg, merr := c.loadPackage(mod.buildCtxt, ".", dir, false); merr == nil {
+			mpkg.ImportPath = path
+			return mpkg, nil
+		}
+	}
+	return pkg, err
+}
+
+// addFinding records that pkg, resolved within mod, uses
+// the inconsistent path resolved, imported as impPath and
+// found in resolvedDir.
+func (c *checker) addFinding(mod *Module, pkg *build.Package, impPath, resolved, resolvedDir string) {
+	f := &Finding{
+		Importer:   pkg.ImportPath,
+		Dir:        pkg.Dir,
+		ImportPath: resolved,
+		Expected:   c.fix(resolved),
+		Module:     mod,
+		Chain:      append(mod.importChain(pkg.ImportPath), resolved),
+	}
+	if isVendored(resolvedDir) {
+		f.VendorDir = resolvedDir
+	}
+	for _, path := range f.Chain {
+		if p := c.pkgs[path]; p == nil || p.External || vendorlessPath(path) != path {
+			f.TopLevel = path
+			break
+		}
+	}
+	if c.Map == nil {
+		r, i := c.Rules.Find(resolved)
+		f.Rule, f.Prefix = r, resolved[0:i]
+	}
+	for _, m := range []map[string][]token.Position{pkg.ImportPos, pkg.TestImportPos, pkg.XTestImportPos} {
+		if pos := m[impPath]; len(pos) > 0 {
+			f.Pos = pos[0]
+			break
+		}
+	}
+	if c.allowed(pkg.ImportPath) {
+		c.waived = append(c.waived, f)
+		return
+	}
+	mod.Failed = true
+	c.findings = append(c.findings, f)
+	c.event(&Event{Kind: FindingEvent, Finding: f})
+}
+
+// allowed reports whether the package with the given
+// import path is allowed to use inconsistent paths.
+func (c *checker) allowed(path string) bool {
+	for _, prefix := range c.Allow {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// vendorlessPath returns path without any vendor directory
+// prefix, as given to vendored packages in GOPATH mode.
+func vendorlessPath(path string) string {
+	if i := strings.LastIndex(path, "/vendor/"); i >= 0 {
+		return path[i+len("/vendor/"):]
+	}
+	return strings.TrimPrefix(path, "vendor/")
+}
+
+// isVendored reports whether dir is within a vendor directory.
+func isVendored(dir string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(dir), "/") {
+		if elem == "vendor" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package vers
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+)
+
+// formatKeepingImports formats src as gofmt does, except that the
+// imports are left in the order they are in. When a path is changed
+// so that it sorts differently, gofmt would move it, and the comments
+// around it are not always moved with it: a doc comment can end up
+// above a different import, and a directive such as //nolint can
+// end up applying to the wrong one.
+func formatKeepingImports(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	cfg := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+	if err := cfg.Fprint(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// keepsImportComments reports whether formatted, a formatted
+// version of src, holds the same imports as src in the same order,
+// each with exactly the same doc and line comments, so that no
+// comment on an import has been reflowed or attached to another.
+func keepsImportComments(src, formatted []byte) bool {
+	a, b := importComments(src), importComments(formatted)
+	if a == nil || b == nil || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// importComment holds an import spec with its comments.
+type importComment struct {
+	path, doc, comment string
+}
+
+// importComments returns the import specs of src in source
+// order, or nil if src cannot be parsed.
+func importComments(src []byte) []importComment {
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return nil
+	}
+	specs := make([]importComment, 0, len(f.Imports))
+	for _, ispec := range f.Imports {
+		specs = append(specs, importComment{
+			path:    ispec.Path.Value,
+			doc:     commentText(ispec.Doc),
+			comment: commentText(ispec.Comment),
+		})
+	}
+	return specs
+}
+
+// commentText returns the text of the comments in g exactly as
+// they appear in the source, with a newline between each one.
+func commentText(g *ast.CommentGroup) string {
+	if g == nil {
+		return ""
+	}
+	var text string
+	for _, c := range g.List {
+		text += c.Text + "\n"
+	}
+	return text
+}
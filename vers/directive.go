@@ -0,0 +1,64 @@
+package vers
+
+import (
+	"bytes"
+	"strings"
+)
+
+// keepsDirectives reports whether formatted, a formatted version of
+// src, holds exactly the same directive comments as src, such as
+// //line and //go:build, on the same lines. Directives such as //line
+// refer to the lines around them, so moving or changing one, even
+// just its spacing, can break debuggers and coverage tools.
+func keepsDirectives(src, formatted []byte) bool {
+	a, b := directiveLines(src), directiveLines(formatted)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// directiveLine holds a line holding a directive.
+type directiveLine struct {
+	line int
+	text string
+}
+
+// directiveLines returns the lines of src that hold directives.
+func directiveLines(src []byte) []directiveLine {
+	var lines []directiveLine
+	for i, line := range bytes.Split(src, []byte("\n")) {
+		if j := bytes.Index(line, []byte("//")); j >= 0 && isDirective(string(line[j:])) ||
+			bytes.HasPrefix(line, []byte("/*line ")) {
+			lines = append(lines, directiveLine{i + 1, string(line)})
+		}
+	}
+	return lines
+}
+
+// isDirective reports whether the comment c is a directive:
+// a //line, //export or //extern comment, or one such as
+// //go:generate of the form //name:args with no space after
+// the slashes.
+func isDirective(c string) bool {
+	for _, prefix := range []string{"//line ", "//export ", "//extern "} {
+		if strings.HasPrefix(c, prefix) {
+			return true
+		}
+	}
+	name, _, ok := strings.Cut(c[2:], ":")
+	if !ok || name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !('a' <= r && r <= 'z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,159 @@
+package vers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/build"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The request and response types below follow the protocol
+// used by golang.org/x/tools/go/packages to talk to an external
+// driver program named by GOPACKAGESDRIVER, such as the one
+// provided for Bazel by rules_go.
+
+type driverRequest struct {
+	Mode       int               `json:"mode"`
+	Env        []string          `json:"env"`
+	BuildFlags []string          `json:"build_flags"`
+	Tests      bool              `json:"tests"`
+	Overlay    map[string][]byte `json:"overlay"`
+}
+
+type driverResponse struct {
+	NotHandled bool
+	Roots      []string `json:",omitempty"`
+	Packages   []*driverPackage
+}
+
+type driverPackage struct {
+	ID      string
+	Name    string
+	PkgPath string
+	GoFiles []string
+
+	// Imports maps from each import path used
+	// by the package to the ID of the package
+	// it refers to.
+	Imports map[string]string
+}
+
+// Load modes, as defined by go/packages.
+const (
+	needName    = 1 << 0
+	needFiles   = 1 << 1
+	needImports = 1 << 3
+	needDeps    = 1 << 4
+)
+
+// driverPackages holds the packages loaded
+// by a packages driver.
+type driverPackages struct {
+	// byPath maps from import path to package.
+	byPath map[string]*build.Package
+
+	// byDir maps from directory to the import
+	// path of the package in it.
+	byDir map[string]string
+}
+
+// loadDriver runs the named packages driver to load all
+// the packages in dir and their dependencies. It returns
+// nil if the driver declines to handle the request.
+func (c *checker) loadDriver(driver, dir string) (*driverPackages, error) {
+	req := driverRequest{
+		Mode:  needName | needFiles | needImports | needDeps,
+		Env:   os.Environ(),
+		Tests: true,
+	}
+	if tags := c.buildCtxt.BuildTags; len(tags) > 0 {
+		req.BuildFlags = []string{"-tags=" + strings.Join(tags, ",")}
+	}
+	reqData, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(driver, "./...")
+	cmd.Dir = dir
+	cmd.Stdin = bytes.NewReader(reqData)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("packages driver %s failed: %v: %s", driver, err, strings.TrimSpace(stderr.String()))
+	}
+	var resp driverResponse
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("cannot decode response from packages driver %s: %v", driver, err)
+	}
+	if resp.NotHandled {
+		return nil, nil
+	}
+	return newDriverPackages(resp.Packages), nil
+}
+
+// newDriverPackages converts the packages returned by a
+// driver to the form used by go/build. The imports of each
+// test variant of a package are added to the test imports of
+// the package itself, and test main packages are omitted.
+func newDriverPackages(dpkgs []*driverPackage) *driverPackages {
+	dp := &driverPackages{
+		byPath: make(map[string]*build.Package),
+		byDir:  make(map[string]string),
+	}
+	var variants []*driverPackage
+	for _, d := range dpkgs {
+		if strings.Contains(d.ID, " [") || strings.HasSuffix(d.PkgPath, ".test") {
+			variants = append(variants, d)
+			continue
+		}
+		pkg := &build.Package{
+			ImportPath: d.PkgPath,
+			Name:       d.Name,
+			Imports:    sortedKeys(d.Imports),
+		}
+		for _, f := range d.GoFiles {
+			pkg.Dir = filepath.Dir(f)
+			pkg.GoFiles = append(pkg.GoFiles, filepath.Base(f))
+		}
+		dp.byPath[pkg.ImportPath] = pkg
+		if pkg.Dir != "" {
+			dp.byDir[cleanHostPath(pkg.Dir)] = pkg.ImportPath
+		}
+	}
+	for _, d := range variants {
+		pkg := dp.byPath[strings.TrimSuffix(d.PkgPath, "_test")]
+		if pkg == nil {
+			continue
+		}
+		for _, imp := range sortedKeys(d.Imports) {
+			if !contains(pkg.Imports, imp) && !contains(pkg.TestImports, imp) && imp != pkg.ImportPath {
+				pkg.TestImports = append(pkg.TestImports, imp)
+			}
+		}
+	}
+	return dp
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
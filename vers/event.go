@@ -0,0 +1,54 @@
+package vers
+
+// The kinds of event reported to Checker.Events.
+const (
+	// PackageEvent reports that a package in
+	// the tree is about to have its imports checked.
+	PackageEvent = "package"
+
+	// FindingEvent reports that a dependency was
+	// found to use an inconsistent import path.
+	FindingEvent = "finding"
+
+	// ProblemEvent reports that something could
+	// not be processed and so was skipped.
+	ProblemEvent = "problem"
+
+	// FileEvent reports that a file has been changed.
+	FileEvent = "file"
+)
+
+// Event holds something that has happened during the
+// work, as reported to Checker.Events.
+type Event struct {
+	// Kind holds the kind of event, such as PackageEvent.
+	Kind string
+
+	// Package holds the package checked, for PackageEvent,
+	// or that the file changed is in, for FileEvent.
+	Package *Package
+
+	// Path holds the file changed, for FileEvent.
+	Path string
+
+	// Finding holds the dependency found, for FindingEvent,
+	// and Problem holds what was skipped, for ProblemEvent.
+	Finding *Finding
+	Problem *Problem
+}
+
+// WithEvents sets the function called with each event as it
+// happens, so that a long run can be followed as it goes.
+// See Checker.Events.
+func WithEvents(events func(ev *Event)) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Events = events
+	}
+}
+
+// event reports ev if c.Events is set.
+func (c *Checker) event(ev *Event) {
+	if c.Events != nil {
+		c.Events(ev)
+	}
+}
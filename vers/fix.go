@@ -0,0 +1,171 @@
+package vers
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Fixer makes changes to code, beyond changing import paths,
+// needed by a particular migration, such as adapting the calls
+// to a function whose signature changed in a new major version.
+// It is applied to each file in which an import of one of its
+// packages is changed, after the import paths have been changed
+// and any identifiers renamed (see WithRenames).
+type Fixer struct {
+	// Name holds the name that the fixer is selected by.
+	Name string
+
+	// Doc holds a one-line description of the fixer.
+	Doc string
+
+	// Paths holds the import paths, before the change,
+	// of the packages whose uses the fixer fixes.
+	Paths []string
+
+	// Fix returns the edits to make to f, whose positions are
+	// held in fset. The names map holds the name that each
+	// changed import of a package in Paths is imported as,
+	// keyed by its old import path.
+	Fix func(fset *token.FileSet, f *ast.File, names map[string]string) []Edit
+}
+
+// Edit holds a change made by a Fixer: the source
+// from Pos to End is replaced by New.
+type Edit struct {
+	Pos, End token.Pos
+	New      string
+}
+
+var (
+	fixersMu sync.Mutex
+	fixers   = make(map[string]*Fixer)
+)
+
+// RegisterFixer makes a fixer available to LookupFixer. It
+// panics if a fixer with the same name is already registered.
+func RegisterFixer(f *Fixer) {
+	fixersMu.Lock()
+	defer fixersMu.Unlock()
+	if fixers[f.Name] != nil {
+		panic(fmt.Sprintf("fixer %q registered twice", f.Name))
+	}
+	fixers[f.Name] = f
+}
+
+// LookupFixer returns the registered fixer
+// with the given name, or nil if there is none.
+func LookupFixer(name string) *Fixer {
+	fixersMu.Lock()
+	defer fixersMu.Unlock()
+	return fixers[name]
+}
+
+// Fixers returns all the registered fixers, sorted by name.
+func Fixers() []*Fixer {
+	fixersMu.Lock()
+	defer fixersMu.Unlock()
+	fs := make([]*Fixer, 0, len(fixers))
+	for _, f := range fixers {
+		fs = append(fs, f)
+	}
+	sort.Slice(fs, func(i, j int) bool {
+		return fs[i].Name < fs[j].Name
+	})
+	return fs
+}
+
+// WithFixers causes the given fixers to be applied to the
+// files whose imports are changed.
+func WithFixers(fixers ...*Fixer) Option {
+	return func(rw *Rewriter) {
+		rw.fixers = append(rw.fixers, fixers...)
+	}
+}
+
+// applyFixers applies rw.fixers to src, the changed contents of
+// the given file, with changes making the changes to imports
+// that were made to it, and returns the result.
+func (rw *Rewriter) applyFixers(file string, src []byte, changes []*ImportChange) ([]byte, error) {
+	for _, fixer := range rw.fixers {
+		applies := false
+		for _, c := range changes {
+			applies = applies || contains(fixer.Paths, c.Old)
+		}
+		if !applies {
+			continue
+		}
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, file, src, parser.ParseComments)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %v", file, err)
+		}
+		names := make(map[string]string)
+		for _, ispec := range f.Imports {
+			path, err := strconv.Unquote(ispec.Path.Value)
+			if err != nil {
+				continue
+			}
+			for _, c := range changes {
+				if c.New != path || !contains(fixer.Paths, c.Old) {
+					continue
+				}
+				name := ImportName(path)
+				if ispec.Name != nil {
+					name = ispec.Name.Name
+				}
+				names[c.Old] = name
+			}
+		}
+		edits := fixer.Fix(fset, f, names)
+		if len(edits) == 0 {
+			continue
+		}
+		src, err = applyEdits(fset, src, edits)
+		if err != nil {
+			return nil, fmt.Errorf("%s: fixer %s: %v", file, fixer.Name, err)
+		}
+	}
+	return src, nil
+}
+
+// applyEdits returns src, whose positions are held in fset, with
+// the given edits made, failing if any of them overlap. If src was
+// formatted as by gofmt, the result is formatted too, but without
+// sorting the imports, unless that would change any directives (see
+// keepsDirectives) or imports' comments (see keepsImportComments).
+func applyEdits(fset *token.FileSet, src []byte, edits []Edit) ([]byte, error) {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].Pos < edits[j].Pos
+	})
+	var buf bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		start, end := fset.PositionFor(e.Pos, false).Offset, fset.PositionFor(e.End, false).Offset
+		if start < last || end < start {
+			return nil, fmt.Errorf("overlapping edits at %v", fset.PositionFor(e.Pos, false))
+		}
+		buf.Write(src[last:start])
+		buf.WriteString(e.New)
+		last = end
+	}
+	buf.Write(src[last:])
+	data := buf.Bytes()
+	formatted, err := formatKeepingImports(data)
+	if err != nil {
+		return nil, fmt.Errorf("edits do not leave valid Go: %v", err)
+	}
+	// Changing the length of an import path or identifier
+	// can leave the alignment of comments that follow it out
+	// of date, which formatting puts right.
+	if orig, err := format.Source(src); err != nil || !bytes.Equal(orig, src) || !keepsDirectives(data, formatted) || !keepsImportComments(data, formatted) {
+		return data, nil
+	}
+	return formatted, nil
+}
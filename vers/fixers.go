@@ -0,0 +1,77 @@
+package vers
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// This file holds the built-in fixers. Each is registered
+// by init, and is best kept small enough to check by eye.
+
+func init() {
+	RegisterFixer(&Fixer{
+		Name:  "uuid",
+		Doc:   "wrap calls to uuid.NewV1, NewV2 and NewV4 in uuid.Must, as the gofrs/uuid versions also return an error",
+		Paths: []string{"github.com/satori/go.uuid"},
+		Fix:   fixUUID,
+	})
+}
+
+// fixUUID wraps each call to one of the uuid functions
+// that return an error as well as a UUID in the gofrs
+// fork in a call to uuid.Must, unless the call is already
+// assigned to two values.
+func fixUUID(fset *token.FileSet, f *ast.File, names map[string]string) []Edit {
+	name := names["github.com/satori/go.uuid"]
+	if name == "" || name == "_" || name == "." {
+		return nil
+	}
+	// paired holds the calls whose results
+	// are already assigned to two values.
+	paired := make(map[*ast.CallExpr]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) == 2 && len(n.Rhs) == 1 {
+				if call, ok := n.Rhs[0].(*ast.CallExpr); ok {
+					paired[call] = true
+				}
+			}
+		case *ast.ValueSpec:
+			if len(n.Names) == 2 && len(n.Values) == 1 {
+				if call, ok := n.Values[0].(*ast.CallExpr); ok {
+					paired[call] = true
+				}
+			}
+		}
+		return true
+	})
+	var edits []Edit
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || paired[call] {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if x, ok := sel.X.(*ast.Ident); !ok || x.Name != name || x.Obj != nil {
+			return true
+		}
+		switch sel.Sel.Name {
+		case "NewV1", "NewV2", "NewV4":
+			edits = append(edits, Edit{
+				Pos: call.Pos(),
+				End: call.Pos(),
+				New: name + ".Must(",
+			}, Edit{
+				Pos: call.End(),
+				End: call.End(),
+				New: ")",
+			})
+		}
+		return true
+	})
+	return edits
+}
@@ -0,0 +1,184 @@
+package vers
+
+import (
+	"fmt"
+	"go/build"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// WriteFS is implemented by file systems that can be
+// changed by Rewriter.Apply. Names are interpreted as
+// for fs.FS.
+type WriteFS interface {
+	fs.FS
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+}
+
+// vfs provides access to files either on the host file
+// system or in the file system supplied by the caller.
+// When fsys is non-nil, relative paths name files within fsys,
+// and absolute paths (such as those within GOROOT) name
+// files on the host.
+type vfs struct {
+	fsys fs.FS
+}
+
+// isHost reports whether the named file
+// lives on the host file system.
+func (v vfs) isHost(name string) bool {
+	return v.fsys == nil || filepath.IsAbs(name)
+}
+
+// fsName returns the name of the given file within v.fsys.
+func (v vfs) fsName(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+func (v vfs) readDir(name string) ([]fs.DirEntry, error) {
+	if v.isHost(name) {
+		return os.ReadDir(name)
+	}
+	return fs.ReadDir(v.fsys, v.fsName(name))
+}
+
+func (v vfs) open(name string) (io.ReadCloser, error) {
+	if v.isHost(name) {
+		return os.Open(name)
+	}
+	return v.fsys.Open(v.fsName(name))
+}
+
+func (v vfs) readFile(name string) ([]byte, error) {
+	if v.isHost(name) {
+		return os.ReadFile(name)
+	}
+	return fs.ReadFile(v.fsys, v.fsName(name))
+}
+
+func (v vfs) stat(name string) (fs.FileInfo, error) {
+	if v.isHost(name) {
+		return os.Stat(name)
+	}
+	return fs.Stat(v.fsys, v.fsName(name))
+}
+
+func (v vfs) writeFile(name string, data []byte, perm fs.FileMode) error {
+	if v.fsys == nil {
+		return os.WriteFile(name, data, perm)
+	}
+	wfs, ok := v.fsys.(WriteFS)
+	if !ok || v.isHost(name) {
+		return fmt.Errorf("cannot write %s: file system is read-only", name)
+	}
+	return wfs.WriteFile(v.fsName(name), data, perm)
+}
+
+// writable reports whether files in the given
+// directory can be rewritten.
+func (v vfs) writable(dir string) bool {
+	if v.fsys != nil {
+		_, ok := v.fsys.(WriteFS)
+		return ok && !v.isHost(dir)
+	}
+	info, err := os.Stat(dir)
+	return err == nil && info.Mode().Perm()&0200 != 0
+}
+
+func (v vfs) join(elem ...string) string {
+	if len(elem) == 0 || v.isHost(elem[0]) {
+		return filepath.Join(elem...)
+	}
+	return path.Join(elem...)
+}
+
+func (v vfs) hasSubdir(root, dir string) (string, bool) {
+	if v.isHost(root) != v.isHost(dir) {
+		return "", false
+	}
+	if v.isHost(root) {
+		if rel, ok := hostSubdir(root, dir); ok {
+			return rel, true
+		}
+		// When either path is named through a symbolic link,
+		// as with a GOPATH entry or working directory under
+		// a linked directory, the canonical paths may agree
+		// even though the names do not.
+		return hostSubdir(canonicalPath(root), canonicalPath(dir))
+	}
+	root, dir = v.fsName(root), v.fsName(dir)
+	switch {
+	case root == ".":
+		return dir, dir != "."
+	case dir == root:
+		return ".", true
+	case strings.HasPrefix(dir, root+"/"):
+		return dir[len(root)+1:], true
+	}
+	return "", false
+}
+
+// hostSubdir reports whether the host directory dir
+// is within root, and if so returns its slash-separated
+// path relative to root.
+func hostSubdir(root, dir string) (string, bool) {
+	rel, err := filepath.Rel(cleanHostPath(root), cleanHostPath(dir))
+	if err != nil || isOutside(rel) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// buildContext returns a copy of ctxt that
+// reads files through v.
+func (v vfs) buildContext(ctxt *build.Context) *build.Context {
+	if v.fsys == nil {
+		// Note that setting any of the file system hooks
+		// would stop go/build from using the go command to
+		// resolve imports in module mode, so the host paths
+		// are normalized instead.
+		if runtime.GOOS != "windows" {
+			return ctxt
+		}
+		c := *ctxt
+		c.GOROOT = cleanHostPath(c.GOROOT)
+		gopath := filepath.SplitList(c.GOPATH)
+		for i, p := range gopath {
+			gopath[i] = cleanHostPath(p)
+		}
+		c.GOPATH = strings.Join(gopath, string(filepath.ListSeparator))
+		return &c
+	}
+	c := *ctxt
+	c.JoinPath = v.join
+	c.IsAbsPath = func(p string) bool {
+		return filepath.IsAbs(p)
+	}
+	c.HasSubdir = v.hasSubdir
+	c.IsDir = func(p string) bool {
+		info, err := v.stat(p)
+		return err == nil && info.IsDir()
+	}
+	c.ReadDir = func(dir string) ([]fs.FileInfo, error) {
+		entries, err := v.readDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		infos := make([]fs.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				return nil, err
+			}
+			infos = append(infos, info)
+		}
+		return infos, nil
+	}
+	c.OpenFile = v.open
+	return &c
+}
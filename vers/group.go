@@ -0,0 +1,95 @@
+package vers
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// ThirdPartyGroup names, for WithImportGroup, the import groups
+// holding no imports that look like standard library packages.
+const ThirdPartyGroup = "third-party"
+
+// importGroups returns the import groups of f: the runs of
+// imports in each import declaration that are not separated
+// by blank lines, as goimports arranges them.
+func importGroups(fset *token.FileSet, f *ast.File) [][]*ast.ImportSpec {
+	var groups [][]*ast.ImportSpec
+	for _, decl := range f.Decls {
+		d, ok := decl.(*ast.GenDecl)
+		if !ok || d.Tok != token.IMPORT {
+			continue
+		}
+		var group []*ast.ImportSpec
+		lastLine := 0
+		for _, spec := range d.Specs {
+			ispec := spec.(*ast.ImportSpec)
+			// A comment above the import belongs to it,
+			// so the group starts where the comment does.
+			start := ispec.Pos()
+			if ispec.Doc != nil {
+				start = ispec.Doc.Pos()
+			}
+			if len(group) > 0 && fset.PositionFor(start, false).Line > lastLine+1 {
+				groups = append(groups, group)
+				group = nil
+			}
+			group = append(group, ispec)
+			lastLine = fset.PositionFor(ispec.End(), false).Line
+		}
+		if len(group) > 0 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// groupMatches reports whether the import group holding the
+// given import paths is selected by name, which is either
+// ThirdPartyGroup or an import path prefix that must be held
+// by at least one of the imports in the group.
+func groupMatches(name string, paths []string) bool {
+	for _, p := range paths {
+		if name == ThirdPartyGroup {
+			if isStdLike(p) {
+				return false
+			}
+			continue
+		}
+		if p == name || strings.HasPrefix(p, strings.TrimSuffix(name, "/")+"/") {
+			return true
+		}
+	}
+	return name == ThirdPartyGroup
+}
+
+// isStdLike reports whether p looks like the import path of
+// a standard library package: its first element has no dot.
+func isStdLike(p string) bool {
+	first := p
+	if i := strings.Index(p, "/"); i >= 0 {
+		first = p[:i]
+	}
+	return !strings.Contains(first, ".")
+}
+
+// groupImports returns the imports of f that are in
+// the import groups selected by name.
+func groupImports(fset *token.FileSet, f *ast.File, name string) map[*ast.ImportSpec]bool {
+	selected := make(map[*ast.ImportSpec]bool)
+	for _, group := range importGroups(fset, f) {
+		paths := make([]string, 0, len(group))
+		for _, ispec := range group {
+			if p, err := strconv.Unquote(ispec.Path.Value); err == nil {
+				paths = append(paths, p)
+			}
+		}
+		if groupMatches(name, paths) {
+			for _, ispec := range group {
+				selected[ispec] = true
+			}
+		}
+	}
+	return selected
+}
@@ -0,0 +1,77 @@
+package vers
+
+import (
+	"go/ast"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// linknamePat matches a //go:linkname directive that names the
+// symbol it links to, capturing that symbol, which is qualified
+// by the import path of its package, as in
+//
+//	//go:linkname now gopkg.in/foo.v2/internal/clock.now
+var linknamePat = regexp.MustCompile(`(?m)^[ \t]*//go:linkname[ \t]+\S+[ \t]+(\S+)`)
+
+// linknameChanges returns the changes needed to the import paths
+// in the //go:linkname directives in src, the contents of a file
+// in package p, so that the package links against the symbols of
+// the same versions of packages that it imports. Only files that
+// import unsafe can hold such directives.
+func (rw *Rewriter) linknameChanges(p *Package, file string, src []byte) []*ImportChange {
+	var changes []*ImportChange
+	for _, m := range linknamePat.FindAllSubmatchIndex(src, -1) {
+		sym := string(src[m[2]:m[3]])
+		// The path ends at a dot after its last slash, but
+		// which one is not known, as its last element can
+		// hold dots too, as in gopkg.in/foo.v2.Func, so the
+		// first that gives a path to change is used. Such
+		// dots may also be escaped as %2e, as they are in
+		// the symbol tables.
+		for i := strings.LastIndex(sym, "/") + 1; i < len(sym); i++ {
+			if sym[i] != '.' {
+				continue
+			}
+			impPath := linknameUnescape(sym[:i])
+			fixed := rw.checker.fixFor(p.Override, impPath)
+			if fixed == impPath {
+				continue
+			}
+			repl := fixed
+			if impPath != sym[:i] {
+				dir, elem := path.Split(fixed)
+				repl = dir + strings.ReplaceAll(elem, ".", "%2e")
+			}
+			changes = append(changes, &ImportChange{
+				Pos:         offsetPosition(file, src, m[2]),
+				Old:         impPath,
+				New:         fixed,
+				Offset:      m[2],
+				End:         m[2] + i,
+				Replacement: repl,
+				Directive:   true,
+			})
+			break
+		}
+	}
+	return changes
+}
+
+// linknameUnescape returns the import path p, as written
+// in a //go:linkname directive, with any dots escaped
+// as %2e in its last element unescaped.
+func linknameUnescape(p string) string {
+	return strings.ReplaceAll(p, "%2e", ".")
+}
+
+// importsUnsafe reports whether f imports unsafe,
+// which any file using //go:linkname must.
+func importsUnsafe(f *ast.File) bool {
+	for _, ispec := range f.Imports {
+		if ispec.Path.Value == `"unsafe"` {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package vers
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MixedMajors holds a package that imports more than
+// one major version of the same package family, such as
+// both gopkg.in/foo.v2 and gopkg.in/foo.v3. This almost
+// always indicates a half-done migration, and causes subtle
+// bugs because the types in each version are distinct.
+type MixedMajors struct {
+	// Importer holds the import path of the package.
+	Importer string
+
+	// Family holds the import path of the family
+	// without its version element, such as gopkg.in/foo.
+	Family string
+
+	// Paths holds the paths imported from the family,
+	// in order.
+	Paths []string
+
+	// Module holds the module that the importing
+	// package was resolved within.
+	Module *Module
+}
+
+// majorElemPat matches the first major version element
+// in an import path, holding the major version in its
+// first capturing group.
+var majorElemPat = regexp.MustCompile(`[/.]v([0-9]+)(?:\.[0-9]+)*(?:-unstable)?(/|$)`)
+
+// findMixedMajors returns the packages that import more than
+// one major version of a family, considering only those
+// families with an import that would be changed, so that
+// unrelated families are left alone.
+func (c *checker) findMixedMajors() []*MixedMajors {
+	type importer struct {
+		path string
+		mod  *Module
+	}
+	var importers []importer
+	imports := make(map[importer][]string)
+	for _, imp := range c.imports {
+		from := importer{imp.From, imp.Module}
+		if _, ok := imports[from]; !ok {
+			importers = append(importers, from)
+		}
+		imports[from] = append(imports[from], vendorlessPath(imp.To))
+	}
+	var mixed []*MixedMajors
+	for _, from := range importers {
+		// Find the major versions of each family from
+		// the imports that have a version element.
+		families := make(map[string]map[string]bool)
+		for _, path := range imports[from] {
+			if loc := majorElemPat.FindStringSubmatchIndex(path); loc != nil {
+				family := path[0:loc[0]]
+				if families[family] == nil {
+					families[family] = make(map[string]bool)
+				}
+				families[family][path[0:loc[3]]] = true
+			}
+		}
+		// Those without one are of major version 1.
+		for _, path := range imports[from] {
+			if majorElemPat.MatchString(path) {
+				continue
+			}
+			for family, majors := range families {
+				if path == family || strings.HasPrefix(path, family+"/") {
+					majors[family] = true
+				}
+			}
+		}
+		for family, majors := range families {
+			if len(majors) < 2 {
+				continue
+			}
+			m := &MixedMajors{
+				Importer: from.path,
+				Family:   family,
+				Module:   from.mod,
+			}
+			changed := false
+			for _, path := range imports[from] {
+				if majors[familyMajor(family, path)] {
+					m.Paths = append(m.Paths, path)
+					changed = changed || c.fix(path) != path
+				}
+			}
+			if changed {
+				m.Paths = uniq(m.Paths)
+				mixed = append(mixed, m)
+			}
+		}
+	}
+	sort.Slice(mixed, func(i, j int) bool {
+		if mixed[i].Importer != mixed[j].Importer {
+			return mixed[i].Importer < mixed[j].Importer
+		}
+		return mixed[i].Family < mixed[j].Family
+	})
+	return mixed
+}
+
+// familyMajor returns the prefix of path that names the
+// major version of family that it belongs to, which is the
+// family itself for major version 1 without a version
+// element, or "" if path is not in the family.
+func familyMajor(family, path string) string {
+	if !strings.HasPrefix(path, family) {
+		return ""
+	}
+	if loc := majorElemPat.FindStringSubmatchIndex(path); loc != nil {
+		if loc[0] != len(family) {
+			return ""
+		}
+		return path[0:loc[3]]
+	}
+	if path == family || strings.HasPrefix(path, family+"/") {
+		return family
+	}
+	return ""
+}
+
+// uniq returns the sorted, distinct elements of paths.
+func uniq(paths []string) []string {
+	sort.Strings(paths)
+	j := 0
+	for i, p := range paths {
+		if i == 0 || p != paths[j-1] {
+			paths[j] = p
+			j++
+		}
+	}
+	return paths[0:j]
+}
+
+// FamilyMajors holds a package family that is imported under
+// more than one major version across the whole import graph,
+// as found by Result.AllMajors. Unlike MixedMajors, the
+// versions may be imported by different packages.
+type FamilyMajors struct {
+	// Family holds the import path of the family
+	// without its version element, such as gopkg.in/foo.
+	Family string
+
+	// Majors holds the prefix of the import paths naming each
+	// major version imported, such as gopkg.in/foo.v2, in order.
+	Majors []string
+
+	// Importers holds, for each of Majors, the packages
+	// that import that major version, in order.
+	Importers map[string][]string
+}
+
+// AllMajors returns the package families, of all those imported
+// by the packages checked, that are imported under more than one
+// major version, ordered by family. This is usually unintended,
+// as the types in each version are distinct.
+func (r *Result) AllMajors() []*FamilyMajors {
+	// Find the major versions of each family from
+	// the imports that have a version element.
+	families := make(map[string]map[string]bool)
+	for _, imp := range r.Imports {
+		path := vendorlessPath(imp.To)
+		if loc := majorElemPat.FindStringSubmatchIndex(path); loc != nil {
+			family := path[0:loc[0]]
+			if families[family] == nil {
+				families[family] = make(map[string]bool)
+			}
+			families[family][path[0:loc[3]]] = true
+		}
+	}
+	importers := make(map[string]map[string][]string)
+	for _, imp := range r.Imports {
+		path := vendorlessPath(imp.To)
+		for family, majors := range families {
+			major := familyMajor(family, path)
+			if major == "" {
+				continue
+			}
+			// Those without a version element
+			// are of major version 1.
+			majors[major] = true
+			if importers[family] == nil {
+				importers[family] = make(map[string][]string)
+			}
+			importers[family][major] = append(importers[family][major], imp.From)
+		}
+	}
+	var all []*FamilyMajors
+	for family, majors := range families {
+		if len(majors) < 2 {
+			continue
+		}
+		m := &FamilyMajors{
+			Family:    family,
+			Importers: importers[family],
+		}
+		for major := range majors {
+			m.Majors = append(m.Majors, major)
+			m.Importers[major] = uniq(m.Importers[major])
+		}
+		sort.Strings(m.Majors)
+		all = append(all, m)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Family < all[j].Family
+	})
+	return all
+}
@@ -0,0 +1,354 @@
+package vers
+
+import (
+	"bufio"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// modFile holds the requirements and replacements
+// declared in a module's go.mod file.
+type modFile struct {
+	// require maps from each required module
+	// path to its version.
+	require map[string]string
+
+	// replace maps from each replaced module
+	// path to its replacement.
+	replace map[string]modVersion
+
+	// requireLines holds each requirement
+	// in the order it appears.
+	requireLines []modRequire
+}
+
+// modRequire holds a single require line.
+type modRequire struct {
+	path, version string
+
+	// line holds the line number and text
+	// holds the text of the line, trimmed.
+	line int
+	text string
+}
+
+// modVersion holds a module path and version. The version
+// is empty when the path names a directory.
+type modVersion struct {
+	path, version string
+}
+
+// readModFile reads the requirements and replacements
+// from the given go.mod file.
+func (c *checker) readModFile(gomod string) *modFile {
+	mf := &modFile{
+		require: make(map[string]string),
+		replace: make(map[string]modVersion),
+	}
+	f, err := c.files.open(gomod)
+	if err != nil {
+		return mf
+	}
+	defer f.Close()
+	block := ""
+	scan := bufio.NewScanner(f)
+	for lineNum := 1; scan.Scan(); lineNum++ {
+		text := strings.TrimSpace(scan.Text())
+		line := text
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[0:i]
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 0:
+			continue
+		case block != "" && fields[0] == ")":
+			block = ""
+			continue
+		case len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+			continue
+		case block != "":
+			fields = append([]string{block}, fields...)
+		}
+		for i, f := range fields {
+			if p, err := strconv.Unquote(f); err == nil {
+				fields[i] = p
+			}
+		}
+		switch fields[0] {
+		case "require":
+			if len(fields) == 3 {
+				mf.require[fields[1]] = fields[2]
+				mf.requireLines = append(mf.requireLines, modRequire{
+					path:    fields[1],
+					version: fields[2],
+					line:    lineNum,
+					text:    text,
+				})
+			}
+		case "replace":
+			// replace old [version] => new [version]
+			arrow := -1
+			for i, f := range fields {
+				if f == "=>" {
+					arrow = i
+				}
+			}
+			if arrow < 2 || arrow == len(fields)-1 {
+				continue
+			}
+			r := modVersion{path: fields[arrow+1]}
+			if arrow+2 < len(fields) {
+				r.version = fields[arrow+2]
+			}
+			mf.replace[fields[1]] = r
+		}
+	}
+	return mf
+}
+
+// moduleCacheDir returns the directory holding the package with
+// the given import path as required by mod, found without the
+// help of the go command. It looks for the module in mod's module
+// graph with the longest path that is a prefix of the import path
+// and returns the package's directory within its replacement, if
+// there is one, or within the module cache otherwise.
+func (c *checker) moduleCacheDir(mod *Module, path string) (string, bool) {
+	modPath, version := "", ""
+	for p, v := range c.selectedVersions(mod) {
+		if (path == p || strings.HasPrefix(path, p+"/")) && len(p) > len(modPath) {
+			modPath, version = p, v
+		}
+	}
+	if modPath == "" {
+		return "", false
+	}
+	rest := strings.TrimPrefix(path[len(modPath):], "/")
+	if r, ok := mod.modFile.replace[modPath]; ok {
+		if r.version == "" {
+			return c.files.join(c.replacementDir(mod, r), rest), true
+		}
+		modPath, version = r.path, r.version
+	}
+	cache := moduleCache()
+	if cache == "" {
+		return "", false
+	}
+	dir := filepath.Join(cache, escapeModulePath(modPath)+"@"+escapeModulePath(version), filepath.FromSlash(rest))
+	if _, err := os.Stat(dir); err != nil {
+		return "", false
+	}
+	return dir, true
+}
+
+// fetchedDir returns the directory in the module cache holding
+// the package with the given import path within the module in
+// Checker.Fetched with the longest path that is a prefix of it.
+func (c *checker) fetchedDir(path string) (string, bool) {
+	modPath, version := "", ""
+	for p, v := range c.Fetched {
+		if (path == p || strings.HasPrefix(path, p+"/")) && len(p) > len(modPath) {
+			modPath, version = p, v
+		}
+	}
+	cache := moduleCache()
+	if modPath == "" || cache == "" {
+		return "", false
+	}
+	rest := strings.TrimPrefix(path[len(modPath):], "/")
+	dir := filepath.Join(cache, escapeModulePath(modPath)+"@"+escapeModulePath(version), filepath.FromSlash(rest))
+	if _, err := os.Stat(dir); err != nil {
+		return "", false
+	}
+	return dir, true
+}
+
+// selectedVersions returns the version of each module in mod's
+// module graph, found by following the requirements of the go.mod
+// files of its dependencies, as recorded in the module cache, and
+// choosing the highest version of each module required by any of
+// them, as minimal version selection does. The graph is not pruned
+// as the go command prunes it for modules at go 1.17 or later, so
+// a later version may occasionally be chosen than the go command
+// would choose.
+func (c *checker) selectedVersions(mod *Module) map[string]string {
+	if mod.selected != nil {
+		return mod.selected
+	}
+	if mod.modFile == nil {
+		mod.modFile = c.readModFile(c.files.join(mod.Dir, "go.mod"))
+	}
+	selected := make(map[string]string)
+	seen := make(map[modVersion]bool)
+	var queue []modVersion
+	for p, v := range mod.modFile.require {
+		queue = append(queue, modVersion{p, v})
+	}
+	for len(queue) > 0 {
+		m := queue[0]
+		queue = queue[1:]
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+		if v, ok := selected[m.path]; !ok || CompareVersions(m.version, v) > 0 {
+			selected[m.path] = m.version
+		}
+		for p, v := range c.depModFile(mod, m).require {
+			queue = append(queue, modVersion{p, v})
+		}
+	}
+	mod.selected = selected
+	return selected
+}
+
+// depModFile returns the go.mod file of the given version of a
+// module in mod's graph, taking account of mod's replacements,
+// or an empty modFile if it cannot be found.
+func (c *checker) depModFile(mod *Module, m modVersion) *modFile {
+	if r, ok := mod.modFile.replace[m.path]; ok {
+		if r.version == "" {
+			return c.readModFile(c.files.join(c.replacementDir(mod, r), "go.mod"))
+		}
+		m = r
+	}
+	cache := moduleCache()
+	if cache == "" {
+		return &modFile{}
+	}
+	// The download cache holds the go.mod file of every
+	// version in the graph, even those whose source has
+	// not been downloaded.
+	gomod := filepath.Join(cache, "cache", "download", escapeModulePath(m.path), "@v", escapeModulePath(m.version)+".mod")
+	if _, err := os.Stat(gomod); err != nil {
+		gomod = filepath.Join(cache, escapeModulePath(m.path)+"@"+escapeModulePath(m.version), "go.mod")
+	}
+	return c.readModFile(gomod)
+}
+
+// replacementDir returns the directory named
+// by the directory replacement r in mod.
+func (c *checker) replacementDir(mod *Module, r modVersion) string {
+	if filepath.IsAbs(r.path) {
+		return r.path
+	}
+	return c.files.join(mod.Dir, r.path)
+}
+
+// CompareVersions compares two semantic versions, such as
+// v1.2.3 or v2.0.0-pre+incompatible, returning -1, 0 or 1.
+// Build metadata is ignored, and a pre-release version is
+// lower than its release.
+func CompareVersions(a, b string) int {
+	a, b = strings.SplitN(a, "+", 2)[0], strings.SplitN(b, "+", 2)[0]
+	a, aPre := splitPrerelease(a)
+	b, bPre := splitPrerelease(b)
+	if c := compareIdents(strings.Split(strings.TrimPrefix(a, "v"), "."), strings.Split(strings.TrimPrefix(b, "v"), "."), true); c != 0 {
+		return c
+	}
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return compareIdents(strings.Split(aPre, "."), strings.Split(bPre, "."), false)
+}
+
+// splitPrerelease splits a version without build
+// metadata into its release and pre-release parts.
+func splitPrerelease(v string) (release, pre string) {
+	if i := strings.Index(v, "-"); i >= 0 {
+		return v[:i], v[i+1:]
+	}
+	return v, ""
+}
+
+// compareIdents compares two dot-separated lists of version
+// identifiers. Numeric identifiers compare numerically and
+// lower than alphanumeric ones; if numeric is true, missing
+// identifiers count as zero.
+func compareIdents(a, b []string, numeric bool) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y string
+		switch {
+		case i >= len(a):
+			if !numeric {
+				return -1
+			}
+			x = "0"
+		case i >= len(b):
+			if !numeric {
+				return 1
+			}
+			y = "0"
+		}
+		if x == "" {
+			x = a[i]
+		}
+		if y == "" {
+			y = b[i]
+		}
+		xn, xerr := strconv.Atoi(x)
+		yn, yerr := strconv.Atoi(y)
+		switch {
+		case xerr == nil && yerr == nil:
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		case xerr == nil:
+			return -1
+		case yerr == nil:
+			return 1
+		case x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// moduleCache returns the root of the module cache.
+func moduleCache() string {
+	if c := os.Getenv("GOMODCACHE"); c != "" {
+		return c
+	}
+	if gopath := filepath.SplitList(build.Default.GOPATH); len(gopath) > 0 && gopath[0] != "" {
+		return filepath.Join(gopath[0], "pkg", "mod")
+	}
+	return ""
+}
+
+// escapeModulePath escapes a module path or version as the
+// module cache requires, replacing each upper case letter
+// with '!' followed by its lower case form.
+func escapeModulePath(p string) string {
+	var buf strings.Builder
+	for _, r := range p {
+		if unicode.IsUpper(r) {
+			buf.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		buf.WriteRune(r)
+	}
+	return buf.String()
+}
+
+// isStandard reports whether the import
+// path names a standard library package.
+func isStandard(path string) bool {
+	elem, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(elem, ".")
+}
@@ -0,0 +1,227 @@
+package vers
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Module holds a Go module found within the tree being
+// checked. Each module resolves its imports independently,
+// as the go command would when building it.
+type Module struct {
+	// Dir holds the root directory of the module.
+	Dir string
+
+	// Path holds the module path declared in go.mod,
+	// or the empty string when the packages are not
+	// in a module (GOPATH mode).
+	Path string
+
+	// Failed holds whether any package in the module
+	// has failed its checks.
+	Failed bool
+
+	buildCtxt *build.Context
+
+	// checked maps from the import path of each package
+	// checked to the least depth at which it was reached,
+	// counting the packages in the tree as depth 0.
+	checked map[string]int
+
+	// modFile holds the contents of the module's go.mod
+	// file, read when first needed by moduleCacheDir.
+	modFile *modFile
+
+	// selected holds the version of each module in the
+	// module's graph, worked out when first needed by
+	// moduleCacheDir (see selectedVersions).
+	selected map[string]string
+
+	// importedBy maps from the import path of each checked
+	// package to the package that first imported it.
+	importedBy map[string]string
+}
+
+// Name returns the module path, or the module's
+// directory if it has no path.
+func (mod *Module) Name() string {
+	if mod.Path == "" {
+		return mod.Dir
+	}
+	return mod.Path
+}
+
+// newModule returns a new module rooted at dir with the
+// given module path and adds it to c.modules.
+func (c *checker) newModule(dir, path string) *Module {
+	buildCtxt := *c.buildCtxt
+	if path != "" {
+		// Resolve imports relative to the module's
+		// own go.mod file.
+		buildCtxt.Dir = dir
+	}
+	mod := &Module{
+		Dir:        dir,
+		Path:       path,
+		buildCtxt:  &buildCtxt,
+		checked:    make(map[string]int),
+		importedBy: make(map[string]string),
+	}
+	c.modules = append(c.modules, mod)
+	return mod
+}
+
+// rootModule returns the module containing dir,
+// which need not be at the root of the module.
+func (c *checker) rootModule(dir string) *Module {
+	for d := dir; ; {
+		if path, ok := c.readModulePath(c.files.join(d, "go.mod")); ok {
+			return c.newModule(d, path)
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+	return c.newModule(dir, "")
+}
+
+// importPath returns the import path of the package
+// in the given directory within the module.
+func (mod *Module) importPath(dir string) (string, bool) {
+	rel, err := filepath.Rel(mod.Dir, dir)
+	if err != nil || isOutside(rel) {
+		return "", false
+	}
+	if rel == "." {
+		return mod.Path, true
+	}
+	return mod.Path + "/" + filepath.ToSlash(rel), true
+}
+
+// importChain returns the chain of imports from one
+// of the packages in the tree to the package with
+// the given import path.
+func (mod *Module) importChain(path string) []string {
+	chain := []string{path}
+	seen := map[string]bool{path: true}
+	for {
+		parent, ok := mod.importedBy[path]
+		if !ok || seen[parent] {
+			break
+		}
+		seen[parent] = true
+		chain = append(chain, parent)
+		path = parent
+	}
+	for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+		chain[i], chain[j] = chain[j], chain[i]
+	}
+	return chain
+}
+
+// readModulePath returns the module path declared
+// in the given go.mod file. It reports false if the file
+// could not be read or has no module directive.
+func (c *checker) readModulePath(gomod string) (string, bool) {
+	f, err := c.files.open(gomod)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	scan := bufio.NewScanner(f)
+	for scan.Scan() {
+		line := scan.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[0:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || fields[0] != "module" {
+			continue
+		}
+		path := fields[1]
+		if p, err := strconv.Unquote(path); err == nil {
+			path = p
+		}
+		return path, true
+	}
+	return "", false
+}
+
+// resolveMajor resolves the package with the given import path,
+// which could not be found outside a module, with the package
+// and error returned by the failed attempt, by looking for it as
+// the go command does in GOPATH mode. A path with a major version
+// element, such as example.com/lib/v2/sub, names a package in the
+// v2 subdirectory of the example.com/lib checkout when upstream
+// keeps each major version in a subdirectory; when it keeps each
+// on a branch instead, the path names the package in the sub
+// directory of the checkout, if its go.mod file declares the
+// module example.com/lib/v2. If neither is found, the error says
+// which module the checkout holds.
+func (c *checker) resolveMajor(mod *Module, path string, pkg *build.Package, err error) (*build.Package, error) {
+	elems := strings.Split(path, "/")
+	i := 1
+	for ; i < len(elems); i++ {
+		if isMajorSuffix(elems[i]) && elems[i] != "v0" && elems[i] != "v1" {
+			break
+		}
+	}
+	if i == len(elems) {
+		return pkg, err
+	}
+	prefix, rest := strings.Join(elems[:i], "/"), strings.Join(elems[i+1:], "/")
+	modPath := prefix + "/" + elems[i]
+	for _, src := range mod.buildCtxt.SrcDirs() {
+		root := filepath.Join(src, filepath.FromSlash(prefix))
+		declared, ok := c.readModulePath(filepath.Join(root, "go.mod"))
+		if !ok {
+			continue
+		}
+		if declared != modPath {
+			return pkg, fmt.Errorf("cannot find package %q: the checkout in %s holds module %s, with no %s subdirectory; check out a version that provides %s", path, root, declared, elems[i], modPath)
+		}
+		mpkg, merr := c.loadPackage(mod.buildCtxt, ".", filepath.Join(root, filepath.FromSlash(rest)), false)
+		if merr != nil {
+			return pkg, err
+		}
+		mpkg.ImportPath = path
+		return mpkg, nil
+	}
+	return pkg, err
+}
+
+// InModuleCache reports whether dir is inside the
+// (read-only) module cache.
+func InModuleCache(dir string) bool {
+	var caches []string
+	if c := os.Getenv("GOMODCACHE"); c != "" {
+		caches = append(caches, c)
+	}
+	for _, p := range filepath.SplitList(build.Default.GOPATH) {
+		if p != "" {
+			caches = append(caches, filepath.Join(p, "pkg", "mod"))
+		}
+	}
+	for _, c := range caches {
+		if hasFilePathPrefix(dir, c) {
+			return true
+		}
+	}
+	// The directory or the cache may be named through
+	// a symbolic link (for example /tmp on macOS), so
+	// compare their canonical paths too.
+	dir = canonicalPath(dir)
+	for _, c := range caches {
+		if hasFilePathPrefix(dir, canonicalPath(c)) {
+			return true
+		}
+	}
+	return false
+}
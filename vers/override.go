@@ -0,0 +1,63 @@
+package vers
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Override holds rules that apply, in place of Checker.Rules,
+// to the packages in a directory of the tree and those below it,
+// such as examples that deliberately keep using an old version.
+type Override struct {
+	// Dir holds the slash-separated path of the
+	// directory, relative to Checker.Dir.
+	Dir string
+
+	// Rules holds the rules for the packages in Dir.
+	Rules Rules
+
+	// Disable causes the packages in Dir to be left
+	// alone, as if excluded, and Rules to be ignored.
+	Disable bool
+}
+
+// overrideFor returns the override that applies to the given
+// directory: the one for the closest directory containing it,
+// or nil if there is none.
+func (c *checker) overrideFor(dir string) *Override {
+	if len(c.Overrides) == 0 {
+		return nil
+	}
+	rel, err := filepath.Rel(c.dir, dir)
+	if err != nil {
+		return nil
+	}
+	rel = filepath.ToSlash(rel)
+	var found *Override
+	for _, o := range c.Overrides {
+		odir := strings.Trim(filepath.ToSlash(o.Dir), "/")
+		if odir != rel && !strings.HasPrefix(rel, odir+"/") && odir != "." {
+			continue
+		}
+		if found == nil || len(odir) > len(strings.Trim(found.Dir, "/")) {
+			found = o
+		}
+	}
+	if found != nil && !c.applied[found] {
+		c.applied[found] = true
+		c.overrides = append(c.overrides, found)
+	}
+	return found
+}
+
+// fixFor is like fix, but uses the rules of the given
+// override, if it is not nil.
+func (c *Checker) fixFor(o *Override, p string) string {
+	switch {
+	case o == nil:
+		return c.fix(p)
+	case o.Disable:
+		return p
+	}
+	return c.fixRules(o.Rules, p)
+}
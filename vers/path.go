@@ -0,0 +1,85 @@
+package vers
+
+import (
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// cleanHostPath returns the host path p in a form that can be
+// compared with other paths: it is cleaned, and on Windows any
+// long-path prefix is removed (see trimLongPathPrefix) and the
+// drive letter is made upper case, so that the same directory
+// named in different ways compares equal.
+func cleanHostPath(p string) string {
+	if runtime.GOOS == "windows" {
+		p = trimLongPathPrefix(p)
+		if len(p) >= 2 && p[1] == ':' && 'a' <= p[0] && p[0] <= 'z' {
+			p = strings.ToUpper(p[0:1]) + p[1:]
+		}
+	}
+	if p == "" {
+		return ""
+	}
+	return filepath.Clean(p)
+}
+
+// trimLongPathPrefix returns the Windows path p without any
+// \\?\ or \\.\ prefix, as used to name paths longer than
+// MAX_PATH, turning \\?\UNC\server\share into \\server\share.
+// The prefix is kept when what follows it is neither a drive
+// nor a share, as in \\.\pipe\name, since removing it would
+// name a different file. Either slash may be used.
+func trimLongPathPrefix(p string) string {
+	if len(p) < 4 || !isSlash(p[0]) || !isSlash(p[1]) || p[2] != '?' && p[2] != '.' || !isSlash(p[3]) {
+		return p
+	}
+	rest := p[4:]
+	switch {
+	case len(rest) >= 4 && strings.EqualFold(rest[:3], "UNC") && isSlash(rest[3]):
+		return `\\` + rest[4:]
+	case len(rest) >= 2 && rest[1] == ':' && ('a' <= rest[0] && rest[0] <= 'z' || 'A' <= rest[0] && rest[0] <= 'Z'):
+		return rest
+	}
+	return p
+}
+
+func isSlash(c byte) bool {
+	return c == '\\' || c == '/'
+}
+
+// canonicalPath returns the host path p with any symbolic
+// links resolved, or p itself (cleaned) if they cannot be.
+func canonicalPath(p string) string {
+	if q, err := filepath.EvalSymlinks(p); err == nil {
+		return cleanHostPath(q)
+	}
+	return cleanHostPath(p)
+}
+
+// hasFilePathPrefix reports whether the host path s is the
+// same as prefix or lies within it. As on the file system itself,
+// the comparison ignores case on Windows, so that paths whose
+// drive letters differ in case are treated as the same.
+func hasFilePathPrefix(s, prefix string) bool {
+	s, prefix = cleanHostPath(s), cleanHostPath(prefix)
+	if len(s) < len(prefix) {
+		return false
+	}
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) && len(s) > len(prefix) {
+		if s[len(prefix)] != filepath.Separator {
+			return false
+		}
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(s[0:len(prefix)], prefix)
+	}
+	return s[0:len(prefix)] == prefix
+}
+
+// isOutside reports whether the relative path rel,
+// as returned by filepath.Rel, leads outside
+// the directory it is relative to.
+func isOutside(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,56 @@
+package vers
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+var trimLongPathPrefixTests = []struct {
+	path string
+	want string
+}{
+	{`C:\src\app`, `C:\src\app`},
+	{`\\?\C:\src\app`, `C:\src\app`},
+	{`\\?\c:\src\app`, `c:\src\app`},
+	{`//?/C:/src/app`, `C:/src/app`},
+	{`\\.\C:\src\app`, `C:\src\app`},
+	{`\\?\UNC\server\share\app`, `\\server\share\app`},
+	{`\\?\unc\server\share`, `\\server\share`},
+	{`//?/UNC/server/share/app`, `\\server/share/app`},
+	{`\\server\share\app`, `\\server\share\app`},
+	// Device paths name no drive or share,
+	// so the prefix is part of the name.
+	{`\\.\pipe\govers`, `\\.\pipe\govers`},
+	{`\\?\Volume{1b3b1146-4076-11e1-84aa-806e6f6e6963}\app`, `\\?\Volume{1b3b1146-4076-11e1-84aa-806e6f6e6963}\app`},
+	{`\\?\`, `\\?\`},
+	{`/src/app`, `/src/app`},
+	{``, ``},
+}
+
+func TestTrimLongPathPrefix(t *testing.T) {
+	for _, test := range trimLongPathPrefixTests {
+		if got := trimLongPathPrefix(test.path); got != test.want {
+			t.Errorf("trimLongPathPrefix(%q) = %q; want %q", test.path, got, test.want)
+		}
+	}
+}
+
+var isOutsideTests = []struct {
+	rel  string
+	want bool
+}{
+	{".", false},
+	{"a", false},
+	{"..", true},
+	{filepath.Join("..", "a"), true},
+	{"..a", false},
+	{filepath.Join("a", ".."), false},
+}
+
+func TestIsOutside(t *testing.T) {
+	for _, test := range isOutsideTests {
+		if got := isOutside(test.rel); got != test.want {
+			t.Errorf("isOutside(%q) = %v; want %v", test.rel, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+//go:build !windows
+
+package vers
+
+import "testing"
+
+var cleanHostPathTests = []struct {
+	path string
+	want string
+}{
+	{"/src/app", "/src/app"},
+	{"/src/app/", "/src/app"},
+	{"/src/./sub/../app", "/src/app"},
+	{"//src//app", "/src/app"},
+	// Windows prefixes mean nothing elsewhere.
+	{`\\?\C:\src`, `\\?\C:\src`},
+	{"", ""},
+}
+
+func TestCleanHostPath(t *testing.T) {
+	for _, test := range cleanHostPathTests {
+		if got := cleanHostPath(test.path); got != test.want {
+			t.Errorf("cleanHostPath(%q) = %q; want %q", test.path, got, test.want)
+		}
+	}
+}
+
+var hasFilePathPrefixTests = []struct {
+	s, prefix string
+	want      bool
+}{
+	{"/src/app", "/src/app", true},
+	{"/src/app/sub", "/src/app", true},
+	{"/src/app/sub", "/src/app/", true},
+	{"/src/application", "/src/app", false},
+	{"/src", "/src/app", false},
+	{"/src/app", "/", true},
+	{"/src/app/../other", "/src/app", false},
+	{"/src/App", "/src/app", false},
+}
+
+func TestHasFilePathPrefix(t *testing.T) {
+	for _, test := range hasFilePathPrefixTests {
+		if got := hasFilePathPrefix(test.s, test.prefix); got != test.want {
+			t.Errorf("hasFilePathPrefix(%q, %q) = %v; want %v", test.s, test.prefix, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package vers
+
+import "testing"
+
+var cleanHostPathTests = []struct {
+	path string
+	want string
+}{
+	{`C:\src\app`, `C:\src\app`},
+	{`c:\src\app`, `C:\src\app`},
+	{`c:/src/app/`, `C:\src\app`},
+	{`C:\src\.\sub\..\app`, `C:\src\app`},
+	{`\\?\C:\src\app`, `C:\src\app`},
+	{`\\?\c:\src\app`, `C:\src\app`},
+	{`//?/c:/src/app`, `C:\src\app`},
+	{`\\.\C:\src\app`, `C:\src\app`},
+	{`\\?\UNC\server\share\app`, `\\server\share\app`},
+	{`\\?\unc\server\share\app`, `\\server\share\app`},
+	{`\\server\share\app\`, `\\server\share\app`},
+	{"", ""},
+}
+
+func TestCleanHostPath(t *testing.T) {
+	for _, test := range cleanHostPathTests {
+		if got := cleanHostPath(test.path); got != test.want {
+			t.Errorf("cleanHostPath(%q) = %q; want %q", test.path, got, test.want)
+		}
+	}
+}
+
+var hasFilePathPrefixTests = []struct {
+	s, prefix string
+	want      bool
+}{
+	{`C:\src\app`, `C:\src\app`, true},
+	{`C:\src\app\sub`, `C:\src\app`, true},
+	{`c:\src\app\sub`, `C:\src\app`, true},
+	{`C:\src\app\sub`, `c:\src\app`, true},
+	{`C:\Src\App\sub`, `c:\src\app`, true},
+	{`C:\src\application`, `C:\src\app`, false},
+	{`C:\src\app`, `C:\`, true},
+	{`D:\src\app`, `C:\src`, false},
+	{`\\?\C:\src\app\sub`, `C:\src\app`, true},
+	{`C:\src\app\sub`, `\\?\c:\src\app`, true},
+	{`\\?\UNC\server\share\app`, `\\server\share`, true},
+	{`\\server\share\app`, `\\?\UNC\server\share`, true},
+	{`\\server\share2\app`, `\\server\share`, false},
+	{`\\other\share\app`, `\\server\share`, false},
+}
+
+func TestHasFilePathPrefix(t *testing.T) {
+	for _, test := range hasFilePathPrefixTests {
+		if got := hasFilePathPrefix(test.s, test.prefix); got != test.want {
+			t.Errorf("hasFilePathPrefix(%q, %q) = %v; want %v", test.s, test.prefix, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package vers
+
+import "fmt"
+
+// Problem describes something that could not be processed, such
+// as a directory that cannot be read or a file that cannot be
+// parsed, and so was skipped.
+type Problem struct {
+	Kind ProblemKind
+
+	// Path holds the directory or file that could not be
+	// processed or, for ImportProblem, the import path
+	// that could not be imported.
+	Path string
+
+	// Dir holds, for ImportProblem, the directory
+	// that the import was resolved from.
+	Dir string
+
+	// Err holds the error encountered.
+	Err error
+}
+
+// ProblemKind says what could not be done.
+type ProblemKind int
+
+const (
+	// DirProblem means that a directory could not be read.
+	DirProblem ProblemKind = iota
+
+	// ReadProblem means that a file could not be read.
+	ReadProblem
+
+	// ParseProblem means that a file could not be parsed.
+	ParseProblem
+
+	// ImportProblem means that a package could not be imported.
+	ImportProblem
+
+	// WriteProblem means that a file could not be changed.
+	WriteProblem
+)
+
+func (p *Problem) Error() string {
+	switch p.Kind {
+	case DirProblem:
+		return fmt.Sprintf("cannot read directory %q: %v", p.Path, p.Err)
+	case ReadProblem:
+		return fmt.Sprintf("cannot read %q: %v", p.Path, p.Err)
+	case ParseProblem:
+		return fmt.Sprintf("cannot parse %q: %v", p.Path, p.Err)
+	case ImportProblem:
+		return fmt.Sprintf("cannot import %q from %q: %v", p.Path, p.Dir, p.Err)
+	}
+	return fmt.Sprintf("cannot change %q: %v", p.Path, p.Err)
+}
+
+// WithFailFast causes the Rewriter to stop at the first problem
+// that would otherwise be reported in Result.Problems and skipped,
+// returning it as an error. See Checker.FailFast.
+func WithFailFast(failFast bool) Option {
+	return func(rw *Rewriter) {
+		rw.checker.FailFast = failFast
+	}
+}
+
+// problem logs and records the problem p or, if FailFast
+// is set, stops the check so that Check returns it.
+func (c *checker) problem(p *Problem) {
+	if c.FailFast {
+		if c.stopped == nil {
+			c.stopped = p
+		}
+		return
+	}
+	c.logf("%v", p)
+	c.problems = append(c.problems, p)
+	c.event(&Event{Kind: ProblemEvent, Problem: p})
+}
@@ -0,0 +1,123 @@
+package vers
+
+import (
+	"go/ast"
+	"strconv"
+	"strings"
+)
+
+// Rename describes an identifier exported by a package that
+// has a different name in the package that replaces it, such
+// as a function renamed in a new major version.
+type Rename struct {
+	// Path holds the import path of the package
+	// before its imports are changed.
+	Path string
+
+	// Old and New hold the name of the identifier
+	// before and after the change.
+	Old, New string
+}
+
+// WithRenames causes the given identifiers to be renamed in
+// each file whose imports of their packages are changed, so
+// that simple changes of API can be made in the same pass as
+// the change of import path. Only qualified identifiers, such
+// as yaml.Marshal, are renamed; methods and fields are not.
+func WithRenames(renames ...*Rename) Option {
+	return func(rw *Rewriter) {
+		if rw.renames == nil {
+			rw.renames = make(map[string]map[string]string)
+		}
+		for _, r := range renames {
+			if rw.renames[r.Path] == nil {
+				rw.renames[r.Path] = make(map[string]string)
+			}
+			rw.renames[r.Path][r.Old] = r.New
+		}
+	}
+}
+
+// renameIdents returns the edits that rename the identifiers in f
+// qualified by each of the imports in changed, which maps from each
+// import whose path is changed to its old path, according to
+// rw.renames.
+func (rw *Rewriter) renameIdents(f *ast.File, changed map[*ast.ImportSpec]string) []Edit {
+	// names maps from the name of each changed import
+	// to the renames to make in identifiers it qualifies.
+	names := make(map[string]map[string]string)
+	for ispec, oldPath := range changed {
+		renames := rw.renames[oldPath]
+		if len(renames) == 0 {
+			continue
+		}
+		path, _ := strconv.Unquote(ispec.Path.Value)
+		name := ImportName(path)
+		if ispec.Name != nil {
+			name = ispec.Name.Name
+		}
+		if name == "_" || name == "." {
+			continue
+		}
+		names[name] = renames
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	var edits []Edit
+	ast.Inspect(f, func(node ast.Node) bool {
+		sel, ok := node.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		// The parser leaves references to imported
+		// packages unresolved, so an identifier with
+		// an object is a local declaration that
+		// shadows the import.
+		x, ok := sel.X.(*ast.Ident)
+		if !ok || x.Obj != nil {
+			return true
+		}
+		if newName, ok := names[x.Name][sel.Sel.Name]; ok {
+			edits = append(edits, Edit{
+				Pos: sel.Sel.Pos(),
+				End: sel.Sel.End(),
+				New: newName,
+			})
+		}
+		return true
+	})
+	return edits
+}
+
+// ImportName returns the name that a package with the given
+// import path is most likely to declare: the last element of the
+// path without any major version suffix, such as "/v2" or ".v2",
+// or "go-" or "go." prefix.
+func ImportName(path string) string {
+	elems := strings.Split(path, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && isMajorSuffix(name) {
+		name = elems[len(elems)-2]
+	}
+	if i := strings.LastIndex(name, ".v"); i > 0 && isMajorSuffix(name[i+1:]) {
+		name = name[0:i]
+	}
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "go-"), "go.")
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// isMajorSuffix reports whether elem is a major
+// version element such as "v2".
+func isMajorSuffix(elem string) bool {
+	if len(elem) < 2 || elem[0] != 'v' {
+		return false
+	}
+	_, err := strconv.Atoi(elem[1:])
+	return err == nil
+}
@@ -0,0 +1,713 @@
+package vers
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Rewriter changes the import paths used by the packages in
+// a source tree according to a set of rewrite rules, after
+// checking that doing so leaves the tree consistent with
+// its dependencies.
+//
+// A Rewriter is used in three steps: Scan finds the packages
+// and checks them, Plan works out the changes to make, and
+// Apply makes them. Callers may inspect or filter the plan
+// before applying it.
+type Rewriter struct {
+	checker     Checker
+	dryRun      bool
+	noFailing   bool
+	importsOnly bool
+	parallel    int
+	cacheDir    string
+	cache       *planCache
+	importGroup string
+	result      *Result
+
+	// renames maps from the old import path of each package
+	// with renamed identifiers to a map from each old name
+	// to its new one, as set by WithRenames.
+	renames map[string]map[string]string
+
+	// fixers holds the fixers to
+	// apply, as set by WithFixers.
+	fixers []*Fixer
+}
+
+// Option configures a Rewriter.
+type Option func(*Rewriter)
+
+// NewRewriter returns a new Rewriter configured with
+// the given options.
+func NewRewriter(opts ...Option) *Rewriter {
+	rw := new(Rewriter)
+	for _, opt := range opts {
+		opt(rw)
+	}
+	return rw
+}
+
+// WithDir sets the root of the source tree.
+// By default, the current directory is used.
+func WithDir(dir string) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Dir = dir
+	}
+}
+
+// WithRules adds the given rewrite rules.
+func WithRules(rules ...*Rule) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Rules = append(rw.checker.Rules, rules...)
+	}
+}
+
+// WithPattern adds a rewrite rule that changes import paths
+// with a prefix matching pat to use replacement instead. The
+// prefix to be replaced is held in the first capturing group
+// of pat, which should be anchored at the start.
+func WithPattern(pat *regexp.Regexp, replacement string) Option {
+	return WithRules(&Rule{
+		Arg:           replacement,
+		NewPackage:    replacement,
+		OldPackagePat: pat,
+	})
+}
+
+// WithMapping causes the Rewriter to use fn to decide how import
+// paths should be changed, in place of any rules.
+func WithMapping(fn MapFunc) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Map = fn
+	}
+}
+
+// WithBuildContext sets the build context used
+// to resolve imports. By default, build.Default is used.
+func WithBuildContext(ctxt *build.Context) Option {
+	return func(rw *Rewriter) {
+		rw.checker.BuildContext = ctxt
+	}
+}
+
+// WithDryRun causes Apply to make no changes.
+func WithDryRun(dryRun bool) Option {
+	return func(rw *Rewriter) {
+		rw.dryRun = dryRun
+	}
+}
+
+// WithoutFailing causes Plan to change the packages in
+// modules that failed their checks as well as the others,
+// for when inconsistent dependencies are to be reported
+// but not to prevent the change.
+func WithoutFailing(noFailing bool) Option {
+	return func(rw *Rewriter) {
+		rw.noFailing = noFailing
+	}
+}
+
+// WithImportsOnly causes Plan to parse only the import
+// declarations of each file, without their comments, which
+// makes planning faster at the cost of FileEdit.Generated
+// always being false. Together with WithDryRun, which stops
+// Apply parsing and printing whole files, this makes checks
+// that change nothing considerably cheaper.
+func WithImportsOnly(importsOnly bool) Option {
+	return func(rw *Rewriter) {
+		rw.importsOnly = importsOnly
+	}
+}
+
+// WithImportGroup restricts the imports that Plan changes to
+// those in the import groups (runs of imports not separated by
+// blank lines) selected by name: with ThirdPartyGroup, the groups
+// holding no imports that look like standard library packages,
+// and otherwise the groups holding at least one import with name
+// as a prefix. Imports in the other groups are left alone even
+// if the rules match them.
+func WithImportGroup(name string) Option {
+	return func(rw *Rewriter) {
+		rw.importGroup = name
+	}
+}
+
+// WithFoldCase causes import paths to be matched against the
+// rules without regard to case. See Checker.FoldCase.
+func WithFoldCase(foldCase bool) Option {
+	return func(rw *Rewriter) {
+		rw.checker.FoldCase = foldCase
+	}
+}
+
+// WithTests causes the test imports of dependencies to
+// be checked as well as those of the packages in the tree.
+func WithTests(allTests bool) Option {
+	return func(rw *Rewriter) {
+		rw.checker.AllTests = allTests
+	}
+}
+
+// WithExcludes adds patterns matching directories whose
+// packages should not be changed. See Checker.Excludes.
+func WithExcludes(patterns ...string) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Excludes = append(rw.checker.Excludes, patterns...)
+	}
+}
+
+// WithOverrides adds rules that apply in place of the others
+// to particular directories in the tree. See Checker.Overrides.
+func WithOverrides(overrides ...*Override) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Overrides = append(rw.checker.Overrides, overrides...)
+	}
+}
+
+// WithAllowed adds import path prefixes of dependencies
+// that are allowed to use inconsistent paths. See
+// Checker.Allow.
+func WithAllowed(prefixes ...string) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Allow = append(rw.checker.Allow, prefixes...)
+	}
+}
+
+// WithHidden causes directories whose names start with
+// a dot to be searched too. See Checker.Hidden.
+func WithHidden(hidden bool) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Hidden = hidden
+	}
+}
+
+// WithTemplates causes the import paths in template files
+// to be changed too. See Checker.Templates.
+func WithTemplates(templates bool) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Templates = templates
+	}
+}
+
+// WithPackages restricts the packages in the tree that are
+// checked and changed to those matching the given patterns.
+// See Checker.Packages.
+func WithPackages(patterns ...string) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Packages = append(rw.checker.Packages, patterns...)
+	}
+}
+
+// WithRoots restricts the packages in the tree that are
+// checked and changed to those reachable from the packages
+// matching the given patterns. See Checker.Roots.
+func WithRoots(patterns ...string) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Roots = append(rw.checker.Roots, patterns...)
+	}
+}
+
+// WithDeep causes dependencies with inconsistent paths to
+// be changed too, when their source can be written.
+func WithDeep(deep bool) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Deep = deep
+	}
+}
+
+// WithoutDependencies suppresses checking of dependencies.
+func WithoutDependencies(noDeps bool) Option {
+	return func(rw *Rewriter) {
+		rw.checker.NoDependencies = noDeps
+	}
+}
+
+// WithMaxDepth limits how many levels of imports are followed
+// from the packages in the tree when checking dependencies.
+// See Checker.MaxDepth.
+func WithMaxDepth(depth int) Option {
+	return func(rw *Rewriter) {
+		rw.checker.MaxDepth = depth
+	}
+}
+
+// WithoutNestedModules causes modules nested within
+// the tree to be left alone. See Checker.NoNestedModules.
+func WithoutNestedModules(noNested bool) Option {
+	return func(rw *Rewriter) {
+		rw.checker.NoNestedModules = noNested
+	}
+}
+
+// WithoutSubdirectories restricts the Rewriter to the package
+// in its directory. See Checker.NoSubdirectories.
+func WithoutSubdirectories(noSubdirs bool) Option {
+	return func(rw *Rewriter) {
+		rw.checker.NoSubdirectories = noSubdirs
+	}
+}
+
+// WithFS causes the Rewriter to operate on the source tree
+// held in fsys rather than on the host file system. See
+// Checker.FS for how paths are interpreted. To apply changes,
+// fsys must implement WriteFS.
+func WithFS(fsys fs.FS) Option {
+	return func(rw *Rewriter) {
+		rw.checker.FS = fsys
+	}
+}
+
+// WithPackagesDriver causes the Rewriter to load packages
+// with the given go/packages driver program.
+// See Checker.PackagesDriver.
+func WithPackagesDriver(driver string) Option {
+	return func(rw *Rewriter) {
+		rw.checker.PackagesDriver = driver
+	}
+}
+
+// WithParallel sets the maximum number of files that Plan
+// and Apply work on at once. By default, or if n is less than
+// one, the value of runtime.GOMAXPROCS is used. When reading
+// from an FS (see WithFS), it must allow concurrent use.
+func WithParallel(n int) Option {
+	return func(rw *Rewriter) {
+		rw.parallel = n
+	}
+}
+
+// WithCache causes Plan to record, in a file within dir, a hash
+// of each file found to need no changes, and to skip parsing the
+// file on later runs while its content and the rules remain the
+// same. The cache is not used with WithMapping, as the results
+// of a MapFunc may change from one run to the next.
+func WithCache(dir string) Option {
+	return func(rw *Rewriter) {
+		rw.cacheDir = dir
+	}
+}
+
+// WithFetched sets the versions of modules downloaded
+// for the changes to be resolved against. See
+// Checker.Fetched.
+func WithFetched(fetched map[string]string) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Fetched = fetched
+	}
+}
+
+// WithLogf sets the function used to report problems
+// that do not prevent the Rewriter from continuing.
+func WithLogf(logf func(f string, a ...interface{})) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Logf = logf
+	}
+}
+
+// Scan finds all the packages in the tree and checks them
+// and their dependencies. The result is retained for
+// use by Plan.
+func (rw *Rewriter) Scan() (*Result, error) {
+	result, err := rw.checker.Check()
+	if err != nil {
+		return nil, err
+	}
+	rw.result = result
+	return result, nil
+}
+
+// Plan holds the changes to be made by a Rewriter.
+type Plan struct {
+	// Result holds the result of the scan
+	// that the plan was made from.
+	Result *Result
+
+	// Files holds an entry for each file to change,
+	// ordered by package import path and file name.
+	Files []*FileEdit
+}
+
+// FileEdit holds the changes to make to a single file.
+type FileEdit struct {
+	// Path holds the path of the file.
+	Path string
+
+	// Package holds the package that the file is part of.
+	Package *Package
+
+	// Generated holds whether the file carries a
+	// "Code generated ... DO NOT EDIT." comment.
+	Generated bool
+
+	// Template holds whether the file is a template
+	// rather than Go source. See Checker.Templates.
+	Template bool
+
+	// Changes holds the import paths to change,
+	// in source order.
+	Changes []*ImportChange
+}
+
+// ImportChange holds a change to a single import path.
+type ImportChange struct {
+	// Pos holds the position of the import path.
+	Pos token.Position
+
+	// Old and New hold the import path before
+	// and after the change.
+	Old, New string
+
+	// Offset and End hold the byte offsets in the file of
+	// the start and end of the quoted import path, and
+	// Replacement holds the text that should replace it.
+	Offset, End int
+	Replacement string
+
+	// Directive holds whether the path qualifies the target
+	// of a //go:linkname directive rather than being imported,
+	// in which case Replacement holds it unquoted.
+	Directive bool
+}
+
+// Plan works out the changes needed to the packages found by
+// Scan, which is called first if it has not been already. Packages
+// in modules that failed their checks are not changed unless
+// WithoutFailing was given.
+func (rw *Rewriter) Plan() (*Plan, error) {
+	if rw.result == nil {
+		if _, err := rw.Scan(); err != nil {
+			return nil, err
+		}
+	}
+	type job struct {
+		p    *Package
+		file string
+		tmpl bool
+	}
+	var jobs []job
+	for _, p := range rw.result.Packages {
+		if p.Module.Failed && !rw.noFailing {
+			continue
+		}
+		if p.NeedsEdit || p.importsUnsafe {
+			for _, file := range p.GoFiles {
+				jobs = append(jobs, job{p, file, false})
+			}
+		}
+		// Whether a template needs changing is not
+		// known until it has been read.
+		for _, file := range p.TemplateFiles {
+			jobs = append(jobs, job{p, file, true})
+		}
+	}
+	rw.cache = rw.checker.openPlanCache(rw.cacheDir, rw.importGroup)
+	edits := make([]*FileEdit, len(jobs))
+	problems := make([]*Problem, len(jobs))
+	start := time.Now()
+	rw.forEach(len(jobs), func(i int) {
+		if jobs[i].tmpl {
+			edits[i], problems[i] = rw.planTemplate(jobs[i].p, jobs[i].file)
+		} else {
+			edits[i], problems[i] = rw.planFile(jobs[i].p, jobs[i].file)
+		}
+	})
+	rw.checker.endPhase(ParsePhase, start)
+	if rw.cache != nil {
+		if err := rw.cache.save(); err != nil {
+			rw.logf("cannot save cache: %v", err)
+		}
+	}
+	// The problems are logged in plan order so that
+	// the output does not depend on scheduling.
+	for _, p := range problems {
+		if p != nil {
+			if rw.checker.FailFast {
+				return nil, p
+			}
+			rw.logf("%v", p)
+			rw.result.Problems = append(rw.result.Problems, p)
+			rw.checker.event(&Event{Kind: ProblemEvent, Problem: p})
+		}
+	}
+	plan := &Plan{
+		Result: rw.result,
+	}
+	for _, edit := range edits {
+		if edit != nil && len(edit.Changes) > 0 {
+			plan.Files = append(plan.Files, edit)
+		}
+	}
+	return plan, nil
+}
+
+// planFile works out the changes needed to a single file in
+// package p. It returns a nil edit if the cache shows that the
+// file needs no changes, or if the file cannot be read or parsed,
+// in which case it also returns the problem.
+func (rw *Rewriter) planFile(p *Package, file string) (*FileEdit, *Problem) {
+	var src []byte
+	var fset *token.FileSet
+	var f *ast.File
+	if pf := rw.parsedFile(file); pf != nil {
+		src, fset, f = pf.src, rw.result.parsed.fset, pf.f
+	} else {
+		rw.checker.tracef("parse %s", file)
+		var err error
+		src, err = rw.files().readFile(file)
+		if err != nil {
+			return nil, &Problem{Kind: ReadProblem, Path: file, Err: err}
+		}
+	}
+	var key string
+	if rw.cache != nil {
+		key = rw.cache.key(src)
+		if rw.cache.unchanged(file, key) {
+			return nil, nil
+		}
+	}
+	if f == nil {
+		mode := parser.ImportsOnly
+		if !rw.importsOnly {
+			mode |= parser.ParseComments
+		}
+		fset = token.NewFileSet()
+		var err error
+		f, err = parser.ParseFile(fset, file, src, mode)
+		if err != nil {
+			return nil, &Problem{Kind: ParseProblem, Path: file, Err: err}
+		}
+	}
+	edit := &FileEdit{
+		Path:      file,
+		Package:   p,
+		Generated: ast.IsGenerated(f),
+	}
+	var inGroup map[*ast.ImportSpec]bool
+	if rw.importGroup != "" {
+		inGroup = groupImports(fset, f, rw.importGroup)
+	}
+	for _, ispec := range f.Imports {
+		impPath, err := strconv.Unquote(ispec.Path.Value)
+		if err != nil || inGroup != nil && !inGroup[ispec] {
+			continue
+		}
+		if fixed := rw.checker.fixFor(p.Override, impPath); fixed != impPath {
+			// The position is reported as it is in the
+			// file itself, ignoring any //line directives.
+			pos := fset.PositionFor(ispec.Path.Pos(), false)
+			edit.Changes = append(edit.Changes, &ImportChange{
+				Pos:         pos,
+				Old:         impPath,
+				New:         fixed,
+				Offset:      pos.Offset,
+				End:         fset.PositionFor(ispec.Path.End(), false).Offset,
+				Replacement: strconv.Quote(fixed),
+			})
+		}
+	}
+	if importsUnsafe(f) {
+		edit.Changes = append(edit.Changes, rw.linknameChanges(p, file, src)...)
+		sort.SliceStable(edit.Changes, func(i, j int) bool {
+			return edit.Changes[i].Offset < edit.Changes[j].Offset
+		})
+	}
+	if rw.cache != nil {
+		rw.cache.record(file, key, len(edit.Changes) > 0)
+	}
+	return edit, nil
+}
+
+// forEach calls f for each integer from 0 to n-1, with
+// as many calls running at once as rw allows.
+func (rw *Rewriter) forEach(n int, f func(i int)) {
+	parallel := rw.parallel
+	if parallel < 1 {
+		parallel = runtime.GOMAXPROCS(0)
+	}
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallel)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Apply makes the changes in the given plan, unless the
+// Rewriter was configured for a dry run. Changes may be
+// removed from the plan before calling Apply to prevent
+// them being made. If any file cannot be changed, the
+// problem is logged and recorded in plan.Result.Problems and
+// Apply continues with the remaining files, unless WithFailFast
+// was given, returning an error at the end.
+func (rw *Rewriter) Apply(plan *Plan) error {
+	if rw.dryRun {
+		return nil
+	}
+	errs := make([]error, len(plan.Files))
+	var stop int32
+	start := time.Now()
+	rw.forEach(len(plan.Files), func(i int) {
+		if rw.checker.FailFast && atomic.LoadInt32(&stop) != 0 {
+			return
+		}
+		if edit := plan.Files[i]; len(edit.Changes) > 0 {
+			if errs[i] = rw.applyEdit(edit); errs[i] != nil {
+				atomic.StoreInt32(&stop, 1)
+			}
+		}
+	})
+	rw.checker.endPhase(WritePhase, start)
+	// The problems are logged in plan order so that
+	// the output does not depend on scheduling.
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			rw.logf("%v", err)
+			p := &Problem{
+				Kind: WriteProblem,
+				Path: plan.Files[i].Path,
+				Err:  err,
+			}
+			plan.Result.Problems = append(plan.Result.Problems, p)
+			rw.checker.event(&Event{Kind: ProblemEvent, Problem: p})
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("cannot change %d files", failed)
+	}
+	return nil
+}
+
+// applyEdit makes the changes in a single file.
+func (rw *Rewriter) applyEdit(edit *FileEdit) error {
+	rw.checker.tracef("write %s", edit.Path)
+	files := rw.files()
+	info, err := files.stat(edit.Path)
+	if err != nil {
+		return err
+	}
+	_, data, err := rw.Content(edit)
+	if err != nil {
+		return err
+	}
+	if err := files.writeFile(edit.Path, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("cannot write file: %v", err)
+	}
+	rw.checker.event(&Event{Kind: FileEvent, Package: edit.Package, Path: edit.Path})
+	return nil
+}
+
+// Content returns the current contents of the file changed by
+// edit and the contents it will have once the changes are made,
+// without changing the file.
+func (rw *Rewriter) Content(edit *FileEdit) (old, new []byte, err error) {
+	src, err := rw.files().readFile(edit.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot read %q: %v", edit.Path, err)
+	}
+	if edit.Template {
+		data, err := templateContent(edit, src)
+		return src, data, err
+	}
+	var fset *token.FileSet
+	var f *ast.File
+	// The file parsed by the check can be used if it is
+	// unchanged, unless identifiers are to be renamed,
+	// which needs the whole file.
+	if pf := rw.parsedFile(edit.Path); pf != nil && len(rw.renames) == 0 && bytes.Equal(pf.src, src) {
+		fset, f = rw.result.parsed.fset, pf.f
+	} else {
+		fset = token.NewFileSet()
+		if f, err = parser.ParseFile(fset, edit.Path, src, parser.ParseComments); err != nil {
+			return nil, nil, fmt.Errorf("cannot parse %q: %v", edit.Path, err)
+		}
+	}
+	// The changes are made to the text of the file rather than
+	// by printing the changed syntax tree, so that everything
+	// else, including any //line and //go: directives apart from
+	// the paths changed in them, is left exactly as it was.
+	changes := make(map[int]*ImportChange)
+	var edits []Edit
+	for _, c := range edit.Changes {
+		if !c.Directive {
+			changes[c.Pos.Offset] = c
+			continue
+		}
+		if c.End > len(src) || linknameUnescape(string(src[c.Offset:c.End])) != c.Old {
+			return nil, nil, fmt.Errorf("%s: file has changed since the plan was made", c.Pos)
+		}
+		tf := fset.File(f.Pos())
+		edits = append(edits, Edit{
+			Pos: tf.Pos(c.Offset),
+			End: tf.Pos(c.End),
+			New: c.Replacement,
+		})
+	}
+	changed := make(map[*ast.ImportSpec]string)
+	for _, ispec := range f.Imports {
+		c := changes[fset.Position(ispec.Path.Pos()).Offset]
+		if c == nil {
+			continue
+		}
+		if impPath, err := strconv.Unquote(ispec.Path.Value); err != nil || impPath != c.Old {
+			return nil, nil, fmt.Errorf("%s: file has changed since the plan was made", c.Pos)
+		}
+		edits = append(edits, Edit{
+			Pos: ispec.Path.Pos(),
+			End: ispec.Path.End(),
+			New: c.Replacement,
+		})
+		changed[ispec] = c.Old
+	}
+	edits = append(edits, rw.renameIdents(f, changed)...)
+	data, err := applyEdits(fset, src, edits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", edit.Path, err)
+	}
+	if len(rw.fixers) > 0 {
+		data, err = rw.applyFixers(edit.Path, data, edit.Changes)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return src, data, nil
+}
+
+// parsedFile returns the given file as parsed by the
+// check, or nil if it was not.
+func (rw *Rewriter) parsedFile(file string) *parsedFile {
+	if rw.result == nil {
+		return nil
+	}
+	return rw.result.parsed.lookup(file)
+}
+
+func (rw *Rewriter) files() vfs {
+	return vfs{rw.checker.FS}
+}
+
+func (rw *Rewriter) logf(f string, a ...interface{}) {
+	if rw.checker.Logf != nil {
+		rw.checker.Logf(f, a...)
+	}
+}
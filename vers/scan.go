@@ -0,0 +1,179 @@
+package vers
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// fileCache holds the files in the tree parsed by the check, so
+// that Plan and Content need not read and parse them again. All
+// the files share a single FileSet.
+type fileCache struct {
+	fset  *token.FileSet
+	mu    sync.Mutex
+	files map[string]*parsedFile
+}
+
+// parsedFile holds a file parsed by the check. Only its package
+// clause, imports and the comments among them are parsed.
+type parsedFile struct {
+	src []byte
+	f   *ast.File
+}
+
+func newFileCache() *fileCache {
+	return &fileCache{
+		fset:  token.NewFileSet(),
+		files: make(map[string]*parsedFile),
+	}
+}
+
+func (fc *fileCache) add(file string, pf *parsedFile) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.files[file] = pf
+}
+
+// lookup returns the parsed file with the given name,
+// or nil if it was not parsed by the check. It may
+// be called on a nil fileCache.
+func (fc *fileCache) lookup(file string) *parsedFile {
+	if fc == nil {
+		return nil
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.files[file]
+}
+
+// loadPackage is like ctxt.Import, but once the package's directory
+// has been found it reads only the import blocks of the package's
+// files, which is all that checking needs. Anything out of the
+// ordinary, such as a directory holding more than one package or
+// a file that cannot be parsed, is left to go/build to load and
+// report as usual. If keep is true, the parsed files are kept
+// in c.parsed for use by Plan.
+func (c *checker) loadPackage(ctxt *build.Context, path, srcDir string, keep bool) (*build.Package, error) {
+	pkg, err := ctxt.Import(path, srcDir, build.FindOnly)
+	if err != nil {
+		return pkg, err
+	}
+	if err := c.scanImports(ctxt, pkg, keep); err != nil {
+		if _, ok := err.(*build.NoGoError); ok {
+			return pkg, err
+		}
+		return ctxt.Import(path, srcDir, 0)
+	}
+	return pkg, nil
+}
+
+// scanImports fills in the files and imports of pkg, whose
+// directory has been found, from the Go files in the directory
+// that match ctxt's build constraints. Only the fields used by
+// the check are filled in.
+func (c *checker) scanImports(ctxt *build.Context, pkg *build.Package, keep bool) error {
+	entries, err := c.files.readDir(pkg.Dir)
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	if keep {
+		fset = c.parsed.fset
+	}
+	imports := make(map[string][]token.Position)
+	testImports := make(map[string][]token.Position)
+	xtestImports := make(map[string][]token.Position)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasPrefix(name, "_") || strings.HasPrefix(name, ".") {
+			continue
+		}
+		match, err := ctxt.MatchFile(pkg.Dir, name)
+		if err != nil {
+			return err
+		}
+		if !match {
+			pkg.IgnoredGoFiles = append(pkg.IgnoredGoFiles, name)
+			continue
+		}
+		file := c.files.join(pkg.Dir, name)
+		src, err := c.files.readFile(file)
+		if err != nil {
+			return err
+		}
+		// The comments are parsed too, as Plan
+		// needs them to find generated files.
+		f, err := parser.ParseFile(fset, file, src, parser.ImportsOnly|parser.ParseComments)
+		if err != nil {
+			return err
+		}
+		if keep {
+			c.parsed.add(file, &parsedFile{src, f})
+		}
+		isTest := strings.HasSuffix(name, "_test.go")
+		isXTest := isTest && strings.HasSuffix(f.Name.Name, "_test") && f.Name.Name != pkg.Name
+		if !isXTest {
+			if pkg.Name == "" {
+				pkg.Name = f.Name.Name
+			} else if f.Name.Name != pkg.Name {
+				return &build.MultiplePackageError{Dir: pkg.Dir}
+			}
+		}
+		var paths []string
+		isCgo := false
+		for _, ispec := range f.Imports {
+			path, err := strconv.Unquote(ispec.Path.Value)
+			if err != nil {
+				return err
+			}
+			if path == "C" {
+				isCgo = true
+			}
+			paths = append(paths, path)
+		}
+		if isCgo && !ctxt.CgoEnabled {
+			pkg.IgnoredGoFiles = append(pkg.IgnoredGoFiles, name)
+			continue
+		}
+		m := imports
+		switch {
+		case isXTest:
+			m = xtestImports
+			pkg.XTestGoFiles = append(pkg.XTestGoFiles, name)
+		case isTest:
+			m = testImports
+			pkg.TestGoFiles = append(pkg.TestGoFiles, name)
+		case isCgo:
+			pkg.CgoFiles = append(pkg.CgoFiles, name)
+		default:
+			pkg.GoFiles = append(pkg.GoFiles, name)
+		}
+		for i, path := range paths {
+			m[path] = append(m[path], fset.Position(f.Imports[i].Pos()))
+		}
+	}
+	if len(pkg.GoFiles)+len(pkg.CgoFiles)+len(pkg.TestGoFiles)+len(pkg.XTestGoFiles) == 0 {
+		return &build.NoGoError{Dir: pkg.Dir}
+	}
+	pkg.Imports, pkg.ImportPos = importList(imports)
+	pkg.TestImports, pkg.TestImportPos = importList(testImports)
+	pkg.XTestImports, pkg.XTestImportPos = importList(xtestImports)
+	return nil
+}
+
+// importList returns the sorted import paths in m,
+// along with m itself, as go/build reports them.
+func importList(m map[string][]token.Position) ([]string, map[string][]token.Position) {
+	paths := make([]string, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths, m
+}
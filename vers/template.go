@@ -0,0 +1,128 @@
+package vers
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// isTemplateFile reports whether the file with the given name
+// holds a text/template template for generating Go source, as
+// found when Checker.Templates is set.
+func isTemplateFile(name string) bool {
+	return strings.HasSuffix(name, ".tmpl") || strings.HasSuffix(name, ".gotmpl")
+}
+
+var (
+	// templateImportPat matches a single import declaration,
+	// such as import yaml "gopkg.in/yaml.v2".
+	templateImportPat = regexp.MustCompile("^\\s*import\\s+(?:[\\w.]+\\s+)?(\"[^\"\\n]*\"|`[^`\\n]*`)")
+
+	// templateSpecPat matches an import spec
+	// within a parenthesized import declaration.
+	templateSpecPat = regexp.MustCompile("^\\s*(?:[\\w.]+\\s+)?(\"[^\"\\n]*\"|`[^`\\n]*`)")
+
+	templateBlockPat = regexp.MustCompile(`^\s*import\s*\(\s*$`)
+)
+
+// templateImports returns the position of each import path in the
+// template src, as the offsets of the start and end of the quoted
+// path. The template is not parsed, as its actions may make it
+// anything but Go; instead the import declarations are found line
+// by line, with any path holding an action, such as
+// "{{.Module}}/api", left out.
+func templateImports(src []byte) [][2]int {
+	var imports [][2]int
+	inBlock := false
+	offset := 0
+	for _, line := range bytes.SplitAfter(src, []byte("\n")) {
+		start := offset
+		offset += len(line)
+		var m []int
+		switch {
+		case inBlock && bytes.HasPrefix(bytes.TrimSpace(line), []byte(")")):
+			inBlock = false
+		case inBlock:
+			m = templateSpecPat.FindSubmatchIndex(line)
+		case templateBlockPat.Match(line):
+			inBlock = true
+		default:
+			m = templateImportPat.FindSubmatchIndex(line)
+		}
+		if m == nil || bytes.Contains(line[m[2]:m[3]], []byte("{{")) {
+			continue
+		}
+		imports = append(imports, [2]int{start + m[2], start + m[3]})
+	}
+	return imports
+}
+
+// planTemplate works out the changes needed to the import
+// paths in a single template file in the directory of package p.
+func (rw *Rewriter) planTemplate(p *Package, file string) (*FileEdit, *Problem) {
+	rw.checker.tracef("read %s", file)
+	src, err := rw.files().readFile(file)
+	if err != nil {
+		return nil, &Problem{Kind: ReadProblem, Path: file, Err: err}
+	}
+	edit := &FileEdit{
+		Path:     file,
+		Package:  p,
+		Template: true,
+	}
+	for _, imp := range templateImports(src) {
+		impPath, err := strconv.Unquote(string(src[imp[0]:imp[1]]))
+		if err != nil {
+			continue
+		}
+		if fixed := rw.checker.fixFor(p.Override, impPath); fixed != impPath {
+			edit.Changes = append(edit.Changes, &ImportChange{
+				Pos:         offsetPosition(file, src, imp[0]),
+				Old:         impPath,
+				New:         fixed,
+				Offset:      imp[0],
+				End:         imp[1],
+				Replacement: strconv.Quote(fixed),
+			})
+		}
+	}
+	return edit, nil
+}
+
+// templateContent returns the contents that the template file
+// changed by edit will have once the changes are made to src,
+// its current contents. Only the import paths are changed:
+// identifiers are not renamed and fixers are not run, as the
+// template is not Go source.
+func templateContent(edit *FileEdit, src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	last := 0
+	for _, c := range edit.Changes {
+		if c.Offset < last || c.End > len(src) {
+			return nil, fmt.Errorf("%s: file has changed since the plan was made", c.Pos)
+		}
+		if impPath, err := strconv.Unquote(string(src[c.Offset:c.End])); err != nil || impPath != c.Old {
+			return nil, fmt.Errorf("%s: file has changed since the plan was made", c.Pos)
+		}
+		buf.Write(src[last:c.Offset])
+		buf.WriteString(c.Replacement)
+		last = c.End
+	}
+	buf.Write(src[last:])
+	return buf.Bytes(), nil
+}
+
+// offsetPosition returns the position of the given
+// byte offset in src, the contents of file.
+func offsetPosition(file string, src []byte, offset int) token.Position {
+	before := src[:offset]
+	return token.Position{
+		Filename: file,
+		Offset:   offset,
+		Line:     bytes.Count(before, []byte("\n")) + 1,
+		Column:   offset - bytes.LastIndexByte(before, '\n'),
+	}
+}
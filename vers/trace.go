@@ -0,0 +1,52 @@
+package vers
+
+import "time"
+
+// The phases reported to Checker.Phase.
+const (
+	// WalkPhase finds the packages in the tree.
+	WalkPhase = "walk"
+
+	// CheckPhase checks the packages and their dependencies.
+	CheckPhase = "check"
+
+	// ParsePhase reads and parses the files to be changed
+	// to work out the changes to make to them.
+	ParsePhase = "parse"
+
+	// WritePhase writes the changed files.
+	WritePhase = "write"
+)
+
+// WithPhase sets the function called with the time taken by
+// each phase of the work, so that a slow run can be diagnosed.
+// See Checker.Phase.
+func WithPhase(phase func(name string, d time.Duration)) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Phase = phase
+	}
+}
+
+// WithTracef sets the function called to trace each directory,
+// package and file as it is processed. See Checker.Tracef.
+func WithTracef(tracef func(f string, a ...interface{})) Option {
+	return func(rw *Rewriter) {
+		rw.checker.Tracef = tracef
+	}
+}
+
+// endPhase reports that the named phase, started
+// at the given time, has finished.
+func (c *Checker) endPhase(name string, start time.Time) {
+	if c.Phase != nil {
+		c.Phase(name, time.Since(start))
+	}
+}
+
+// tracef traces the progress of the
+// work if c.Tracef is set.
+func (c *Checker) tracef(f string, a ...interface{}) {
+	if c.Tracef != nil {
+		c.Tracef(f, a...)
+	}
+}
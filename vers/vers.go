@@ -0,0 +1,189 @@
+// Package vers implements the analysis behind the govers
+// command. It finds the Go packages in a source tree and
+// checks that they and their dependencies use import paths
+// consistently with a set of rewrite rules, reporting
+// any inconsistencies as structured findings.
+package vers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultVersionPattern holds the regular expression used to
+// match a version element within a package path when none is
+// specified. It matches elements such as ".v2", "/v3", "/v1.2",
+// "/v20240101" or ".v2-unstable", and contains no capturing
+// groups.
+const DefaultVersionPattern = `[/.]v[0-9]+(?:\.[0-9]+)*(?:-unstable)?`
+
+// Rule holds a single rewrite rule: import paths with a prefix
+// matching OldPackagePat are changed to use NewPackage instead.
+type Rule struct {
+	// Arg holds the argument that the rule was parsed from.
+	Arg string
+
+	// NewPackage holds the replacement prefix.
+	NewPackage string
+
+	// OldPackagePat holds the pattern matched against
+	// import paths. The prefix to be replaced is held
+	// in its first capturing group.
+	OldPackagePat *regexp.Regexp
+
+	// Exclude, if non-nil, holds a pattern matching import
+	// paths that the rule does not apply to even though
+	// they match OldPackagePat.
+	Exclude *regexp.Regexp
+}
+
+// Excludes reports whether r does not apply
+// to p because p matches r.Exclude.
+func (r *Rule) Excludes(p string) bool {
+	return r.Exclude != nil && r.Exclude.MatchString(p)
+}
+
+// ParseRule parses a rule from arg, a new package path that
+// may be prefixed by "regexp=" to specify the pattern explicitly
+// (an import path cannot contain '='). Otherwise match is used
+// as the pattern if it is non-empty, or the pattern is derived
+// from the path using PathVersionPat with the given version
+// pattern.
+func ParseRule(arg, match, versPat string) (*Rule, error) {
+	newPackage := arg
+	if i := strings.LastIndex(arg, "="); i >= 0 {
+		match, newPackage = arg[0:i], arg[i+1:]
+	}
+	r := &Rule{
+		Arg:        arg,
+		NewPackage: newPackage,
+	}
+	if match == "" {
+		pat, err := PathVersionPat(newPackage, versPat)
+		if err != nil {
+			return nil, err
+		}
+		r.OldPackagePat = pat
+		return r, nil
+	}
+	pat, err := regexp.Compile("^(" + match + ")")
+	if err != nil {
+		return nil, fmt.Errorf("invalid match pattern: %v", err)
+	}
+	r.OldPackagePat = pat
+	return r, nil
+}
+
+// PathVersionPat returns a pattern that will match any
+// package path that's the same as p except possibly
+// the version number. Version elements are matched by
+// versPat, which must not contain capturing groups;
+// if it is empty, DefaultVersionPattern is used.
+func PathVersionPat(p, versPat string) (*regexp.Regexp, error) {
+	if versPat == "" {
+		versPat = DefaultVersionPattern
+	}
+	versRe, err := regexp.Compile(versPat + "(/|$)")
+	if err != nil {
+		return nil, fmt.Errorf("invalid version pattern: %v", err)
+	}
+	if versRe.NumSubexp() != 1 {
+		return nil, fmt.Errorf("version pattern must not contain capturing groups")
+	}
+	if !versRe.MatchString(p) {
+		return nil, fmt.Errorf("%q is not versioned", p)
+	}
+	// Use an intermediate step so that we can use QuoteMeta after
+	// matching against versPat.  (versPat won't match quoted
+	// metacharacters).
+	// Note that  '#' is an invalid character in an import path
+	p = versRe.ReplaceAllString(p, "#${1}")
+	p = regexp.QuoteMeta(p)
+	// BUG doesn't match "foo/v0/v1/bar", but do we care?
+	p = "^(" + strings.Replace(p, "#", versPat, -1) + ")(/|$)"
+	return regexp.Compile(p)
+}
+
+// MapFunc is a function that decides how an import path should
+// be changed. It returns the replacement path and true, or false if
+// the path should be left alone. A MapFunc may implement any
+// policy, such as a lookup table or a call to a service. It may
+// be called more than once for the same path, and by several
+// goroutines at once.
+type MapFunc func(importPath string) (string, bool)
+
+// Rules holds a set of rewrite rules. When more than
+// one rule matches a path, the first one is used.
+type Rules []*Rule
+
+// Find returns the first rule that matches p and the
+// length of the matched prefix, or nil if there is none.
+func (rs Rules) Find(p string) (*Rule, int) {
+	for _, r := range rs {
+		if r.Excludes(p) {
+			continue
+		}
+		loc := r.OldPackagePat.FindStringSubmatchIndex(p)
+		if loc != nil {
+			return r, loc[3]
+		}
+	}
+	return nil, 0
+}
+
+// Fix returns p rewritten according to the first rule that
+// matches it. The path is normalized (see NormalizePath) before
+// it is matched, so a path that matches is always returned in
+// canonical form.
+func (rs Rules) Fix(p string) string {
+	n := NormalizePath(p)
+	r, i := rs.Find(n)
+	if r == nil {
+		return p
+	}
+	return r.NewPackage + n[i:]
+}
+
+// foldPats maps each rule pattern to a case-insensitive
+// version of it, as compiled by fixFold.
+var foldPats sync.Map
+
+// fixFold is like Fix, but matches the patterns of the
+// rules against p without regard to case.
+func (rs Rules) fixFold(p string) string {
+	n := NormalizePath(p)
+	fold := func(pat *regexp.Regexp) *regexp.Regexp {
+		if fp, ok := foldPats.Load(pat); ok {
+			return fp.(*regexp.Regexp)
+		}
+		fp, _ := foldPats.LoadOrStore(pat, regexp.MustCompile("(?i)"+pat.String()))
+		return fp.(*regexp.Regexp)
+	}
+	for _, r := range rs {
+		if r.Exclude != nil && fold(r.Exclude).MatchString(n) {
+			continue
+		}
+		if loc := fold(r.OldPackagePat).FindStringSubmatchIndex(n); loc != nil {
+			return r.NewPackage + n[loc[3]:]
+		}
+	}
+	return p
+}
+
+// NormalizePath returns the import path p in canonical form,
+// without the trailing slashes, repeated slashes and "."
+// elements sometimes seen in hand-written imports. The
+// leading "." or ".." of a relative import path is kept.
+func NormalizePath(p string) string {
+	elems := strings.Split(p, "/")
+	out := elems[:0]
+	for i, e := range elems {
+		if i > 0 && (e == "" || e == ".") {
+			continue
+		}
+		out = append(out, e)
+	}
+	return strings.Join(out, "/")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/tools/go/analysis/unitchecker"
+
+	"github.com/rogpeppe/govers/vers"
+	"github.com/rogpeppe/govers/vers/analyzer"
+)
+
+// When run by "go vet -vettool", govers runs the analyzer in
+// the vers/analyzer package through unitchecker, so that the
+// go command loads the packages and runs the analysis on each
+// package and its dependencies in turn, and the diagnostics and
+// their suggested fixes take the same form as those of any other
+// analyzer, including in the -json output read by editors.
+
+// isVetTool reports whether govers has been run by
+// go vet -vettool, with the given arguments: either the single
+// -V=full or -flags argument with which go vet asks for the tool's
+// version and flags, or a vet configuration file for a package
+// as the final argument, after any flags.
+func isVetTool(args []string) bool {
+	if len(args) == 1 && (args[0] == "-V=full" || args[0] == "-flags") {
+		return true
+	}
+	if len(args) == 0 {
+		return false
+	}
+	file := args[len(args)-1]
+	return strings.HasSuffix(file, ".cfg") && isVetConfig(file)
+}
+
+// isVetConfig reports whether the given file holds a vet
+// configuration: one with the fields that the go command
+// always gives.
+func isVetConfig(file string) bool {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false
+	}
+	for _, name := range []string{"ID", "ImportPath", "GoFiles", "VetxOutput"} {
+		if _, ok := fields[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// commandFlags holds the flags of the govers command, which
+// configuration files may set, as flag.CommandLine is replaced
+// when running as a vet tool.
+var commandFlags = flag.CommandLine
+
+// runVetTool runs govers as a vet tool. Without the analyzer's
+// -govers.new flag, the rules for each package are taken from
+// the configuration file for its directory.
+func runVetTool() {
+	// The flags of the govers command itself
+	// do not apply; unitchecker defines its own.
+	flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	unitchecker.Main(analyzer.New(configRules))
+}
+
+// configRules returns the rules given by the configuration
+// file for dir, or none if there is no such file.
+func configRules(dir string) (vers.Rules, error) {
+	c, err := findConfig(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read configuration: %v", err)
+	}
+	if c == nil {
+		return nil, nil
+	}
+	var rules vers.Rules
+	for _, arg := range c.rewrites {
+		r, err := vers.ParseRule(arg, "", "")
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
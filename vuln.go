@@ -0,0 +1,412 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var vulnCheck = flag.Bool("vuln", false, "before making any changes, check the versions being changed to against the Go vulnerability database")
+
+// vulnDB holds the vulnerability database named by GOVULNDB.
+type vulnDB struct {
+	url string
+}
+
+// newVulnDB returns the vulnerability database
+// named by GOVULNDB.
+func newVulnDB() *vulnDB {
+	u := os.Getenv("GOVULNDB")
+	if u == "" {
+		u = "https://vuln.go.dev"
+	}
+	return &vulnDB{
+		url: strings.TrimSuffix(u, "/"),
+	}
+}
+
+// get fetches the file with the given name, such as
+// "index/modules.json", from the database, which
+// may be a file:// URL.
+func (db *vulnDB) get(name string) ([]byte, error) {
+	if strings.HasPrefix(db.url, "file://") {
+		u, err := url.Parse(db.url)
+		if err != nil {
+			return nil, err
+		}
+		return os.ReadFile(filepath.Join(filepath.FromSlash(u.Path), filepath.FromSlash(name)))
+	}
+	resp, data, err := netGet(db.url + "/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s/%s: %s", db.url, name, resp.Status)
+	}
+	return data, nil
+}
+
+// vulnModule holds an entry in the database's index of
+// modules: the module's path and the vulnerabilities
+// affecting it, each with the version that fixes it, if any.
+type vulnModule struct {
+	Path  string `json:"path"`
+	Vulns []struct {
+		ID    string `json:"id"`
+		Fixed string `json:"fixed"`
+	} `json:"vulns"`
+}
+
+// osvEntry holds the parts of an entry in the database,
+// in OSV format, that are used here.
+type osvEntry struct {
+	ID       string   `json:"id"`
+	Aliases  []string `json:"aliases"`
+	Summary  string   `json:"summary"`
+	Affected []struct {
+		Package struct {
+			Name string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string `json:"type"`
+			Events []struct {
+				Introduced string `json:"introduced"`
+				Fixed      string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+		EcosystemSpecific struct {
+			Imports []vulnImport `json:"imports"`
+		} `json:"ecosystem_specific"`
+	} `json:"affected"`
+}
+
+// vulnImport holds a package affected by a vulnerability
+// and the symbols in it that are vulnerable, all of them
+// if there are none.
+type vulnImport struct {
+	Path    string   `json:"path"`
+	Symbols []string `json:"symbols"`
+}
+
+// vuln holds a vulnerability affecting a version
+// of a module that the tree is being changed to use.
+type vuln struct {
+	entry   *osvEntry
+	module  string
+	version string
+	fixed   string
+	imports []vulnImport
+}
+
+// checkVulns checks the versions of the modules that the plan
+// changes imports to use against the vulnerability database
+// named by GOVULNDB, and reports each known vulnerability in
+// them that affects a package the changed files import, with the
+// uses of its vulnerable symbols in those files. The versions are
+// those required by -require or the subcommand, or otherwise
+// those that the go.mod files in the tree require. With -strict,
+// it fails if any vulnerability is found or any module cannot
+// be checked.
+func (ctxt *context) checkVulns(rw *vers.Rewriter, plan *vers.Plan) {
+	versions := make(map[string]string)
+	for _, pn := range ctxt.pins {
+		versions[pn.path] = pn.version
+	}
+	reqs := treeRequirements(ctxt.cwd)
+	modules := make(map[string]string)
+	var unknown []string
+	for _, edit := range plan.Files {
+		for _, c := range edit.Changes {
+			mod := vulnModulePath(c.New, versions, reqs)
+			switch {
+			case mod == "":
+				if !contains(unknown, c.New) {
+					unknown = append(unknown, c.New)
+				}
+			case versions[mod] == "":
+				versions[mod] = requiredVersion(mod, reqs)
+				fallthrough
+			default:
+				modules[mod] = versions[mod]
+			}
+		}
+	}
+	skipped := len(unknown) > 0
+	sort.Strings(unknown)
+	for _, p := range unknown {
+		logf("%s: no version is required of its module, so it was not checked for vulnerabilities", p)
+	}
+	if len(modules) == 0 {
+		ctxt.vulnsChecked(0, skipped)
+		return
+	}
+	db := newVulnDB()
+	vulns, err := db.find(modules)
+	if err != nil {
+		logf("cannot check for vulnerabilities: %v", err)
+		ctxt.vulnsChecked(0, true)
+		return
+	}
+	ctxt.vulnsChecked(ctxt.reportVulns(rw, plan, vulns), skipped)
+}
+
+// vulnsChecked fails, with -strict, if any vulnerabilities
+// were reported or anything could not be checked.
+func (ctxt *context) vulnsChecked(reported int, skipped bool) {
+	if !*strict {
+		return
+	}
+	switch {
+	case reported > 0:
+		logf("not making any changes because of the known vulnerabilities (-strict)")
+	case skipped:
+		logf("not making any changes because not everything could be checked for vulnerabilities (-strict)")
+	default:
+		return
+	}
+	ctxt.exit(1)
+}
+
+// vulnModulePath returns the path of the module holding the
+// package with import path p, found among the modules in
+// versions and those required in reqs, or "" if there is none.
+func vulnModulePath(p string, versions map[string]string, reqs []modRequirement) string {
+	best := ""
+	try := func(mod string) {
+		if (p == mod || strings.HasPrefix(p, mod+"/")) && len(mod) > len(best) {
+			best = mod
+		}
+	}
+	for mod := range versions {
+		try(mod)
+	}
+	for _, r := range reqs {
+		try(r.path)
+	}
+	return best
+}
+
+// requiredVersion returns the highest version of the
+// module with the given path required in reqs.
+func requiredVersion(mod string, reqs []modRequirement) string {
+	v := ""
+	for _, r := range reqs {
+		if r.path == mod && (v == "" || vers.CompareVersions(r.version, v) > 0) {
+			v = r.version
+		}
+	}
+	return v
+}
+
+// find returns the vulnerabilities in the database affecting
+// the modules in the given map, keyed by module path, at the
+// versions it holds, in order of module path and ID.
+func (db *vulnDB) find(modules map[string]string) ([]*vuln, error) {
+	data, err := db.get("index/modules.json")
+	if err != nil {
+		return nil, err
+	}
+	var index []vulnModule
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("cannot decode module index: %v", err)
+	}
+	var vulns []*vuln
+	for _, m := range index {
+		version, ok := modules[m.Path]
+		if !ok {
+			continue
+		}
+		for _, v := range m.Vulns {
+			if v.Fixed != "" && vers.CompareVersions(version, v.Fixed) >= 0 {
+				continue
+			}
+			data, err := db.get("ID/" + v.ID + ".json")
+			if err != nil {
+				return nil, err
+			}
+			entry := new(osvEntry)
+			if err := json.Unmarshal(data, entry); err != nil {
+				return nil, fmt.Errorf("cannot decode %s: %v", v.ID, err)
+			}
+			if vl := entry.affects(m.Path, version); vl != nil {
+				vulns = append(vulns, vl)
+			}
+		}
+	}
+	sort.Slice(vulns, func(i, j int) bool {
+		if vulns[i].module != vulns[j].module {
+			return vulns[i].module < vulns[j].module
+		}
+		return vulns[i].entry.ID < vulns[j].entry.ID
+	})
+	return vulns, nil
+}
+
+// affects returns the vulnerability that the entry describes in
+// the given version of the module, or nil if it does not affect
+// that version.
+func (e *osvEntry) affects(mod, version string) *vuln {
+	var vl *vuln
+	for _, a := range e.Affected {
+		if a.Package.Name != mod {
+			continue
+		}
+		for _, r := range a.Ranges {
+			if r.Type != "SEMVER" {
+				continue
+			}
+			// The events are in order, each introducing
+			// the vulnerability or fixing it.
+			affected, fixed := false, ""
+			for _, ev := range r.Events {
+				if ev.Introduced != "" && vers.CompareVersions(version, ev.Introduced) >= 0 {
+					affected = true
+				}
+				if ev.Fixed != "" {
+					if vers.CompareVersions(version, ev.Fixed) >= 0 {
+						affected = false
+					} else if fixed == "" {
+						fixed = "v" + ev.Fixed
+					}
+				}
+			}
+			if !affected {
+				continue
+			}
+			if vl == nil {
+				vl = &vuln{
+					entry:   e,
+					module:  mod,
+					version: version,
+				}
+			}
+			vl.fixed = fixed
+			vl.imports = append(vl.imports, a.EcosystemSpecific.Imports...)
+		}
+	}
+	return vl
+}
+
+// vulnUse holds a use of a vulnerable symbol or package.
+type vulnUse struct {
+	pos  token.Position
+	what string
+}
+
+// reportVulns reports each of the vulnerabilities that affects
+// a package imported by the files changed by the plan, with the
+// uses of its vulnerable symbols in those files, and returns the
+// number reported. A method is counted as used wherever its type
+// is, as the files are not type-checked.
+func (ctxt *context) reportVulns(rw *vers.Rewriter, plan *vers.Plan, vulns []*vuln) int {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, edit := range plan.Files {
+		if len(edit.Changes) == 0 || edit.Template {
+			continue
+		}
+		_, src, err := rw.Content(edit)
+		if err != nil {
+			logf("%v", err)
+			continue
+		}
+		f, err := parser.ParseFile(fset, edit.Path, src, parser.SkipObjectResolution)
+		if err != nil {
+			logf("cannot parse %s: %v", ctxt.relPath(edit.Path), err)
+			continue
+		}
+		files = append(files, f)
+	}
+	reported := 0
+	for _, vl := range vulns {
+		var uses []vulnUse
+		for _, f := range files {
+			uses = append(uses, vulnUses(fset, f, vl.imports)...)
+		}
+		if len(uses) == 0 {
+			continue
+		}
+		id := vl.entry.ID
+		if len(vl.entry.Aliases) > 0 {
+			id += " (" + strings.Join(vl.entry.Aliases, ", ") + ")"
+		}
+		fixed := "no fixed version"
+		if vl.fixed != "" {
+			fixed = "fixed in " + vl.fixed
+		}
+		logf("warning: %s@%s is affected by %s, %s: %s", vl.module, vl.version, id, fixed, vl.entry.Summary)
+		for _, u := range uses {
+			fmt.Fprintf(os.Stderr, "\t%s:%d:%d: %s\n", ctxt.relPath(u.pos.Filename), u.pos.Line, u.pos.Column, u.what)
+		}
+		reported++
+	}
+	return reported
+}
+
+// vulnUses returns the position and text of each use in f of
+// the vulnerable symbols in imps, or of each import in f of a
+// package in imps whose symbols are all vulnerable or whose
+// uses cannot be found, as with a dot import.
+func vulnUses(fset *token.FileSet, f *ast.File, imps []vulnImport) []vulnUse {
+	// names maps from the name of each affected
+	// import to its vulnerable symbols.
+	names := make(map[string][]string)
+	var uses []vulnUse
+	for _, spec := range f.Imports {
+		p, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		for _, imp := range imps {
+			if imp.Path != p {
+				continue
+			}
+			name := vers.ImportName(p)
+			if spec.Name != nil {
+				name = spec.Name.Name
+			}
+			switch {
+			case len(imp.Symbols) == 0 || name == ".":
+				uses = append(uses, vulnUse{fset.Position(spec.Pos()), "imports " + p})
+				continue
+			case name == "_":
+				// No symbols can be used.
+				continue
+			}
+			names[name] = append(names[name], imp.Symbols...)
+		}
+	}
+	if len(names) == 0 {
+		return uses
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		id, ok := sel.X.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		for _, sym := range names[id.Name] {
+			// A method is given as Type.Method.
+			if strings.SplitN(sym, ".", 2)[0] == sel.Sel.Name {
+				uses = append(uses, vulnUse{fset.Position(sel.Pos()), id.Name + "." + sym})
+			}
+		}
+		return true
+	})
+	return uses
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+// runWhy prints, for each dependency that uses an inconsistent
+// path, the chain of imports by which a package in the tree
+// reaches it, as "go mod why" does, so that it is clear which
+// direct dependency needs to be fixed.
+func runWhy(ctxt *context) {
+	rw := ctxt.newRewriter(vers.WithDryRun(true))
+	result, err := rw.Scan()
+	if err != nil {
+		fatalf("%v", err)
+	}
+	ctxt.result = result
+	ctxt.reportSkippedModules()
+	if len(result.Findings) == 0 {
+		logf("no dependency of the tree uses an inconsistent path")
+		ctxt.exit(0)
+	}
+	for i, f := range result.Findings {
+		if i > 0 {
+			fmt.Println()
+		}
+		if f.VendorDir != "" {
+			fmt.Printf("# %s imports %s, vendored at %s\n", f.Importer, f.ImportPath, ctxt.relPath(f.VendorDir))
+		} else {
+			fmt.Printf("# %s imports %s\n", f.Importer, f.ImportPath)
+		}
+		for _, p := range f.Chain {
+			fmt.Println(p)
+		}
+	}
+	ctxt.exit(0)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rogpeppe/govers/vers"
+)
+
+var worktreeBranch = flag.String("worktree", "", "make the changes on a new git `branch`, in a temporary worktree, leaving the current checkout untouched")
+
+// worktree holds the worktree created for -worktree,
+// if there is one.
+var worktree *gitWorktree
+
+// gitWorktree holds a temporary git worktree.
+type gitWorktree struct {
+	// repo holds the root of the checkout
+	// that the worktree was added to.
+	repo string
+
+	// dir holds the root of the worktree.
+	dir string
+
+	branch string
+
+	// committed holds whether the changes have been
+	// committed to the branch, which is then kept when
+	// the worktree is removed.
+	committed bool
+}
+
+// enterWorktree adds a worktree holding a new branch, named by
+// -worktree, at the commit checked out in the repository holding
+// dir, and returns the directory within the worktree at the same
+// place as dir, for the changes to be made in.
+func enterWorktree(dir string) string {
+	if real, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = real
+	}
+	out, err := runGit(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		fatalf("-worktree can only be used in a git repository: %v", err)
+	}
+	root := filepath.FromSlash(out)
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		fatalf("cannot find %s within %s: %v", dir, root, err)
+	}
+	if _, err := runGit(root, "rev-parse", "--verify", "--quiet", "refs/heads/"+*worktreeBranch); err == nil {
+		fatalf("branch %q already exists", *worktreeBranch)
+	}
+	tmp, err := os.MkdirTemp("", "govers-worktree")
+	if err != nil {
+		fatalf("cannot make worktree: %v", err)
+	}
+	if _, err := runGit(root, "worktree", "add", "-q", "-b", *worktreeBranch, tmp, "HEAD"); err != nil {
+		os.RemoveAll(tmp)
+		fatalf("cannot make worktree: %v", err)
+	}
+	worktree = &gitWorktree{
+		repo:   root,
+		dir:    tmp,
+		branch: *worktreeBranch,
+	}
+	logf("making changes in a worktree for branch %s; any uncommitted changes in %s are not included", worktree.branch, root)
+	return filepath.Join(tmp, rel)
+}
+
+// commitWorktree commits the changes made in the worktree
+// to its branch, with a message describing plan.
+func (ctxt *context) commitWorktree(plan *vers.Plan) {
+	w := worktree
+	if _, err := runGit(w.dir, "add", "-A"); err != nil {
+		fatalf("cannot commit changes: %v", err)
+	}
+	if _, err := runGit(w.dir, "diff", "--cached", "--quiet"); err == nil {
+		logf("no changes to commit to branch %s", w.branch)
+		return
+	}
+	subject, body := ctxt.commitMessage(plan)
+	if _, err := runGit(w.dir, "commit", "-q", "-m", subject+"\n\n"+body); err != nil {
+		fatalf("cannot commit changes: %v", err)
+	}
+	w.committed = true
+	rev, _ := runGit(w.dir, "rev-parse", "--short", "HEAD")
+	logf("committed changes to branch %s (%s)", w.branch, rev)
+}
+
+// remove removes the worktree, along with its branch
+// unless the changes were committed to it. It does
+// nothing if w is nil.
+func (w *gitWorktree) remove() {
+	if w == nil {
+		return
+	}
+	if _, err := runGit(w.repo, "worktree", "remove", "--force", w.dir); err != nil {
+		logf("cannot remove worktree %s: %v", w.dir, err)
+	}
+	os.RemoveAll(w.dir)
+	if !w.committed {
+		if _, err := runGit(w.repo, "branch", "-q", "-D", w.branch); err != nil {
+			logf("cannot remove branch %s: %v", w.branch, err)
+		}
+	}
+}
+
+// runGit runs git with the given arguments in dir,
+// returning its output with surrounding space removed.
+func runGit(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}